@@ -0,0 +1,496 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the KYC tiers an account can be registered with
+const (
+	TierAnonymous = "anonymous"
+	TierBasic     = "basic"
+	TierFull      = "full"
+	TierCorporate = "corporate"
+)
+
+// Define objectType names for prefix
+const (
+	accountPrefix    = "account"
+	tierLimitsPrefix = "tierLimits"
+	outflowPrefix    = "outflow"
+)
+
+var knownTiers = []string{TierAnonymous, TierBasic, TierFull, TierCorporate}
+
+// Account describes a KYC registered account allowed to hold tokens
+type Account struct {
+	ID           string    `json:"id"`
+	Tier         string    `json:"tier"`
+	Bank         string    `json:"bank"`
+	Category     string    `json:"category,omitempty"`
+	RegisteredBy string    `json:"registeredBy"`
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+// TierLimits holds the limits applied to every account of a KYC tier.
+// Limits are decimal strings, an empty string means the limit is not enforced
+type TierLimits struct {
+	Tier            string `json:"tier"`
+	MaxBalance      string `json:"maxBalance"`
+	MaxTransfer     string `json:"maxTransfer"`
+	MaxDailyOutflow string `json:"maxDailyOutflow"`
+}
+
+// accountEvent provides an organized struct for emitting account registry events
+type accountEvent struct {
+	Account  string `json:"account"`
+	Tier     string `json:"tier"`
+	Bank     string `json:"bank"`
+	Category string `json:"category,omitempty"`
+}
+
+// RegisterAccount registers an account with a KYC tier, the calling bank becomes its servicing bank.
+// Only registered accounts can receive tokens
+// This function triggers an AccountRegistered event
+func (s *Erc20Contract) RegisterAccount(ctx contractapi.TransactionContextInterface, account string, tier string) error {
+
+	err := requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to register accounts: %v", err)
+	}
+
+	err = validateTier(tier)
+	if err != nil {
+		return err
+	}
+	if account == "" || isInternalAccount(account) {
+		return fmt.Errorf("account %q is not a client account", account)
+	}
+
+	existing, err := readAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("account %s is already registered by %s", account, existing.Bank)
+	}
+
+	bank, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	registrar, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = putAccount(ctx, &Account{account, tier, bank, "", registrar, now})
+	if err != nil {
+		return err
+	}
+
+	err = emitAccountEvent(ctx, "AccountRegistered", accountEvent{account, tier, bank, ""})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("account %s registered with tier %s by %s", account, tier, bank)
+
+	return nil
+}
+
+// UpdateAccountTier moves a registered account to another KYC tier.
+// Only the servicing bank of the account can change its tier
+// This function triggers an AccountTierUpdated event
+func (s *Erc20Contract) UpdateAccountTier(ctx contractapi.TransactionContextInterface, account string, tier string) error {
+
+	err := requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to update accounts: %v", err)
+	}
+
+	err = validateTier(tier)
+	if err != nil {
+		return err
+	}
+
+	registered, err := requireServicedAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	registered.Tier = tier
+
+	err = putAccount(ctx, registered)
+	if err != nil {
+		return err
+	}
+
+	err = emitAccountEvent(ctx, "AccountTierUpdated", accountEvent{account, tier, registered.Bank, registered.Category})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("account %s moved to tier %s", account, tier)
+
+	return nil
+}
+
+// SetMerchantCategory sets the merchant category of a registered account, e.g. "food" or "school-supplies".
+// Earmarked programs allow spending by category, an empty category removes it.
+// Only the servicing bank of the account can set its category
+// This function triggers a MerchantCategorySet event
+func (s *Erc20Contract) SetMerchantCategory(ctx contractapi.TransactionContextInterface, account string, category string) error {
+
+	err := requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to update accounts: %v", err)
+	}
+
+	registered, err := requireServicedAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	registered.Category = category
+
+	err = putAccount(ctx, registered)
+	if err != nil {
+		return err
+	}
+
+	err = emitAccountEvent(ctx, "MerchantCategorySet", accountEvent{account, registered.Tier, registered.Bank, category})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("merchant category of %s set to %q", account, category)
+
+	return nil
+}
+
+// GetAccount returns the KYC registration of an account
+func (s *Erc20Contract) GetAccount(ctx contractapi.TransactionContextInterface, account string) (*Account, error) {
+
+	registered, err := readAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if registered == nil {
+		return nil, fmt.Errorf("account %s is not registered", account)
+	}
+
+	return registered, nil
+}
+
+// SetTierLimits configures the limits of a KYC tier
+// param {String} maxBalance The maximum balance of an account, e.g. "1000.00", empty for no limit
+// param {String} maxTransfer The maximum amount of a single outgoing transfer, empty for no limit
+// param {String} maxDailyOutflow The maximum amount an account can send per day, empty for no limit
+func (s *Erc20Contract) SetTierLimits(ctx contractapi.TransactionContextInterface, tier string, maxBalance string, maxTransfer string, maxDailyOutflow string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = requireRole(ctx, RoleAdmin, RoleRegulator)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set tier limits: %v", err)
+	}
+
+	err = validateTier(tier)
+	if err != nil {
+		return err
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Validate every limit is empty or a valid amount
+	for _, limit := range []string{maxBalance, maxTransfer, maxDailyOutflow} {
+		if limit == "" {
+			continue
+		}
+		_, err = parseAmount(limit, decimals)
+		if err != nil {
+			return err
+		}
+	}
+
+	limits := TierLimits{tier, maxBalance, maxTransfer, maxDailyOutflow}
+
+	key, err := compositeKey(ctx, tierLimitsPrefix, tier)
+	if err != nil {
+		return err
+	}
+
+	limitsJSON, err := json.Marshal(limits)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, limitsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set limits of tier %s: %v", tier, err)
+	}
+
+	log.Printf("limits of tier %s set to balance %q, transfer %q, daily outflow %q", tier, maxBalance, maxTransfer, maxDailyOutflow)
+
+	return nil
+}
+
+// GetTierLimits returns the limits configured for a KYC tier
+func (s *Erc20Contract) GetTierLimits(ctx contractapi.TransactionContextInterface, tier string) (*TierLimits, error) {
+
+	err := validateTier(tier)
+	if err != nil {
+		return nil, err
+	}
+
+	return readTierLimits(ctx, tier)
+}
+
+// Helper Functions
+
+// checkRecipientLimits enforces the KYC registry on an account receiving value.
+// The recipient must be registered and stay within the maximum balance of its tier
+func checkRecipientLimits(ctx contractapi.TransactionContextInterface, to string, toUpdatedBalance *big.Int) error {
+
+	// Accounts held by the contract, such as bank reserves, are not subject to KYC
+	if isInternalAccount(to) {
+		return nil
+	}
+
+	recipient, err := readAccount(ctx, to)
+	if err != nil {
+		return err
+	}
+	if recipient == nil {
+		return fmt.Errorf("recipient account %s is not registered by a licensed bank", to)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	recipientLimits, err := readTierLimits(ctx, recipient.Tier)
+	if err != nil {
+		return err
+	}
+
+	maxBalance, err := parseLimit(recipientLimits.MaxBalance, decimals)
+	if err != nil {
+		return err
+	}
+	if maxBalance != nil && toUpdatedBalance.Cmp(maxBalance) > 0 {
+		return fmt.Errorf("recipient balance would exceed the maximum balance of %s for tier %s", formatAmount(maxBalance, decimals), recipient.Tier)
+	}
+
+	return nil
+}
+
+// checkSenderLimits enforces the tier limits of a registered account sending value.
+// largest is the largest single payment checked against the single transfer limit, total is added to the
+// daily outflow of the account, which is updated when the sheet is written. Unregistered senders, such as the minter,
+// are not bound by tier limits
+func checkSenderLimits(ctx contractapi.TransactionContextInterface, sheet *balanceSheet, from string, largest *big.Int, total *big.Int) error {
+
+	sender, err := readAccount(ctx, from)
+	if err != nil {
+		return err
+	}
+	if sender == nil {
+		return nil
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	senderLimits, err := readTierLimits(ctx, sender.Tier)
+	if err != nil {
+		return err
+	}
+
+	maxTransfer, err := parseLimit(senderLimits.MaxTransfer, decimals)
+	if err != nil {
+		return err
+	}
+	if maxTransfer != nil && largest.Cmp(maxTransfer) > 0 {
+		return fmt.Errorf("transfer of %s exceeds the single transfer limit of %s for tier %s", formatAmount(largest, decimals), formatAmount(maxTransfer, decimals), sender.Tier)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	outflowKey, err := compositeKey(ctx, outflowPrefix, from, now.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	outflow, _, err := readAccountAmount(ctx, from, outflowKey)
+	if err != nil {
+		return err
+	}
+	outflow.Add(outflow, total)
+
+	maxDailyOutflow, err := parseLimit(senderLimits.MaxDailyOutflow, decimals)
+	if err != nil {
+		return err
+	}
+	if maxDailyOutflow != nil && outflow.Cmp(maxDailyOutflow) > 0 {
+		return fmt.Errorf("transfer of %s exceeds the daily outflow limit of %s for tier %s", formatAmount(total, decimals), formatAmount(maxDailyOutflow, decimals), sender.Tier)
+	}
+
+	sheet.onWrite(func() error {
+		return putAccountAmount(ctx, from, outflowKey, outflow)
+	})
+
+	return nil
+}
+
+// readAccount returns the KYC registration of an account, or nil when it is not registered
+func readAccount(ctx contractapi.TransactionContextInterface, account string) (*Account, error) {
+	key, err := compositeKey(ctx, accountPrefix, account)
+	if err != nil {
+		return nil, err
+	}
+
+	accountBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account %s from world state: %v", account, err)
+	}
+	if accountBytes == nil {
+		return nil, nil
+	}
+
+	registered := new(Account)
+	err = json.Unmarshal(accountBytes, registered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode account %s: %v", account, err)
+	}
+
+	return registered, nil
+}
+
+// putAccount stores the KYC registration of an account
+func putAccount(ctx contractapi.TransactionContextInterface, registered *Account) error {
+	key, err := compositeKey(ctx, accountPrefix, registered.ID)
+	if err != nil {
+		return err
+	}
+
+	accountJSON, err := json.Marshal(registered)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, accountJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update account %s: %v", registered.ID, err)
+	}
+
+	return nil
+}
+
+// requireServicedAccount returns the registration of an account serviced by the calling bank
+func requireServicedAccount(ctx contractapi.TransactionContextInterface, account string) (*Account, error) {
+	registered, err := readAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if registered == nil {
+		return nil, fmt.Errorf("account %s is not registered", account)
+	}
+
+	bank, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if registered.Bank != bank {
+		return nil, fmt.Errorf("account %s is serviced by %s, not by %s", account, registered.Bank, bank)
+	}
+
+	return registered, nil
+}
+
+// readTierLimits returns the limits of a tier, a tier without configured limits has none
+func readTierLimits(ctx contractapi.TransactionContextInterface, tier string) (*TierLimits, error) {
+	key, err := compositeKey(ctx, tierLimitsPrefix, tier)
+	if err != nil {
+		return nil, err
+	}
+
+	limitsBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read limits of tier %s from world state: %v", tier, err)
+	}
+
+	limits := &TierLimits{Tier: tier}
+	if limitsBytes == nil {
+		return limits, nil
+	}
+
+	err = json.Unmarshal(limitsBytes, limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode limits of tier %s: %v", tier, err)
+	}
+
+	return limits, nil
+}
+
+// parseLimit converts a configured limit to base units, nil means the limit is not enforced
+func parseLimit(limit string, decimals int) (*big.Int, error) {
+	if limit == "" {
+		return nil, nil
+	}
+
+	return parseAmount(limit, decimals)
+}
+
+func validateTier(tier string) error {
+	for _, known := range knownTiers {
+		if tier == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown tier %s, expected one of %s", tier, strings.Join(knownTiers, ", "))
+}
+
+// emitAccountEvent emits an account registry event
+func emitAccountEvent(ctx contractapi.TransactionContextInterface, name string, e accountEvent) error {
+	eventJSON, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package chaincode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegisterAccount(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull)
+
+	// Unregistered recipients cannot receive tokens
+	mustFail(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "10"))
+
+	// Only a licensed bank can register accounts
+	mustFail(t, contract.RegisterAccount(ledger.as(commercial, "Org1MSP"), customer, TierBasic))
+
+	ledger.registerAccounts(contract, TierBasic, customer)
+	if name := ledger.lastEvent(); name != "AccountRegistered" {
+		t.Fatalf("expected AccountRegistered event, got %q", name)
+	}
+	mustFail(t, contract.RegisterAccount(ledger.as(commercial, "Org1MSP"), customer, TierFull))
+	mustFail(t, contract.RegisterAccount(ledger.as(commercial, "Org1MSP"), commercial, "premium"))
+
+	account, err := contract.GetAccount(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if account.Tier != TierBasic || account.Bank != "Org1MSP" {
+		t.Fatalf("unexpected account registration %+v", account)
+	}
+
+	// Another bank cannot change the tier of an account it does not service
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleBank, MemberTypeMSP, "Org3MSP"))
+	mustFail(t, contract.UpdateAccountTier(ledger.as(commercial, "Org3MSP"), customer, TierFull))
+	mustSucceed(t, contract.UpdateAccountTier(ledger.as(commercial, "Org1MSP"), customer, TierFull))
+
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "10"))
+}
+
+func TestTierLimits(t *testing.T) {
+	ledger, contract := newInitializedLedger(t)
+	mustSucceed(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "5000", Check{}))
+	ledger.registerAccounts(contract, TierBasic, customer)
+	ledger.registerAccounts(contract, TierFull, commercial)
+
+	mustFail(t, contract.SetTierLimits(ledger.as(commercial, "Org1MSP"), TierBasic, "1000", "500", "800"))
+	mustFail(t, contract.SetTierLimits(ledger.as(centralBank, "Org2MSP"), TierBasic, "1000.001", "", ""))
+	mustSucceed(t, contract.SetTierLimits(ledger.as(centralBank, "Org2MSP"), TierBasic, "1000", "500", "800"))
+
+	limits, err := contract.GetTierLimits(ledger.as(customer, "Org1MSP"), TierBasic)
+	mustSucceed(t, err)
+	if limits.MaxTransfer != "500" {
+		t.Fatalf("expected transfer limit 500, got %q", limits.MaxTransfer)
+	}
+
+	// Maximum balance of the recipient tier
+	err = contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "1000.01")
+	if err == nil || !strings.Contains(err.Error(), "maximum balance of 1000.00 for tier basic") {
+		t.Fatalf("expected maximum balance error, got %v", err)
+	}
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "1000"))
+
+	// Single transfer limit of the sender tier
+	err = contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "600")
+	if err == nil || !strings.Contains(err.Error(), "exceeds the single transfer limit of 500.00 for tier basic") {
+		t.Fatalf("expected single transfer limit error, got %v", err)
+	}
+
+	// Daily outflow limit of the sender tier
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "500"))
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "300"))
+	err = contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "0.01")
+	if err == nil || !strings.Contains(err.Error(), "daily outflow limit of 800.00") {
+		t.Fatalf("expected daily outflow limit error, got %v", err)
+	}
+}
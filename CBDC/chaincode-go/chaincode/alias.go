@@ -0,0 +1,477 @@
+package chaincode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the kinds of aliases an account can be reached by
+const (
+	AliasPhone  = "phone"
+	AliasEmail  = "email"
+	AliasHandle = "handle"
+)
+
+// Define objectType names for prefix
+const (
+	aliasPrefix        = "alias"
+	accountAliasPrefix = "accountAlias"
+)
+
+// Define key names for options
+const (
+	aliasSaltField     = "aliasSalt"
+	aliasSaltTransient = "aliasSalt"
+)
+
+// aliasCollection is the private data collection holding the salt of the alias directory. Only the central bank
+// is a member of it, so alias operations are endorsed by its peers and no other organization can hash aliases
+const aliasCollection = "aliases"
+
+var knownAliasTypes = []string{AliasPhone, AliasEmail, AliasHandle}
+
+// AliasRecord maps the salted hash of an alias to the account it resolves to.
+// The alias itself is never stored and the salt is kept in the alias collection, so world state can't be read
+// as a directory of phone numbers and emails
+type AliasRecord struct {
+	Hash         string    `json:"hash"`
+	Type         string    `json:"type"`
+	Account      string    `json:"account"`
+	Bank         string    `json:"bank"`
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+// SetAliasSalt sets the secret salt aliases are hashed with. The salt is passed in the transient field "aliasSalt"
+// so that it never reaches the channel ledger. It can only be set once, as changing it would orphan every alias
+// This function triggers an AliasSaltSet event
+func (s *Erc20Contract) SetAliasSalt(ctx contractapi.TransactionContextInterface) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set the alias salt: %v", err)
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get transient data: %v", err)
+	}
+	salt := transient[aliasSaltTransient]
+	if len(salt) < minSaltSeedLength {
+		return fmt.Errorf("transient field %q must hold a salt of at least %d bytes", aliasSaltTransient, minSaltSeedLength)
+	}
+
+	existing, err := readAliasSalt(ctx)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("alias salt is already set")
+	}
+
+	key, err := configKey(ctx, aliasSaltField)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutPrivateData(aliasCollection, key, salt)
+	if err != nil {
+		return fmt.Errorf("failed to set alias salt: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AliasSaltSet", []byte("{}"))
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("alias salt set")
+
+	return nil
+}
+
+// RegisterAlias makes an account reachable by a phone number, email or handle.
+// Only the servicing bank of the account can register aliases for it, and an alias resolves to one account only
+// param {String} aliasType One of phone, email or handle
+// param {String} alias The alias, e.g. "+375 29 123-45-67", compared after normalization
+// This function triggers an AliasRegistered event
+func (s *Erc20Contract) RegisterAlias(ctx contractapi.TransactionContextInterface, aliasType string, alias string, account string) error {
+
+	err := requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to register aliases: %v", err)
+	}
+
+	registered, err := requireServicedAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	hash, err := aliasHash(ctx, aliasType, alias)
+	if err != nil {
+		return err
+	}
+
+	existing, err := readAlias(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("%s alias is already registered", aliasType)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	record := &AliasRecord{hash, aliasType, account, registered.Bank, now}
+
+	err = putAlias(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	err = emitAliasEvent(ctx, "AliasRegistered", record)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%s alias %s registered for %s by %s", aliasType, hash, account, registered.Bank)
+
+	return nil
+}
+
+// ReassignAlias moves an alias to another account. The calling bank must service both accounts,
+// an alias moving to a customer of another bank has to be removed by the current bank first
+// This function triggers an AliasReassigned event
+func (s *Erc20Contract) ReassignAlias(ctx contractapi.TransactionContextInterface, aliasType string, alias string, account string) error {
+
+	err := requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to manage aliases: %v", err)
+	}
+
+	record, err := requireServicedAlias(ctx, aliasType, alias)
+	if err != nil {
+		return err
+	}
+	if record.Account == account {
+		return fmt.Errorf("%s alias already resolves to account %s", aliasType, account)
+	}
+
+	_, err = requireServicedAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	err = deleteAccountAlias(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	record.Account = account
+
+	err = putAlias(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	err = emitAliasEvent(ctx, "AliasReassigned", record)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%s alias %s reassigned to %s", aliasType, record.Hash, account)
+
+	return nil
+}
+
+// RemoveAlias removes an alias from the directory, only the servicing bank of the account it resolves to can remove it
+// This function triggers an AliasRemoved event
+func (s *Erc20Contract) RemoveAlias(ctx contractapi.TransactionContextInterface, aliasType string, alias string) error {
+
+	err := requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to manage aliases: %v", err)
+	}
+
+	record, err := requireServicedAlias(ctx, aliasType, alias)
+	if err != nil {
+		return err
+	}
+
+	key, err := compositeKey(ctx, aliasPrefix, record.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete alias %s: %v", record.Hash, err)
+	}
+
+	err = deleteAccountAlias(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	err = emitAliasEvent(ctx, "AliasRemoved", record)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%s alias %s of %s removed", aliasType, record.Hash, record.Account)
+
+	return nil
+}
+
+// ResolveAlias returns the directory entry of an alias, including the account ID it resolves to
+func (s *Erc20Contract) ResolveAlias(ctx contractapi.TransactionContextInterface, aliasType string, alias string) (*AliasRecord, error) {
+	return resolveAlias(ctx, aliasType, alias)
+}
+
+// GetAccountAliases returns the directory entries resolving to an account.
+// Only the account itself and its servicing bank can list them
+func (s *Erc20Contract) GetAccountAliases(ctx contractapi.TransactionContextInterface, account string) ([]AliasRecord, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != account {
+		_, err = requireServicedAccount(ctx, account)
+		if err != nil {
+			return nil, fmt.Errorf("client is not authorized to list the aliases of %s: %v", account, err)
+		}
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountAliasPrefix, []string{account})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read aliases of %s from world state: %v", account, err)
+	}
+	defer resultsIterator.Close()
+
+	records := []AliasRecord{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key %s: %v", queryResponse.Key, err)
+		}
+
+		record, err := readAlias(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+
+	return records, nil
+}
+
+// TransferToAlias transfers tokens from client account to the account an alias resolves to
+// param {String} amount The decimal amount to transfer, e.g. "125.50"
+// param {Remittance} remittance The memo, end-to-end reference and purpose code of the payment, all optional
+// This function triggers a Transfer event
+func (s *Erc20Contract) TransferToAlias(ctx contractapi.TransactionContextInterface, aliasType string, alias string, amount string, remittance Remittance) error {
+
+	record, err := resolveAlias(ctx, aliasType, alias)
+	if err != nil {
+		return err
+	}
+
+	return s.TransferWithRemittance(ctx, record.Account, amount, remittance)
+}
+
+// Helper Functions
+
+// normalizeAlias returns the canonical form of an alias, so that e.g. "+375 (29) 123-45-67" and "+375291234567"
+// are the same alias
+func normalizeAlias(aliasType string, alias string) (string, error) {
+	alias = strings.TrimSpace(alias)
+
+	switch aliasType {
+	case AliasPhone:
+		digits := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(alias)
+		if !strings.HasPrefix(digits, "+") || len(digits) < 8 || len(digits) > 16 || !isDigits(digits[1:]) {
+			return "", fmt.Errorf("phone alias must be an international number such as +375291234567")
+		}
+		return digits, nil
+	case AliasEmail:
+		email := strings.ToLower(alias)
+		at := strings.LastIndex(email, "@")
+		if at < 1 || at == len(email)-1 || strings.ContainsAny(email, " \t") || !strings.Contains(email[at:], ".") {
+			return "", fmt.Errorf("email alias %q is not a valid email address", alias)
+		}
+		return email, nil
+	case AliasHandle:
+		handle := strings.ToLower(strings.TrimPrefix(alias, "@"))
+		if len(handle) < 3 || len(handle) > 32 || strings.Trim(handle, "abcdefghijklmnopqrstuvwxyz0123456789_.-") != "" {
+			return "", fmt.Errorf("handle alias must be 3 to 32 letters, digits, dots, dashes or underscores")
+		}
+		return handle, nil
+	}
+
+	return "", fmt.Errorf("unknown alias type %s, must be one of %s", aliasType, strings.Join(knownAliasTypes, ", "))
+}
+
+// aliasHash returns the salted hash an alias is stored under. The salt is secret, so the hashes can't be
+// reversed by hashing every phone number or email
+func aliasHash(ctx contractapi.TransactionContextInterface, aliasType string, alias string) (string, error) {
+	normalized, err := normalizeAlias(aliasType, alias)
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := readAliasSalt(ctx)
+	if err != nil {
+		return "", err
+	}
+	if salt == nil {
+		return "", fmt.Errorf("alias salt is not set, call SetAliasSalt() first")
+	}
+
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(aliasType + "\n" + normalized))
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// readAliasSalt returns the salt of the alias directory, or nil when it is not set
+func readAliasSalt(ctx contractapi.TransactionContextInterface) ([]byte, error) {
+	key, err := configKey(ctx, aliasSaltField)
+	if err != nil {
+		return nil, err
+	}
+
+	salt, err := ctx.GetStub().GetPrivateData(aliasCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alias salt: %v", err)
+	}
+
+	return salt, nil
+}
+
+// resolveAlias returns the directory entry of an alias, or an error when it is not registered
+func resolveAlias(ctx contractapi.TransactionContextInterface, aliasType string, alias string) (*AliasRecord, error) {
+	hash, err := aliasHash(ctx, aliasType, alias)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := readAlias(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("%s alias is not registered", aliasType)
+	}
+
+	return record, nil
+}
+
+// requireServicedAlias returns the directory entry of an alias resolving to a customer of the calling bank
+func requireServicedAlias(ctx contractapi.TransactionContextInterface, aliasType string, alias string) (*AliasRecord, error) {
+	record, err := resolveAlias(ctx, aliasType, alias)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = requireServicedAccount(ctx, record.Account)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func readAlias(ctx contractapi.TransactionContextInterface, hash string) (*AliasRecord, error) {
+	key, err := compositeKey(ctx, aliasPrefix, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	recordBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alias %s from world state: %v", hash, err)
+	}
+	if recordBytes == nil {
+		return nil, nil
+	}
+
+	record := new(AliasRecord)
+	err = json.Unmarshal(recordBytes, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode alias %s: %v", hash, err)
+	}
+
+	return record, nil
+}
+
+// putAlias stores a directory entry and indexes it by the account it resolves to
+func putAlias(ctx contractapi.TransactionContextInterface, record *AliasRecord) error {
+	key, err := compositeKey(ctx, aliasPrefix, record.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = putJSON(ctx, key, record)
+	if err != nil {
+		return err
+	}
+
+	indexKey, err := compositeKey(ctx, accountAliasPrefix, record.Account, record.Hash)
+	if err != nil {
+		return err
+	}
+
+	// Only the key is needed for the index, value can't be empty so store a null byte
+	err = ctx.GetStub().PutState(indexKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to index alias %s: %v", record.Hash, err)
+	}
+
+	return nil
+}
+
+// deleteAccountAlias removes an alias from the index of the account it resolves to
+func deleteAccountAlias(ctx contractapi.TransactionContextInterface, record *AliasRecord) error {
+	indexKey, err := compositeKey(ctx, accountAliasPrefix, record.Account, record.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(indexKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete index of alias %s: %v", record.Hash, err)
+	}
+
+	return nil
+}
+
+// emitAliasEvent emits an alias directory event carrying the entry
+func emitAliasEvent(ctx contractapi.TransactionContextInterface, name string, record *AliasRecord) error {
+	eventJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
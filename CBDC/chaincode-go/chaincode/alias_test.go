@@ -0,0 +1,77 @@
+package chaincode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAliasDirectory(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial)
+
+	// Aliases can't be hashed before the central bank sets the secret salt, which is set only once
+	mustFail(t, contract.RegisterAlias(ledger.as(commercial, "Org1MSP"), AliasPhone, "+375 (29) 123-45-67", customer))
+	ledger.stub.TransientMap = map[string][]byte{aliasSaltTransient: []byte(strings.Repeat("s", minSaltSeedLength))}
+	mustFail(t, contract.SetAliasSalt(ledger.as(commercial, "Org1MSP")))
+	mustSucceed(t, contract.SetAliasSalt(ledger.as(centralBank, "Org2MSP")))
+	mustFail(t, contract.SetAliasSalt(ledger.as(centralBank, "Org2MSP")))
+	ledger.stub.TransientMap = nil
+
+	mustFail(t, contract.RegisterAlias(ledger.as(commercial, "Org1MSP"), AliasPhone, "29 123-45-67", customer))
+	mustFail(t, contract.RegisterAlias(ledger.as(commercial, "Org1MSP"), "iban", "BY00", customer))
+	mustSucceed(t, contract.RegisterAlias(ledger.as(commercial, "Org1MSP"), AliasPhone, "+375 (29) 123-45-67", customer))
+	if name := ledger.lastEvent(); name != "AliasRegistered" {
+		t.Fatalf("expected AliasRegistered event, got %q", name)
+	}
+	mustSucceed(t, contract.RegisterAlias(ledger.as(commercial, "Org1MSP"), AliasEmail, "Customer@Example.com", customer))
+	mustFail(t, contract.RegisterAlias(ledger.as(commercial, "Org1MSP"), AliasPhone, "+375291234567", commercial))
+
+	record, err := contract.ResolveAlias(ledger.as(centralBank, "Org2MSP"), AliasPhone, "+375291234567")
+	mustSucceed(t, err)
+	if record.Account != customer || record.Bank != "Org1MSP" {
+		t.Fatalf("unexpected alias %+v", record)
+	}
+	_, err = contract.ResolveAlias(ledger.as(centralBank, "Org2MSP"), AliasEmail, "someone@example.com")
+	mustFail(t, err)
+
+	mustSucceed(t, contract.TransferToAlias(ledger.as(centralBank, "Org2MSP"), AliasEmail, "customer@example.com", "25", Remittance{}))
+	balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if balance != "25.00" {
+		t.Fatalf("expected balance 25.00, got %s", balance)
+	}
+
+	aliases, err := contract.GetAccountAliases(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if len(aliases) != 2 {
+		t.Fatalf("expected 2 aliases, got %d", len(aliases))
+	}
+
+	// Another bank can't touch the aliases of customers it does not service
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleBank, MemberTypeMSP, "Org3MSP"))
+	mustFail(t, contract.RegisterAlias(ledger.as(commercial, "Org3MSP"), AliasHandle, "customer", customer))
+	mustFail(t, contract.ReassignAlias(ledger.as(commercial, "Org3MSP"), AliasPhone, "+375291234567", commercial))
+	mustFail(t, contract.RemoveAlias(ledger.as(commercial, "Org3MSP"), AliasPhone, "+375291234567"))
+	_, err = contract.GetAccountAliases(ledger.as(commercial, "Org3MSP"), customer)
+	mustFail(t, err)
+
+	mustSucceed(t, contract.ReassignAlias(ledger.as(commercial, "Org1MSP"), AliasPhone, "+375291234567", commercial))
+	if name := ledger.lastEvent(); name != "AliasReassigned" {
+		t.Fatalf("expected AliasReassigned event, got %q", name)
+	}
+	record, err = contract.ResolveAlias(ledger.as(centralBank, "Org2MSP"), AliasPhone, "+375291234567")
+	mustSucceed(t, err)
+	if record.Account != commercial {
+		t.Fatalf("expected alias to resolve to the new account, got %s", record.Account)
+	}
+
+	mustSucceed(t, contract.RemoveAlias(ledger.as(commercial, "Org1MSP"), AliasPhone, "+375291234567"))
+	_, err = contract.ResolveAlias(ledger.as(centralBank, "Org2MSP"), AliasPhone, "+375291234567")
+	mustFail(t, err)
+	mustFail(t, contract.TransferToAlias(ledger.as(centralBank, "Org2MSP"), AliasPhone, "+375291234567", "25", Remittance{}))
+
+	aliases, err = contract.GetAccountAliases(ledger.as(commercial, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if len(aliases) != 1 || aliases[0].Type != AliasEmail {
+		t.Fatalf("expected only the email alias to be left, got %+v", aliases)
+	}
+}
@@ -0,0 +1,90 @@
+package chaincode
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxDecimals limits the decimals a token can be initialized with
+const maxDecimals = 18
+
+// Helper Functions
+
+// readDecimals returns the decimals the token was initialized with
+func readDecimals(ctx contractapi.TransactionContextInterface) (int, error) {
+	key, err := metadataKey(ctx, decimalsField)
+	if err != nil {
+		return 0, err
+	}
+
+	decimalsBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token decimals: %v", err)
+	}
+
+	return parseDecimals(string(decimalsBytes))
+}
+
+// parseDecimals validates the decimals option of the token
+func parseDecimals(decimals string) (int, error) {
+	value, err := strconv.Atoi(decimals)
+	if err != nil || value < 0 || value > maxDecimals {
+		return 0, fmt.Errorf("decimals must be an integer between 0 and %d, got %q", maxDecimals, decimals)
+	}
+
+	return value, nil
+}
+
+// parseAmount converts a decimal string such as "125.50" into an integer number of the token's smallest unit.
+// Amounts must not be negative and must not have more fractional digits than the token decimals
+func parseAmount(value string, decimals int) (*big.Int, error) {
+	whole, fraction, hasPoint := value, "", false
+	if i := strings.Index(value, "."); i >= 0 {
+		whole, fraction, hasPoint = value[:i], value[i+1:], true
+	}
+	if whole == "" || (hasPoint && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return nil, fmt.Errorf("amount %q is not a valid decimal number", value)
+	}
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("amount %q has more than %d decimal places", value, decimals)
+	}
+
+	amount, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", decimals-len(fraction)), 10)
+	if !ok {
+		return nil, fmt.Errorf("amount %q is not a valid decimal number", value)
+	}
+
+	return amount, nil
+}
+
+// formatAmount converts an integer number of the token's smallest unit into a decimal string such as "125.50"
+func formatAmount(amount *big.Int, decimals int) string {
+	digits := new(big.Int).Abs(amount).String()
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	if decimals == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,90 @@
+package chaincode
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	valid := []struct {
+		value    string
+		decimals int
+		expected int64
+	}{
+		{"125.50", 2, 12550},
+		{"125.5", 2, 12550},
+		{"125", 2, 12500},
+		{"0.01", 2, 1},
+		{"0", 2, 0},
+		{"7", 0, 7},
+	}
+	for _, tc := range valid {
+		amount, err := parseAmount(tc.value, tc.decimals)
+		mustSucceed(t, err)
+		if amount.Cmp(big.NewInt(tc.expected)) != 0 {
+			t.Fatalf("parseAmount(%q, %d) = %s, expected %d", tc.value, tc.decimals, amount, tc.expected)
+		}
+	}
+
+	for _, value := range []string{"", ".", "1.", ".5", "-1", "+1", "1.234", "1e3", "1,5", " 1", "7.0x"} {
+		_, err := parseAmount(value, 2)
+		if err == nil {
+			t.Fatalf("expected parseAmount(%q) to fail", value)
+		}
+	}
+
+	_, err := parseAmount("1.5", 0)
+	mustFail(t, err)
+}
+
+func TestFormatAmount(t *testing.T) {
+	cases := []struct {
+		amount   int64
+		decimals int
+		expected string
+	}{
+		{12550, 2, "125.50"},
+		{1, 2, "0.01"},
+		{0, 2, "0.00"},
+		{-5, 2, "-0.05"},
+		{7, 0, "7"},
+	}
+	for _, tc := range cases {
+		if formatted := formatAmount(big.NewInt(tc.amount), tc.decimals); formatted != tc.expected {
+			t.Fatalf("formatAmount(%d, %d) = %q, expected %q", tc.amount, tc.decimals, formatted, tc.expected)
+		}
+	}
+
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	if formatted := formatAmount(huge, 2); formatted != "1234567890123456789012345678.90" {
+		t.Fatalf("unexpected formatting of a large amount: %s", formatted)
+	}
+}
+
+func TestMintAndTransferDecimalAmounts(t *testing.T) {
+	ledger, contract := newInitializedLedger(t)
+	ledger.registerAccounts(contract, TierFull, customer, commercial)
+
+	mustFail(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "10.001", Check{}))
+	mustSucceed(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "1000.25", Check{}))
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "125.50"))
+	mustFail(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "125.51"))
+
+	balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if balance != "125.50" {
+		t.Fatalf("expected balance 125.50, got %s", balance)
+	}
+
+	supply, err := contract.TotalSupply(ledger.as(customer, "Org1MSP"))
+	mustSucceed(t, err)
+	if supply != "1000.25" {
+		t.Fatalf("expected total supply 1000.25, got %s", supply)
+	}
+
+	decimals, err := contract.Decimals(ledger.as(customer, "Org1MSP"))
+	mustSucceed(t, err)
+	if decimals != 2 {
+		t.Fatalf("expected 2 decimals, got %d", decimals)
+	}
+}
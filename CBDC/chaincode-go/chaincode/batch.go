@@ -0,0 +1,157 @@
+package chaincode
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// defaultMaxBatchSize keeps a batch well within the Fabric transaction size limits until SetMaxBatchSize is called
+const defaultMaxBatchSize = 100
+
+// Define key names for options
+const maxBatchSizeField = "maxBatchSize"
+
+// BatchPayment is a single line of a TransferBatch
+type BatchPayment struct {
+	Recipient   string `json:"recipient"`
+	Amount      string `json:"amount"`
+	Memo        string `json:"memo,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	PurposeCode string `json:"purposeCode,omitempty"`
+}
+
+// batchEvent provides an organized struct for emitting the summary of a batch together with its lines
+type batchEvent struct {
+	From     string         `json:"from"`
+	Total    string         `json:"total"`
+	Count    int            `json:"count"`
+	Payments []BatchPayment `json:"payments"`
+	Legs     []transferLeg  `json:"legs,omitempty"`
+}
+
+// TransferBatch transfers tokens from client account to many recipient accounts in one transaction,
+// e.g. for payroll. The client account is debited once with the total of all lines, and either every line
+// is applied or, when any line fails, none of them
+// param {[]BatchPayment} payments The recipient, decimal amount and optional remittance data of every line.
+// Each line is recorded as a transfer of its own under the transaction ID followed by its line, e.g. "<txID>:2"
+// This function triggers a TransferBatch event
+func (s *Erc20Contract) TransferBatch(ctx contractapi.TransactionContextInterface, payments []BatchPayment) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	maxBatchSize, err := readConfigInt(ctx, maxBatchSizeField, defaultMaxBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(payments) == 0 {
+		return fmt.Errorf("batch must contain at least one payment")
+	}
+	if len(payments) > maxBatchSize {
+		return fmt.Errorf("batch of %d payments exceeds the maximum batch size of %d", len(payments), maxBatchSize)
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	total := new(big.Int)
+	payouts := make([]payout, len(payments))
+	lines := make([]BatchPayment, len(payments))
+	for i, payment := range payments {
+		value, err := parseAmount(payment.Amount, decimals)
+		if err != nil {
+			return fmt.Errorf("invalid amount in line %d: %v", i+1, err)
+		}
+
+		err = checkClientRecipient(payment.Recipient)
+		if err != nil {
+			return fmt.Errorf("invalid recipient in line %d: %v", i+1, err)
+		}
+
+		err = validateRemittance(ctx, batchRemittance(payment))
+		if err != nil {
+			return fmt.Errorf("invalid remittance in line %d: %v", i+1, err)
+		}
+
+		total.Add(total, value)
+		payouts[i] = payout{payment.Recipient, value}
+		lines[i] = BatchPayment{payment.Recipient, formatAmount(value, decimals), payment.Memo, payment.Reference, payment.PurposeCode}
+	}
+
+	legs, _, err := transferWithFees(ctx, FeeBatch, clientID, payouts)
+	if err != nil {
+		return fmt.Errorf("failed to transfer batch: %v", err)
+	}
+
+	// Every line is recorded as a payment of its own, so it can be found by reference, refunded and disputed
+	for i, line := range lines {
+		err = recordTransferAs(ctx, lineTxID(ctx.GetStub().GetTxID(), i+1), clientID, line.Recipient, payouts[i].value, batchRemittance(line))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Emit the TransferBatch event, Fabric keeps only one event per transaction so the lines are part of it.
+	// Lines paying registered accounts are found through the IDs they are recorded under
+	accounts := []string{clientID}
+	for _, line := range lines {
+		accounts = append(accounts, line.Recipient)
+	}
+	err = emitPaymentEvent(ctx, "TransferBatch", "", batchEvent{clientID, formatAmount(total, decimals), len(lines), lines, legs}, accounts...)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s transferred %s in a batch of %d payments", clientID, formatAmount(total, decimals), len(lines))
+
+	return nil
+}
+
+// batchRemittance returns the remittance data of a batch line
+func batchRemittance(payment BatchPayment) Remittance {
+	return Remittance{payment.Memo, payment.Reference, payment.PurposeCode}
+}
+
+// SetMaxBatchSize sets the maximum number of payments accepted by TransferBatch
+func (s *Erc20Contract) SetMaxBatchSize(ctx contractapi.TransactionContextInterface, size int) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set the maximum batch size: %v", err)
+	}
+
+	if size <= 0 {
+		return fmt.Errorf("maximum batch size must be positive")
+	}
+
+	err = putConfigInt(ctx, maxBatchSizeField, size)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("maximum batch size set to %d", size)
+
+	return nil
+}
+
+// GetMaxBatchSize returns the maximum number of payments accepted by TransferBatch
+func (s *Erc20Contract) GetMaxBatchSize(ctx contractapi.TransactionContextInterface) (int, error) {
+	return readConfigInt(ctx, maxBatchSizeField, defaultMaxBatchSize)
+}
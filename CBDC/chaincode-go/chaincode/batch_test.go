@@ -0,0 +1,52 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTransferBatch(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial, centralBank)
+
+	payroll := []BatchPayment{
+		{Recipient: customer, Amount: "100.50", Memo: "salary 05/2023", Reference: "PAYROLL-05"},
+		{Recipient: commercial, Amount: "200"},
+		{Recipient: customer, Amount: "50", Memo: "bonus", Reference: "PAYROLL-05"},
+	}
+	mustSucceed(t, contract.TransferBatch(ledger.as(centralBank, "Org2MSP"), payroll))
+	batchTxID := ledger.stub.TxID
+
+	// Parties and amounts of payments of registered accounts stay out of the public event
+	batchEventJSON := <-ledger.stub.ChaincodeEventsChannel
+	var emitted privateEvent
+	mustSucceed(t, json.Unmarshal(batchEventJSON.Payload, &emitted))
+	if batchEventJSON.EventName != "TransferBatch" || emitted != (privateEvent{TxID: batchTxID}) {
+		t.Fatalf("unexpected batch event %s %s", batchEventJSON.EventName, batchEventJSON.Payload)
+	}
+
+	for account, expected := range map[string]string{centralBank: "649.50", customer: "150.50", commercial: "200.00"} {
+		balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), account)
+		mustSucceed(t, err)
+		if balance != expected {
+			t.Fatalf("expected balance %s, got %s", expected, balance)
+		}
+	}
+
+	// Every line is recorded as a payment of its own
+	transfers, err := contract.GetTransfersByReference(ledger.as(customer, "Org1MSP"), "PAYROLL-05")
+	mustSucceed(t, err)
+	if len(transfers) != 2 || transfers[0].TxID != lineTxID(batchTxID, 1) || transfers[0].Value != "100.50" || transfers[0].Remittance.Memo != "salary 05/2023" {
+		t.Fatalf("unexpected transfers %+v", transfers)
+	}
+	mustSucceed(t, contract.RefundPayment(ledger.as(commercial, "Org1MSP"), lineTxID(batchTxID, 2), "20"))
+	mustFail(t, contract.RefundPayment(ledger.as(commercial, "Org1MSP"), lineTxID(batchTxID, 3), "20"))
+
+	// A failing line rejects the whole batch
+	mustFail(t, contract.TransferBatch(ledger.as(centralBank, "Org2MSP"), []BatchPayment{{Recipient: customer, Amount: "1"}, {Recipient: centralBank, Amount: "1"}}))
+	mustFail(t, contract.TransferBatch(ledger.as(centralBank, "Org2MSP"), []BatchPayment{{Recipient: customer, Amount: "1"}, {Recipient: commercial, Amount: "1000"}}))
+	mustFail(t, contract.TransferBatch(ledger.as(centralBank, "Org2MSP"), []BatchPayment{}))
+
+	mustFail(t, contract.SetMaxBatchSize(ledger.as(commercial, "Org1MSP"), 1))
+	mustSucceed(t, contract.SetMaxBatchSize(ledger.as(centralBank, "Org2MSP"), 1))
+	mustFail(t, contract.TransferBatch(ledger.as(centralBank, "Org2MSP"), payroll[:2]))
+}
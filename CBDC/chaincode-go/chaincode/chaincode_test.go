@@ -0,0 +1,221 @@
+package chaincode
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// Client IDs are base64 encoded x509 subjects, as returned by GetClientIdentity().GetID()
+var (
+	centralBank = clientID("CN=admin,OU=admin,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org2.example.com")
+	commercial  = clientID("CN=admin,OU=admin,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org1.example.com")
+	customer    = clientID("CN=user1,OU=client,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org1.example.com")
+)
+
+func clientID(subject string) string {
+	return base64.StdEncoding.EncodeToString([]byte("x509::" + subject))
+}
+
+// testIdentity is a minimal client identity used to submit transactions in tests
+type testIdentity struct {
+	id    string
+	mspID string
+}
+
+func (ti *testIdentity) GetID() (string, error) {
+	return ti.id, nil
+}
+
+func (ti *testIdentity) GetMSPID() (string, error) {
+	return ti.mspID, nil
+}
+
+func (ti *testIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (ti *testIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	return fmt.Errorf("attribute %s not found", attrName)
+}
+
+func (ti *testIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+// testStub adds the private data operations the mock stub does not implement
+type testStub struct {
+	*shimtest.MockStub
+}
+
+func (ts *testStub) GetPrivateDataByPartialCompositeKey(collection string, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := ts.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &testIterator{}
+	for key, value := range ts.PvtState[collection] {
+		if strings.HasPrefix(key, prefix) {
+			results.kvs = append(results.kvs, &queryresult.KV{Key: key, Value: value})
+		}
+	}
+	sort.Slice(results.kvs, func(i, j int) bool { return results.kvs[i].Key < results.kvs[j].Key })
+
+	return results, nil
+}
+
+func (ts *testStub) DelPrivateData(collection string, key string) error {
+	delete(ts.PvtState[collection], key)
+
+	return nil
+}
+
+// testIterator iterates over the results of a private data query of testStub
+type testIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (ti *testIterator) HasNext() bool {
+	return len(ti.kvs) > 0
+}
+
+func (ti *testIterator) Next() (*queryresult.KV, error) {
+	if len(ti.kvs) == 0 {
+		return nil, fmt.Errorf("no more results")
+	}
+	kv := ti.kvs[0]
+	ti.kvs = ti.kvs[1:]
+
+	return kv, nil
+}
+
+func (ti *testIterator) Close() error {
+	return nil
+}
+
+// testLedger shares one mock world state between the identities of a test
+type testLedger struct {
+	t    *testing.T
+	stub *testStub
+	txN  int
+	now  time.Time
+}
+
+func newTestLedger(t *testing.T) *testLedger {
+	return &testLedger{t: t, stub: &testStub{shimtest.NewMockStub("cbdc", nil)}, now: time.Date(2023, 5, 2, 9, 0, 0, 0, time.UTC)}
+}
+
+// advance moves the timestamp of the following transactions forward
+func (l *testLedger) advance(d time.Duration) {
+	l.now = l.now.Add(d)
+}
+
+// as returns a fresh transaction context submitted by the given client and MSP
+func (l *testLedger) as(clientID string, mspID string) *contractapi.TransactionContext {
+	l.txN++
+	l.stub.MockTransactionStart(fmt.Sprintf("tx%d", l.txN))
+	l.stub.TxTimestamp = &timestamp.Timestamp{Seconds: l.now.Unix(), Nanos: int32(l.now.Nanosecond())}
+	// drain events of earlier transactions, the mock stub channel is buffered
+	for len(l.stub.ChaincodeEventsChannel) > 0 {
+		<-l.stub.ChaincodeEventsChannel
+	}
+
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(l.stub)
+	ctx.SetClientIdentity(&testIdentity{clientID, mspID})
+
+	return ctx
+}
+
+// lastEvent returns the name of the last event emitted by the current transaction
+func (l *testLedger) lastEvent() string {
+	name := ""
+	for len(l.stub.ChaincodeEventsChannel) > 0 {
+		name = (<-l.stub.ChaincodeEventsChannel).EventName
+	}
+
+	return name
+}
+
+func mustSucceed(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func mustFail(t *testing.T, err error) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestChaincodeMetadata(t *testing.T) {
+	_, err := contractapi.NewChaincode(&Erc20Contract{}, &TeaContract{})
+	mustSucceed(t, err)
+}
+
+// registerAccounts registers accounts with the KYC registry on behalf of the Org1MSP bank,
+// which is granted the BANK role and sets its salt seed first
+func (l *testLedger) registerAccounts(contract *Erc20Contract, tier string, accounts ...string) {
+	l.t.Helper()
+
+	granted, err := contract.HasRole(l.as(centralBank, "Org2MSP"), RoleBank, MemberTypeMSP, "Org1MSP")
+	mustSucceed(l.t, err)
+	if !granted {
+		mustSucceed(l.t, contract.GrantRole(l.as(centralBank, "Org2MSP"), RoleBank, MemberTypeMSP, "Org1MSP"))
+		l.setSaltSeed(contract, commercial, "Org1MSP")
+	}
+
+	for _, account := range accounts {
+		mustSucceed(l.t, contract.RegisterAccount(l.as(commercial, "Org1MSP"), account, tier))
+	}
+}
+
+// newInitializedLedger returns a test ledger with the contract initialized by the central bank
+func newInitializedLedger(t *testing.T) (*testLedger, *Erc20Contract) {
+	t.Helper()
+
+	ledger := newTestLedger(t)
+	contract := new(Erc20Contract)
+
+	_, err := contract.Initialize(ledger.as(centralBank, "Org2MSP"), "Belarusian ruble", "CBR", "2")
+	mustSucceed(t, err)
+
+	return ledger, contract
+}
+
+// newFundedLedger returns an initialized test ledger with the accounts registered in the given tier
+// and 1000 minted to the central bank, which tests pay their accounts from
+func newFundedLedger(t *testing.T, tier string, accounts ...string) (*testLedger, *Erc20Contract) {
+	t.Helper()
+
+	ledger, contract := newInitializedLedger(t)
+	if len(accounts) > 0 {
+		ledger.registerAccounts(contract, tier, accounts...)
+	}
+	mustSucceed(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "1000", Check{}))
+
+	return ledger, contract
+}
+
+// setSaltSeed sets the salt seed of the collection of a bank, the client must belong to a bank with the BANK role
+func (l *testLedger) setSaltSeed(contract *Erc20Contract, clientID string, mspID string) {
+	l.t.Helper()
+
+	l.stub.TransientMap = map[string][]byte{saltSeedTransient: []byte(strings.Repeat(mspID, minSaltSeedLength))}
+	mustSucceed(l.t, contract.SetSaltSeed(l.as(clientID, mspID)))
+	l.stub.TransientMap = nil
+}
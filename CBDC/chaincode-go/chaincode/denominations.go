@@ -0,0 +1,765 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+// The primary denomination set by Initialize keeps the balance, allowance and supply prefixes,
+// every other denomination is kept under its own prefixes keyed by symbol
+const (
+	denominationPrefix          = "denomination"
+	denominationBalancePrefix   = "denomBalance"
+	denominationAllowancePrefix = "denomAllowance"
+	denominationSupplyPrefix    = "denomSupply"
+)
+
+// maxSymbolLength limits the length of denomination symbols
+const maxSymbolLength = 16
+
+// Denomination describes a token type held in the contract
+type Denomination struct {
+	Symbol       string    `json:"symbol"`
+	Name         string    `json:"name"`
+	Decimals     int       `json:"decimals"`
+	Primary      bool      `json:"primary"`
+	RegisteredBy string    `json:"registeredBy,omitempty"`
+	RegisteredAt time.Time `json:"registeredAt,omitempty"`
+}
+
+// denominationEvent provides an organized struct for emitting Transfer and Approval events of a denomination
+// Value is a decimal string such as "125.50"
+type denominationEvent struct {
+	Symbol string `json:"symbol"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Value  string `json:"value"`
+}
+
+// RegisterDenomination adds a token type to the contract next to the primary denomination set by Initialize
+// param {String} symbol The symbol of the denomination, e.g. "BYN-CBDC", upper case letters, digits and dashes
+// param {String} name The name of the denomination
+// param {String} decimals The decimals used for the denomination amounts, between 0 and 18
+// The registering MSP is granted the MINTER and BURNER roles of the denomination
+// This function triggers a DenominationRegistered event
+func (s *Erc20Contract) RegisterDenomination(ctx contractapi.TransactionContextInterface, symbol string, name string, decimals string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to register denominations: %v", err)
+	}
+
+	err = validateDenominationSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("denomination name must not be empty")
+	}
+
+	places, err := parseDecimals(decimals)
+	if err != nil {
+		return err
+	}
+
+	existing, err := findDenomination(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("denomination %s is already registered", symbol)
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	denomination := &Denomination{
+		Symbol:       symbol,
+		Name:         name,
+		Decimals:     places,
+		RegisteredBy: clientID,
+		RegisteredAt: now,
+	}
+
+	key, err := compositeKey(ctx, denominationPrefix, symbol)
+	if err != nil {
+		return err
+	}
+
+	err = putJSON(ctx, key, denomination)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range []string{RoleMinter, RoleBurner} {
+		err = putRoleMember(ctx, RoleMember{denominationRole(role, symbol), MemberTypeMSP, clientMSPID, clientID})
+		if err != nil {
+			return err
+		}
+	}
+
+	denominationJSON, err := json.Marshal(denomination)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("DenominationRegistered", denominationJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("denomination %s registered by %s", symbol, clientMSPID)
+
+	return nil
+}
+
+// GetDenomination returns the denomination registered under symbol, including the primary denomination
+func (s *Erc20Contract) GetDenomination(ctx contractapi.TransactionContextInterface, symbol string) (*Denomination, error) {
+	return readDenomination(ctx, symbol)
+}
+
+// ListDenominations returns every denomination of the contract, the primary denomination first
+func (s *Erc20Contract) ListDenominations(ctx contractapi.TransactionContextInterface) ([]Denomination, error) {
+
+	primary, err := readPrimaryDenomination(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(denominationPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read denominations from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	denominations := []Denomination{*primary}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var denomination Denomination
+		err = json.Unmarshal(queryResponse.Value, &denomination)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode denomination %s: %v", queryResponse.Key, err)
+		}
+		denominations = append(denominations, denomination)
+	}
+
+	return denominations, nil
+}
+
+// MintDenomination creates new tokens of a denomination and adds them to the minter's account balance
+// param {String} amount The decimal amount to mint, e.g. "125.50"
+// Minting the primary denomination is the same as Mint, other denominations require the MINTER:<symbol> role
+// and are blocked like Mint while an approval policy is set
+// This function triggers a Transfer event
+func (s *Erc20Contract) MintDenomination(ctx contractapi.TransactionContextInterface, symbol string, amount string) error {
+
+	denomination, err := readDenomination(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	if denomination.Primary {
+		return s.Mint(ctx, amount, Check{})
+	}
+
+	err = requireRole(ctx, denominationRole(RoleMinter, symbol))
+	if err != nil {
+		return fmt.Errorf("client is not authorized to mint %s: %v", symbol, err)
+	}
+
+	// Supply proposals only cover the primary denomination, so while an approval policy is set
+	// the supply of other denominations can't change
+	err = checkDirectSupplyChange(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	minter, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	mintAmount, err := parseAmount(amount, denomination.Decimals)
+	if err != nil {
+		return err
+	}
+	if mintAmount.Sign() <= 0 {
+		return fmt.Errorf("mint amount must be positive")
+	}
+
+	err = changeDenominationSupply(ctx, symbol, minter, mintAmount)
+	if err != nil {
+		return err
+	}
+
+	return emitDenominationEvent(ctx, "Transfer", denominationEvent{symbol, "0x0", minter, formatAmount(mintAmount, denomination.Decimals)})
+}
+
+// BurnDenomination redeems tokens of a denomination from the burner's account balance
+// param {String} amount The decimal amount to burn, e.g. "125.50"
+// Burning the primary denomination is the same as Burn, other denominations require the BURNER:<symbol> role
+// and are blocked like Burn while an approval policy is set
+// This function triggers a Transfer event
+func (s *Erc20Contract) BurnDenomination(ctx contractapi.TransactionContextInterface, symbol string, amount string) error {
+
+	denomination, err := readDenomination(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	if denomination.Primary {
+		return s.Burn(ctx, amount)
+	}
+
+	err = requireRole(ctx, denominationRole(RoleBurner, symbol))
+	if err != nil {
+		return fmt.Errorf("client is not authorized to burn %s: %v", symbol, err)
+	}
+
+	// Supply proposals only cover the primary denomination, so while an approval policy is set
+	// the supply of other denominations can't change
+	err = checkDirectSupplyChange(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	burner, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	burnAmount, err := parseAmount(amount, denomination.Decimals)
+	if err != nil {
+		return err
+	}
+	if burnAmount.Sign() <= 0 {
+		return fmt.Errorf("burn amount must be positive")
+	}
+
+	err = changeDenominationSupply(ctx, symbol, burner, new(big.Int).Neg(burnAmount))
+	if err != nil {
+		return err
+	}
+
+	return emitDenominationEvent(ctx, "Transfer", denominationEvent{symbol, burner, "0x0", formatAmount(burnAmount, denomination.Decimals)})
+}
+
+// TransferDenomination transfers tokens of a denomination from client account to recipient account
+// param {String} amount The decimal amount to transfer, e.g. "125.50"
+// This function triggers a Transfer event
+func (s *Erc20Contract) TransferDenomination(ctx contractapi.TransactionContextInterface, symbol string, recipient string, amount string) error {
+
+	denomination, err := readDenomination(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	if denomination.Primary {
+		return s.Transfer(ctx, recipient, amount)
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	value, err := parseAmount(amount, denomination.Decimals)
+	if err != nil {
+		return err
+	}
+
+	err = checkClientRecipient(recipient)
+	if err != nil {
+		return err
+	}
+
+	err = transferDenomination(ctx, symbol, clientID, recipient, value)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	return emitDenominationEvent(ctx, "Transfer", denominationEvent{symbol, clientID, recipient, formatAmount(value, denomination.Decimals)})
+}
+
+// ApproveDenomination allows the spender to withdraw tokens of a denomination from the calling client's account
+// param {String} value The decimal allowance, e.g. "125.50"
+// This function triggers an Approval event
+func (s *Erc20Contract) ApproveDenomination(ctx contractapi.TransactionContextInterface, symbol string, spender string, value string) error {
+
+	denomination, err := readDenomination(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	if denomination.Primary {
+		return s.Approve(ctx, spender, value)
+	}
+
+	err = checkNotPaused(ctx, PauseApprovals)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	owner, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	allowance, err := parseAmount(value, denomination.Decimals)
+	if err != nil {
+		return err
+	}
+
+	key, err := compositeKey(ctx, denominationAllowancePrefix, symbol, owner, spender)
+	if err != nil {
+		return err
+	}
+
+	err = putAccountAmount(ctx, owner, key, allowance)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s approved a withdrawal allowance of %s %s for spender %s", owner, formatAmount(allowance, denomination.Decimals), symbol, spender)
+
+	return emitDenominationEvent(ctx, "Approval", denominationEvent{symbol, owner, spender, formatAmount(allowance, denomination.Decimals)})
+}
+
+// AllowanceOfDenomination returns the amount of a denomination still available for the spender to withdraw from the owner
+func (s *Erc20Contract) AllowanceOfDenomination(ctx contractapi.TransactionContextInterface, symbol string, owner string, spender string) (string, error) {
+
+	denomination, err := readDenomination(ctx, symbol)
+	if err != nil {
+		return "", err
+	}
+	if denomination.Primary {
+		return s.Allowance(ctx, owner, spender)
+	}
+
+	allowance, err := readDenominationAllowance(ctx, symbol, owner, spender)
+	if err != nil {
+		return "", err
+	}
+
+	return formatAmount(allowance, denomination.Decimals), nil
+}
+
+// TransferFromDenomination transfers tokens of a denomination from the "from" address to the "to" address
+// out of the allowance the owner approved for the calling client
+// param {String} value The decimal amount to transfer, e.g. "125.50"
+// This function triggers a Transfer event
+func (s *Erc20Contract) TransferFromDenomination(ctx contractapi.TransactionContextInterface, symbol string, from string, to string, value string) error {
+
+	denomination, err := readDenomination(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	if denomination.Primary {
+		return s.TransferFrom(ctx, from, to, value)
+	}
+
+	// Get ID of submitting client identity
+	spender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	amount, err := parseAmount(value, denomination.Decimals)
+	if err != nil {
+		return err
+	}
+
+	// A frozen spender cannot move funds on behalf of others either
+	err = checkNotFrozen(ctx, spender, FreezeOut)
+	if err != nil {
+		return err
+	}
+
+	currentAllowance, err := readDenominationAllowance(ctx, symbol, from, spender)
+	if err != nil {
+		return err
+	}
+	if currentAllowance.Cmp(amount) < 0 {
+		return fmt.Errorf("spender does not have enough allowance for transfer")
+	}
+
+	err = checkClientRecipient(to)
+	if err != nil {
+		return err
+	}
+
+	err = transferDenomination(ctx, symbol, from, to, amount)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	key, err := compositeKey(ctx, denominationAllowancePrefix, symbol, from, spender)
+	if err != nil {
+		return err
+	}
+
+	err = putAccountAmount(ctx, from, key, new(big.Int).Sub(currentAllowance, amount))
+	if err != nil {
+		return err
+	}
+
+	return emitDenominationEvent(ctx, "Transfer", denominationEvent{symbol, from, to, formatAmount(amount, denomination.Decimals)})
+}
+
+// BalanceOfDenomination returns the balance of the given account in a denomination as a decimal string
+// Only the account itself, its bank and the central bank roles can read the balance of a registered account
+func (s *Erc20Contract) BalanceOfDenomination(ctx contractapi.TransactionContextInterface, symbol string, account string) (string, error) {
+
+	denomination, err := readDenomination(ctx, symbol)
+	if err != nil {
+		return "", err
+	}
+	if denomination.Primary {
+		return s.BalanceOf(ctx, account)
+	}
+
+	err = requireAccountReader(ctx, account)
+	if err != nil {
+		return "", err
+	}
+
+	balance, exists, err := readDenominationBalance(ctx, symbol, account)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("the account %s holds no %s", account, symbol)
+	}
+
+	return formatAmount(balance, denomination.Decimals), nil
+}
+
+// TotalSupplyOfDenomination returns the total supply of a denomination as a decimal string
+func (s *Erc20Contract) TotalSupplyOfDenomination(ctx contractapi.TransactionContextInterface, symbol string) (string, error) {
+
+	denomination, err := readDenomination(ctx, symbol)
+	if err != nil {
+		return "", err
+	}
+	if denomination.Primary {
+		return s.TotalSupply(ctx)
+	}
+
+	key, err := compositeKey(ctx, denominationSupplyPrefix, symbol)
+	if err != nil {
+		return "", err
+	}
+
+	totalSupply, _, err := readAmount(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve total supply of %s: %v", symbol, err)
+	}
+
+	return formatAmount(totalSupply, denomination.Decimals), nil
+}
+
+// Helper Functions
+
+// denominationRole returns the name of a role scoped to a single denomination, e.g. "MINTER:BYN-CBDC"
+func denominationRole(role string, symbol string) string {
+	return role + ":" + symbol
+}
+
+// isDenominationRole reports whether role was returned by denominationRole for a role that can be scoped
+func isDenominationRole(role string) bool {
+	parts := strings.SplitN(role, ":", 2)
+	if len(parts) != 2 || validateDenominationSymbol(parts[1]) != nil {
+		return false
+	}
+
+	return parts[0] == RoleMinter || parts[0] == RoleBurner
+}
+
+// validateDenominationSymbol checks a symbol is made of upper case letters, digits and dashes
+func validateDenominationSymbol(symbol string) error {
+	if symbol == "" || len(symbol) > maxSymbolLength {
+		return fmt.Errorf("denomination symbol must be between 1 and %d characters long", maxSymbolLength)
+	}
+	for _, c := range symbol {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+			return fmt.Errorf("denomination symbol %s may only contain upper case letters, digits and dashes", symbol)
+		}
+	}
+
+	return nil
+}
+
+// readPrimaryDenomination returns the denomination set by Initialize
+func readPrimaryDenomination(ctx contractapi.TransactionContextInterface) (*Denomination, error) {
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	denomination := &Denomination{Primary: true}
+	for _, option := range []struct {
+		field string
+		value *string
+	}{{nameField, &denomination.Name}, {symbolField, &denomination.Symbol}} {
+		key, err := metadataKey(ctx, option.field)
+		if err != nil {
+			return nil, err
+		}
+
+		bytes, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token %s: %v", option.field, err)
+		}
+		*option.value = string(bytes)
+	}
+
+	denomination.Decimals, err = readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return denomination, nil
+}
+
+// findDenomination returns the denomination registered under symbol, the primary denomination included,
+// or nil when there is none
+func findDenomination(ctx contractapi.TransactionContextInterface, symbol string) (*Denomination, error) {
+	primary, err := readPrimaryDenomination(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if symbol == primary.Symbol {
+		return primary, nil
+	}
+
+	key, err := compositeKey(ctx, denominationPrefix, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	denominationBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read denomination %s from world state: %v", symbol, err)
+	}
+	if denominationBytes == nil {
+		return nil, nil
+	}
+
+	denomination := new(Denomination)
+	err = json.Unmarshal(denominationBytes, denomination)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode denomination %s: %v", symbol, err)
+	}
+
+	return denomination, nil
+}
+
+// readDenomination returns the denomination registered under symbol and fails when there is none
+func readDenomination(ctx contractapi.TransactionContextInterface, symbol string) (*Denomination, error) {
+	denomination, err := findDenomination(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	if denomination == nil {
+		return nil, fmt.Errorf("denomination %s is not registered", symbol)
+	}
+
+	return denomination, nil
+}
+
+// readDenominationBalance returns the balance of an account in a denomination other than the primary one,
+// exists is false when the account has never held it
+func readDenominationBalance(ctx contractapi.TransactionContextInterface, symbol string, account string) (*big.Int, bool, error) {
+	key, err := compositeKey(ctx, denominationBalancePrefix, symbol, account)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return readAccountAmount(ctx, account, key)
+}
+
+// writeDenominationBalance stores the balance of an account in a denomination other than the primary one
+func writeDenominationBalance(ctx contractapi.TransactionContextInterface, symbol string, account string, balance *big.Int) error {
+	key, err := compositeKey(ctx, denominationBalancePrefix, symbol, account)
+	if err != nil {
+		return err
+	}
+
+	return putAccountAmount(ctx, account, key, balance)
+}
+
+// readDenominationAllowance returns the amount of a denomination the spender may still withdraw from the owner
+func readDenominationAllowance(ctx contractapi.TransactionContextInterface, symbol string, owner string, spender string) (*big.Int, error) {
+	key, err := compositeKey(ctx, denominationAllowancePrefix, symbol, owner, spender)
+	if err != nil {
+		return nil, err
+	}
+
+	allowance, _, err := readAccountAmount(ctx, owner, key)
+
+	return allowance, err
+}
+
+// changeDenominationSupply mints delta tokens of a denomination into account, or burns them from it when delta is negative
+func changeDenominationSupply(ctx contractapi.TransactionContextInterface, symbol string, account string, delta *big.Int) error {
+	direction := FreezeIn
+	if delta.Sign() < 0 {
+		direction = FreezeOut
+	}
+
+	err := checkNotFrozen(ctx, account, direction)
+	if err != nil {
+		return err
+	}
+
+	key, err := compositeKey(ctx, denominationSupplyPrefix, symbol)
+	if err != nil {
+		return err
+	}
+
+	totalSupply, _, err := readAmount(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve total supply of %s: %v", symbol, err)
+	}
+
+	sheet := newDenominationSheet(ctx, symbol)
+	err = sheet.add(account, delta)
+	if err != nil {
+		return err
+	}
+
+	sheet.onWrite(func() error {
+		return putAmount(ctx, key, totalSupply.Add(totalSupply, delta))
+	})
+
+	return sheet.write()
+}
+
+// transferDenomination transfers tokens of a denomination other than the primary one from the "from" address
+// to the "to" address. Tier limits are expressed in the primary denomination and don't apply,
+// but recipients still have to be registered by a licensed bank
+func transferDenomination(ctx contractapi.TransactionContextInterface, symbol string, from string, to string, value *big.Int) error {
+	if from == to {
+		return fmt.Errorf("cannot transfer to and from same client account")
+	}
+
+	if value.Sign() < 0 { // transfer of 0 is allowed in ERC-20, so just validate against negative amounts
+		return fmt.Errorf("transfer amount cannot be negative")
+	}
+
+	err := checkNotPaused(ctx, PauseTransfers)
+	if err != nil {
+		return err
+	}
+
+	err = checkNotFrozen(ctx, from, FreezeOut)
+	if err != nil {
+		return err
+	}
+
+	err = checkNotFrozen(ctx, to, FreezeIn)
+	if err != nil {
+		return err
+	}
+
+	if !isInternalAccount(to) {
+		recipient, err := readAccount(ctx, to)
+		if err != nil {
+			return err
+		}
+		if recipient == nil {
+			return fmt.Errorf("recipient account %s is not registered by a licensed bank", to)
+		}
+	}
+
+	sheet := newDenominationSheet(ctx, symbol)
+
+	_, exists, err := sheet.balance(from)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("client account %s has no %s balance", from, symbol)
+	}
+
+	err = sheet.add(from, new(big.Int).Neg(value))
+	if err != nil {
+		return err
+	}
+
+	err = sheet.add(to, value)
+	if err != nil {
+		return err
+	}
+
+	err = sheet.write()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s transferred %s %s to %s", from, value, symbol, to)
+
+	return nil
+}
+
+// emitDenominationEvent emits a Transfer or Approval event of a denomination,
+// masked like the events of the primary denomination when a registered account takes part
+func emitDenominationEvent(ctx contractapi.TransactionContextInterface, name string, e denominationEvent) error {
+	return emitPaymentEvent(ctx, name, "", e, e.From, e.To)
+}
+
+// transferSymbol transfers tokens of any denomination, the primary one going through transferHelper
+// Dependant functions include ProposeSwap and AcceptSwap
+func transferSymbol(ctx contractapi.TransactionContextInterface, denomination *Denomination, from string, to string, value *big.Int) error {
+	if denomination.Primary {
+		_, err := transferHelper(ctx, from, to, value)
+		return err
+	}
+
+	return transferDenomination(ctx, denomination.Symbol, from, to, value)
+}
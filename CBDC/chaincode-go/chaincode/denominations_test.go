@@ -0,0 +1,98 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDenominations(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial)
+
+	mustFail(t, contract.RegisterDenomination(ledger.as(commercial, "Org1MSP"), "WST", "Wholesale settlement token", "4"))
+	mustFail(t, contract.RegisterDenomination(ledger.as(centralBank, "Org2MSP"), "CBR", "Another ruble", "2"))
+	mustFail(t, contract.RegisterDenomination(ledger.as(centralBank, "Org2MSP"), "wst", "Wholesale settlement token", "4"))
+	mustSucceed(t, contract.RegisterDenomination(ledger.as(centralBank, "Org2MSP"), "WST", "Wholesale settlement token", "4"))
+	if name := ledger.lastEvent(); name != "DenominationRegistered" {
+		t.Fatalf("expected DenominationRegistered event, got %q", name)
+	}
+	mustFail(t, contract.RegisterDenomination(ledger.as(centralBank, "Org2MSP"), "WST", "Wholesale settlement token", "4"))
+
+	denominations, err := contract.ListDenominations(ledger.as(customer, "Org1MSP"))
+	mustSucceed(t, err)
+	if len(denominations) != 2 || !denominations[0].Primary || denominations[1].Symbol != "WST" || denominations[1].Decimals != 4 {
+		t.Fatalf("unexpected denominations %+v", denominations)
+	}
+
+	// Minter roles are granted per denomination
+	mustFail(t, contract.MintDenomination(ledger.as(commercial, "Org1MSP"), "WST", "10"))
+	mustFail(t, contract.MintDenomination(ledger.as(centralBank, "Org2MSP"), "XYZ", "10"))
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), denominationRole(RoleMinter, "WST"), MemberTypeClient, commercial))
+	mustSucceed(t, contract.MintDenomination(ledger.as(commercial, "Org1MSP"), "WST", "100.1234"))
+	mustSucceed(t, contract.MintDenomination(ledger.as(centralBank, "Org2MSP"), "WST", "50"))
+	mustFail(t, contract.MintDenomination(ledger.as(commercial, "Org1MSP"), "CBR", "10"))
+
+	ctx := ledger.as(commercial, "Org1MSP")
+	mustSucceed(t, contract.TransferDenomination(ctx, "WST", customer, "40"))
+
+	// Transfers between registered accounts only tell the transaction, like those of the primary denomination
+	transferEvent := <-ledger.stub.ChaincodeEventsChannel
+	var emitted privateEvent
+	mustSucceed(t, json.Unmarshal(transferEvent.Payload, &emitted))
+	if transferEvent.EventName != "Transfer" || emitted != (privateEvent{TxID: ctx.GetStub().GetTxID()}) {
+		t.Fatalf("unexpected Transfer event %s", transferEvent.Payload)
+	}
+	mustFail(t, contract.TransferDenomination(ledger.as(customer, "Org1MSP"), "WST", commercial, "40.0001"))
+	mustSucceed(t, contract.TransferDenomination(ledger.as(centralBank, "Org2MSP"), "CBR", commercial, "10"))
+
+	// Allowances are kept apart per denomination
+	mustSucceed(t, contract.ApproveDenomination(ledger.as(customer, "Org1MSP"), "WST", commercial, "15"))
+	allowance, err := contract.AllowanceOfDenomination(ledger.as(customer, "Org1MSP"), "CBR", customer, commercial)
+	mustSucceed(t, err)
+	if allowance != "0.00" {
+		t.Fatalf("expected no CBR allowance, got %s", allowance)
+	}
+	mustFail(t, contract.TransferFromDenomination(ledger.as(commercial, "Org1MSP"), "WST", customer, commercial, "20"))
+	mustSucceed(t, contract.TransferFromDenomination(ledger.as(commercial, "Org1MSP"), "WST", customer, commercial, "15"))
+
+	mustSucceed(t, contract.BurnDenomination(ledger.as(centralBank, "Org2MSP"), "WST", "20"))
+
+	// An approval policy stops a single minter from changing the supply of any denomination
+	mustSucceed(t, contract.SetApprovalPolicy(ledger.as(centralBank, "Org2MSP"), []string{"Org1MSP", "Org3MSP"}, 2, 3600))
+	mustFail(t, contract.MintDenomination(ledger.as(centralBank, "Org2MSP"), "WST", "10"))
+	mustFail(t, contract.BurnDenomination(ledger.as(centralBank, "Org2MSP"), "WST", "10"))
+	mustFail(t, contract.BurnDenomination(ledger.as(centralBank, "Org2MSP"), "WST", "40"))
+
+	expected := []struct {
+		symbol  string
+		account string
+		balance string
+	}{
+		{"WST", commercial, "75.1234"},
+		{"WST", customer, "25.0000"},
+		{"WST", centralBank, "30.0000"},
+		{"CBR", commercial, "10.00"},
+		{"CBR", centralBank, "990.00"},
+	}
+	for _, e := range expected {
+		balance, err := contract.BalanceOfDenomination(ledger.as(centralBank, "Org2MSP"), e.symbol, e.account)
+		mustSucceed(t, err)
+		if balance != e.balance {
+			t.Fatalf("expected %s balance %s, got %s", e.symbol, e.balance, balance)
+		}
+	}
+
+	other := clientID("CN=user1,OU=client,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org3.example.com")
+	_, err = contract.BalanceOfDenomination(ledger.as(other, "Org3MSP"), "WST", customer)
+	mustFail(t, err)
+
+	supply, err := contract.TotalSupplyOfDenomination(ledger.as(centralBank, "Org2MSP"), "WST")
+	mustSucceed(t, err)
+	if supply != "130.1234" {
+		t.Fatalf("expected WST supply 130.1234, got %s", supply)
+	}
+	supply, err = contract.TotalSupply(ledger.as(centralBank, "Org2MSP"))
+	mustSucceed(t, err)
+	if supply != "1000.00" {
+		t.Fatalf("expected CBR supply 1000.00, got %s", supply)
+	}
+}
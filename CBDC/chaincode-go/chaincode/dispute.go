@@ -0,0 +1,576 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the statuses of a dispute
+const (
+	DisputeOpen     = "open"
+	DisputeRefunded = "refunded"
+	DisputeReleased = "released"
+)
+
+// Define the parties a dispute can be resolved in favour of
+const (
+	FavourPayer    = "payer"
+	FavourMerchant = "merchant"
+)
+
+// Define objectType names for prefix
+const (
+	disputePrefix  = "dispute"
+	refundedPrefix = "refunded"
+)
+
+// defaultDisputeHoldBps holds the whole disputed amount until SetDisputeHold is called
+const defaultDisputeHoldBps = 10000
+
+// defaultDisputeWindowDays is the number of days a transfer can be disputed until SetDisputeWindow is called
+const defaultDisputeWindowDays = 120
+
+// Define key names for options
+const (
+	disputeHoldField   = "disputeHoldBps"
+	disputeWindowField = "disputeWindowDays"
+)
+
+// Dispute is a claim of the payer of a transfer against the merchant it paid, keyed by the transaction ID of the transfer.
+// Held is the part of the balance of the merchant set aside until an arbitrator resolves the dispute
+type Dispute struct {
+	ID         string    `json:"id"`
+	Payer      string    `json:"payer"`
+	Merchant   string    `json:"merchant"`
+	Amount     string    `json:"amount"`
+	Held       string    `json:"held"`
+	Reason     string    `json:"reason"`
+	Status     string    `json:"status"`
+	Arbitrator string    `json:"arbitrator,omitempty"`
+	Resolution string    `json:"resolution,omitempty"`
+	Escrow     string    `json:"escrow,omitempty"`
+	OpenedAt   time.Time `json:"openedAt"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+// refundEvent provides an organized struct for emitting a refund linked to its original transfer
+type refundEvent struct {
+	OriginalTxID string `json:"originalTxID"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Value        string `json:"value"`
+	Refunded     string `json:"refunded"`
+}
+
+// RefundPayment lets the recipient of a transfer pay part or all of it back to the payer.
+// Refunds of a transfer can't add up to more than its value
+// param {String} originalTxID The transaction ID of the transfer being refunded
+// param {String} amount The decimal amount to refund, e.g. "125.50"
+// This function triggers a TransferRefunded event
+func (s *Erc20Contract) RefundPayment(ctx contractapi.TransactionContextInterface, originalTxID string, amount string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	record, err := readTransfer(ctx, originalTxID)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("transfer %s does not exist", originalTxID)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if record.To != clientID {
+		return fmt.Errorf("transfer %s was not received by the client", originalTxID)
+	}
+
+	dispute, err := readDispute(ctx, originalTxID)
+	if err != nil {
+		return err
+	}
+	if dispute != nil && dispute.Status == DisputeOpen {
+		return fmt.Errorf("transfer %s is disputed, it is settled by the arbitrator", originalTxID)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("refund amount must be positive")
+	}
+
+	refundable, refunded, err := readRefundable(ctx, record, decimals)
+	if err != nil {
+		return err
+	}
+	if value.Cmp(refundable) > 0 {
+		return fmt.Errorf("only %s of transfer %s can still be refunded", formatAmount(refundable, decimals), originalTxID)
+	}
+
+	_, err = transferHelper(ctx, clientID, record.From, value)
+	if err != nil {
+		return fmt.Errorf("failed to refund transfer: %v", err)
+	}
+
+	err = addRefunded(ctx, originalTxID, refunded, value, record.From, record.To)
+	if err != nil {
+		return err
+	}
+
+	err = recordTransfer(ctx, clientID, record.From, value, Remittance{Memo: "Refund of " + originalTxID})
+	if err != nil {
+		return err
+	}
+
+	err = emitPaymentEvent(ctx, "TransferRefunded", originalTxID, refundEvent{originalTxID, clientID, record.From, formatAmount(value, decimals), formatAmount(refunded, decimals)}, clientID, record.From)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s refunded %s of transfer %s", clientID, formatAmount(value, decimals), originalTxID)
+
+	return nil
+}
+
+// OpenDispute lets the payer of a transfer dispute it within the window set by SetDisputeWindow. The part of the
+// not yet refunded amount set by SetDisputeHold is moved from the balance of the merchant to a hold,
+// as far as the balance covers it. Merchants frozen for outgoing funds can't have funds held
+// param {String} originalTxID The transaction ID of the disputed transfer
+// This function triggers a DisputeOpened event
+func (s *Erc20Contract) OpenDispute(ctx contractapi.TransactionContextInterface, originalTxID string, reason string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = checkNotPaused(ctx, PauseTransfers)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("reason must not be empty")
+	}
+
+	record, err := readTransfer(ctx, originalTxID)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("transfer %s does not exist", originalTxID)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if record.From != clientID {
+		return fmt.Errorf("transfer %s was not paid by the client", originalTxID)
+	}
+
+	windowDays, err := readConfigInt(ctx, disputeWindowField, defaultDisputeWindowDays)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if deadline := record.Timestamp.AddDate(0, 0, windowDays); now.After(deadline) {
+		return fmt.Errorf("transfer %s could only be disputed until %s", originalTxID, deadline)
+	}
+
+	err = checkNotFrozen(ctx, record.To, FreezeOut)
+	if err != nil {
+		return err
+	}
+
+	existing, err := readDispute(ctx, originalTxID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("transfer %s was already disputed", originalTxID)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	disputed, _, err := readRefundable(ctx, record, decimals)
+	if err != nil {
+		return err
+	}
+	if disputed.Sign() == 0 {
+		return fmt.Errorf("transfer %s was refunded in full", originalTxID)
+	}
+
+	holdBps, err := readConfigInt(ctx, disputeHoldField, defaultDisputeHoldBps)
+	if err != nil {
+		return err
+	}
+
+	held := new(big.Int).Mul(disputed, big.NewInt(int64(holdBps)))
+	held.Quo(held, basisPoints)
+
+	// The merchant may have spent the payment, only what is left can be held
+	sheet := newBalanceSheet(ctx)
+	balance, _, err := sheet.balance(record.To)
+	if err != nil {
+		return err
+	}
+	if held.Cmp(balance) > 0 {
+		held.Set(balance)
+	}
+
+	escrow, err := escrowAccount(ctx, disputePrefix, originalTxID, record.To)
+	if err != nil {
+		return err
+	}
+
+	err = moveHeldFunds(sheet, record.To, escrow, held)
+	if err != nil {
+		return err
+	}
+
+	dispute := &Dispute{
+		ID:       originalTxID,
+		Payer:    record.From,
+		Merchant: record.To,
+		Amount:   formatAmount(disputed, decimals),
+		Held:     formatAmount(held, decimals),
+		Reason:   reason,
+		Status:   DisputeOpen,
+		Escrow:   escrow,
+		OpenedAt: now,
+	}
+
+	err = putDispute(ctx, dispute)
+	if err != nil {
+		return err
+	}
+
+	err = emitDisputeEvent(ctx, "DisputeOpened", dispute)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s disputed transfer %s, %s held from %s", clientID, originalTxID, dispute.Held, record.To)
+
+	return nil
+}
+
+// ResolveDispute closes an open dispute. In favour of the payer the held funds are paid to the payer like a transfer,
+// bound by the freezes, tier limits and waterfall of the payer. In favour of the merchant they are released to the merchant
+// param {String} inFavourOf Either "payer" or "merchant"
+// param {String} resolution The reasoning of the arbitrator
+// This function triggers a DisputeResolved event
+func (s *Erc20Contract) ResolveDispute(ctx contractapi.TransactionContextInterface, originalTxID string, inFavourOf string, resolution string) error {
+
+	err := requireRole(ctx, RoleArbitrator)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to resolve disputes: %v", err)
+	}
+
+	err = checkNotPaused(ctx, PauseTransfers)
+	if err != nil {
+		return err
+	}
+
+	dispute, err := readDispute(ctx, originalTxID)
+	if err != nil {
+		return err
+	}
+	if dispute == nil {
+		return fmt.Errorf("transfer %s is not disputed", originalTxID)
+	}
+	if dispute.Status != DisputeOpen {
+		return fmt.Errorf("dispute of transfer %s is %s", originalTxID, dispute.Status)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	held, err := parseAmount(dispute.Held, decimals)
+	if err != nil {
+		return err
+	}
+
+	switch inFavourOf {
+	case FavourPayer:
+		dispute.Status = DisputeRefunded
+		if held.Sign() > 0 {
+			_, err = transferHelper(ctx, disputeEscrow(dispute), dispute.Payer, held)
+			if err != nil {
+				return fmt.Errorf("failed to pay the held funds to the payer: %v", err)
+			}
+		}
+	case FavourMerchant:
+		dispute.Status = DisputeReleased
+		err = moveHeldFunds(newBalanceSheet(ctx), disputeEscrow(dispute), dispute.Merchant, held)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("disputes are resolved in favour of %s or %s", FavourPayer, FavourMerchant)
+	}
+
+	if inFavourOf == FavourPayer {
+		refunded, err := readRefunded(ctx, originalTxID)
+		if err != nil {
+			return err
+		}
+
+		err = addRefunded(ctx, originalTxID, refunded, held, dispute.Payer, dispute.Merchant)
+		if err != nil {
+			return err
+		}
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	dispute.Arbitrator = clientID
+	dispute.Resolution = resolution
+	dispute.ResolvedAt = now
+
+	err = putDispute(ctx, dispute)
+	if err != nil {
+		return err
+	}
+
+	err = emitDisputeEvent(ctx, "DisputeResolved", dispute)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("dispute of transfer %s resolved in favour of the %s by %s", originalTxID, inFavourOf, clientID)
+
+	return nil
+}
+
+// GetDispute returns the dispute of a transfer, only its parties, arbitrators and the auditing roles can read it
+func (s *Erc20Contract) GetDispute(ctx contractapi.TransactionContextInterface, originalTxID string) (*Dispute, error) {
+
+	dispute, err := readDispute(ctx, originalTxID)
+	if err != nil {
+		return nil, err
+	}
+	if dispute == nil {
+		return nil, fmt.Errorf("transfer %s is not disputed", originalTxID)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != dispute.Payer && clientID != dispute.Merchant {
+		err = requireRole(ctx, RoleArbitrator, RoleAuditor, RoleRegulator)
+		if err != nil {
+			return nil, fmt.Errorf("client is not authorized to read the dispute of transfer %s: %v", originalTxID, err)
+		}
+	}
+
+	return dispute, nil
+}
+
+// SetDisputeHold sets the part of a disputed amount that is held from the merchant, in basis points
+func (s *Erc20Contract) SetDisputeHold(ctx contractapi.TransactionContextInterface, holdBps int) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set the dispute hold: %v", err)
+	}
+
+	if holdBps < 0 || holdBps > 10000 {
+		return fmt.Errorf("dispute hold must be between 0 and 10000 basis points")
+	}
+
+	err = putConfigInt(ctx, disputeHoldField, holdBps)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("dispute hold set to %d basis points", holdBps)
+
+	return nil
+}
+
+// SetDisputeWindow sets the number of days after a transfer during which its payer can dispute it
+func (s *Erc20Contract) SetDisputeWindow(ctx contractapi.TransactionContextInterface, days int) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set the dispute window: %v", err)
+	}
+
+	if days <= 0 {
+		return fmt.Errorf("dispute window must be positive")
+	}
+
+	err = putConfigInt(ctx, disputeWindowField, days)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("dispute window set to %d days", days)
+
+	return nil
+}
+
+// Helper Functions
+
+// disputeEscrow returns the account holding the funds of a merchant held for a dispute
+func disputeEscrow(dispute *Dispute) string {
+	if dispute.Escrow == "" {
+		return internalAccount(disputePrefix, dispute.ID)
+	}
+
+	return dispute.Escrow
+}
+
+// moveHeldFunds moves funds between an account and a hold of its own funds. The funds never leave
+// their holder, so the tier limits and incoming freezes that apply to transfers don't apply to them
+func moveHeldFunds(sheet *balanceSheet, from string, to string, value *big.Int) error {
+	err := sheet.add(from, new(big.Int).Neg(value))
+	if err != nil {
+		return err
+	}
+
+	err = sheet.add(to, value)
+	if err != nil {
+		return err
+	}
+
+	return sheet.write()
+}
+
+// readRefundable returns the part of a transfer that was not refunded yet, and the part that was
+func readRefundable(ctx contractapi.TransactionContextInterface, record *TransferRecord, decimals int) (*big.Int, *big.Int, error) {
+	refunded, err := readRefunded(ctx, record.TxID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value, err := parseAmount(record.Value, decimals)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return value.Sub(value, refunded), refunded, nil
+}
+
+// readRefunded returns the part of a transfer that was refunded or charged back
+func readRefunded(ctx contractapi.TransactionContextInterface, originalTxID string) (*big.Int, error) {
+	key, err := compositeKey(ctx, refundedPrefix, originalTxID)
+	if err != nil {
+		return nil, err
+	}
+
+	refundedBytes, err := readRecord(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	refunded, _, err := decodeAmount(key, refundedBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return refunded, nil
+}
+
+// addRefunded adds value to the refunded part of a transfer between payer and merchant, refunded is updated in place
+func addRefunded(ctx contractapi.TransactionContextInterface, originalTxID string, refunded *big.Int, value *big.Int, payer string, merchant string) error {
+	key, err := compositeKey(ctx, refundedPrefix, originalTxID)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, key, []byte(refunded.Add(refunded, value).String()), payer, merchant)
+}
+
+// readDispute returns the dispute of a transfer, or nil when it is not disputed
+func readDispute(ctx contractapi.TransactionContextInterface, originalTxID string) (*Dispute, error) {
+	key, err := compositeKey(ctx, disputePrefix, originalTxID)
+	if err != nil {
+		return nil, err
+	}
+
+	disputeBytes, err := readRecord(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dispute of transfer %s: %v", originalTxID, err)
+	}
+	if disputeBytes == nil {
+		return nil, nil
+	}
+
+	dispute := new(Dispute)
+	err = json.Unmarshal(disputeBytes, dispute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode dispute of transfer %s: %v", originalTxID, err)
+	}
+
+	return dispute, nil
+}
+
+func putDispute(ctx contractapi.TransactionContextInterface, dispute *Dispute) error {
+	key, err := compositeKey(ctx, disputePrefix, dispute.ID)
+	if err != nil {
+		return err
+	}
+
+	disputeJSON, err := json.Marshal(dispute)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putRecord(ctx, key, disputeJSON, dispute.Payer, dispute.Merchant)
+	if err != nil {
+		return fmt.Errorf("failed to update dispute of transfer %s: %v", dispute.ID, err)
+	}
+
+	return nil
+}
+
+// emitDisputeEvent emits a dispute event carrying the dispute
+func emitDisputeEvent(ctx contractapi.TransactionContextInterface, name string, dispute *Dispute) error {
+	return emitPaymentEvent(ctx, name, dispute.ID, dispute, dispute.Payer, dispute.Merchant)
+}
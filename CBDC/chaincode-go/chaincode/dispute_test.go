@@ -0,0 +1,102 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefundAndDispute(t *testing.T) {
+	merchant := commercial
+	ledger, contract := newFundedLedger(t, TierFull, customer, merchant)
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "200"))
+
+	ctx := ledger.as(customer, "Org1MSP")
+	payment := ctx.GetStub().GetTxID()
+	mustSucceed(t, contract.Transfer(ctx, merchant, "100"))
+
+	// Voluntary refunds by the merchant are capped by the payment
+	mustFail(t, contract.RefundPayment(ledger.as(customer, "Org1MSP"), payment, "30"))
+	mustSucceed(t, contract.RefundPayment(ledger.as(merchant, "Org1MSP"), payment, "30"))
+	if name := ledger.lastEvent(); name != "TransferRefunded" {
+		t.Fatalf("expected TransferRefunded event, got %q", name)
+	}
+	mustFail(t, contract.RefundPayment(ledger.as(merchant, "Org1MSP"), payment, "80"))
+
+	// Half of the 70.00 not refunded is held from the merchant
+	mustSucceed(t, contract.SetDisputeHold(ledger.as(centralBank, "Org2MSP"), 5000))
+	mustFail(t, contract.OpenDispute(ledger.as(merchant, "Org1MSP"), payment, "not delivered"))
+	mustFail(t, contract.OpenDispute(ledger.as(customer, "Org1MSP"), payment, ""))
+
+	// Funds of a merchant frozen for outgoing funds can't be held
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleRegulator, MemberTypeMSP, "Org2MSP"))
+	mustSucceed(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), merchant, FreezeOut, "fraud", "case 17/2023"))
+	mustFail(t, contract.OpenDispute(ledger.as(customer, "Org1MSP"), payment, "not delivered"))
+	mustSucceed(t, contract.UnfreezeAccount(ledger.as(centralBank, "Org2MSP"), merchant, "case 17/2023"))
+
+	mustSucceed(t, contract.OpenDispute(ledger.as(customer, "Org1MSP"), payment, "not delivered"))
+	if name := ledger.lastEvent(); name != "DisputeOpened" {
+		t.Fatalf("expected DisputeOpened event, got %q", name)
+	}
+	mustFail(t, contract.OpenDispute(ledger.as(customer, "Org1MSP"), payment, "not delivered"))
+	mustFail(t, contract.RefundPayment(ledger.as(merchant, "Org1MSP"), payment, "10"))
+
+	balance, err := contract.BalanceOf(ledger.as(merchant, "Org1MSP"), merchant)
+	mustSucceed(t, err)
+	if balance != "35.00" {
+		t.Fatalf("expected balance 35.00, got %s", balance)
+	}
+
+	mustFail(t, contract.ResolveDispute(ledger.as(centralBank, "Org2MSP"), payment, FavourPayer, "no proof of delivery"))
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleArbitrator, MemberTypeClient, centralBank))
+	mustFail(t, contract.ResolveDispute(ledger.as(centralBank, "Org2MSP"), payment, "bank", "no proof of delivery"))
+
+	// The held funds are paid to the payer like a transfer
+	mustSucceed(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, FreezeIn, "sanctions", "case 18/2023"))
+	mustFail(t, contract.ResolveDispute(ledger.as(centralBank, "Org2MSP"), payment, FavourPayer, "no proof of delivery"))
+	mustSucceed(t, contract.UnfreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, "case 18/2023"))
+	mustSucceed(t, contract.Pause(ledger.as(centralBank, "Org2MSP"), PauseTransfers, "incident"))
+	mustFail(t, contract.ResolveDispute(ledger.as(centralBank, "Org2MSP"), payment, FavourPayer, "no proof of delivery"))
+	mustSucceed(t, contract.Unpause(ledger.as(centralBank, "Org2MSP"), PauseTransfers, "resolved"))
+	mustSucceed(t, contract.ResolveDispute(ledger.as(centralBank, "Org2MSP"), payment, FavourPayer, "no proof of delivery"))
+	if name := ledger.lastEvent(); name != "DisputeResolved" {
+		t.Fatalf("expected DisputeResolved event, got %q", name)
+	}
+	mustFail(t, contract.ResolveDispute(ledger.as(centralBank, "Org2MSP"), payment, FavourMerchant, "changed my mind"))
+
+	dispute, err := contract.GetDispute(ledger.as(customer, "Org1MSP"), payment)
+	mustSucceed(t, err)
+	if dispute.Status != DisputeRefunded || dispute.Held != "35.00" {
+		t.Fatalf("unexpected dispute %+v", dispute)
+	}
+
+	// Disputes and refunded amounts of registered accounts are kept in the collection of their bank
+	for _, prefix := range []string{disputePrefix, refundedPrefix} {
+		key, err := compositeKey(ctx, prefix, payment)
+		mustSucceed(t, err)
+		if ledger.stub.State[key] != nil || ledger.stub.PvtState[balancesCollection("Org1MSP")][key] == nil {
+			t.Fatalf("expected the %s record in the collection of the bank only", prefix)
+		}
+	}
+
+	// The charged back amount counts as refunded
+	mustFail(t, contract.RefundPayment(ledger.as(merchant, "Org1MSP"), payment, "40"))
+	mustSucceed(t, contract.RefundPayment(ledger.as(merchant, "Org1MSP"), payment, "35"))
+
+	for account, expected := range map[string]string{customer: "200.00", merchant: "0.00", disputeEscrow(dispute): "0.00"} {
+		balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), account)
+		mustSucceed(t, err)
+		if balance != expected {
+			t.Fatalf("expected balance %s, got %s", expected, balance)
+		}
+	}
+
+	// Transfers can only be disputed within the dispute window
+	ctx = ledger.as(customer, "Org1MSP")
+	late := ctx.GetStub().GetTxID()
+	mustSucceed(t, contract.Transfer(ctx, merchant, "10"))
+	ledger.advance(121 * 24 * time.Hour)
+	mustFail(t, contract.OpenDispute(ledger.as(customer, "Org1MSP"), late, "not delivered"))
+	mustFail(t, contract.SetDisputeWindow(ledger.as(customer, "Org1MSP"), 180))
+	mustSucceed(t, contract.SetDisputeWindow(ledger.as(centralBank, "Org2MSP"), 180))
+	mustSucceed(t, contract.OpenDispute(ledger.as(customer, "Org1MSP"), late, "not delivered"))
+}
@@ -0,0 +1,379 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the statuses of a tea offer
+const (
+	OfferOpen      = "open"
+	OfferSettled   = "settled"
+	OfferCancelled = "cancelled"
+)
+
+// Define objectType names for prefix
+const (
+	teaOfferPrefix     = "teaOffer"
+	openTeaOfferPrefix = "openTeaOffer"
+)
+
+// TeaOffer offers a tea token for a price in the primary denomination. Accepting it pays the price
+// and hands the token over to the buyer in the same transaction. A token has at most one open offer,
+// which is closed when the token is sold, transferred or burned
+type TeaOffer struct {
+	ID        string    `json:"id"`
+	TokenID   string    `json:"tokenID"`
+	Seller    string    `json:"seller"`
+	Buyer     string    `json:"buyer,omitempty"`
+	Price     string    `json:"price"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	ClosedAt  time.Time `json:"closedAt,omitempty"`
+}
+
+// teaTradeEvent provides an organized struct for emitting the delivery and the payment of a trade as one event
+type teaTradeEvent struct {
+	Offer *TeaOffer     `json:"offer"`
+	Token *Tea          `json:"token"`
+	Legs  []transferLeg `json:"legs,omitempty"`
+}
+
+// OfferToken offers a tea token of the client for sale, an open offer of the token has to be cancelled first
+// param {String} buyer The only account that can accept the offer, anyone can accept it when empty
+// param {String} price The decimal price in the primary denomination, e.g. "125.50"
+// returns {String} The ID of the offer
+// This function triggers a TeaOffered event
+func (s *TeaContract) OfferToken(ctx contractapi.TransactionContextInterface, tokenId string, buyer string, price string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	token, err := s.QueryToken(ctx, tokenId)
+	if err != nil {
+		return "", err
+	}
+	if token.Owner != clientID {
+		return "", fmt.Errorf("token %s is not owned by the client", tokenId)
+	}
+	if buyer == clientID {
+		return "", fmt.Errorf("cannot offer a token to its owner")
+	}
+
+	openID, err := readOpenTeaOfferID(ctx, tokenId)
+	if err != nil {
+		return "", err
+	}
+	if openID != "" {
+		open, err := readTeaOffer(ctx, openID)
+		if err != nil {
+			return "", err
+		}
+		if open.Seller == clientID {
+			return "", fmt.Errorf("token %s is already offered with offer %s", tokenId, openID)
+		}
+
+		// The offer of a previous owner is stale
+		err = closeTeaOffer(ctx, open)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := parseAmount(price, decimals)
+	if err != nil {
+		return "", err
+	}
+	if value.Sign() <= 0 {
+		return "", fmt.Errorf("price must be positive")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	offer := &TeaOffer{
+		ID:        ctx.GetStub().GetTxID(),
+		TokenID:   tokenId,
+		Seller:    clientID,
+		Buyer:     buyer,
+		Price:     formatAmount(value, decimals),
+		Status:    OfferOpen,
+		CreatedAt: now,
+	}
+
+	err = putTeaOffer(ctx, offer)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitTeaOfferEvent(ctx, "TeaOffered", offer)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("client %s offered tea token %s for %s, offer %s", clientID, tokenId, offer.Price, offer.ID)
+
+	return offer.ID, nil
+}
+
+// AcceptOffer buys the token of an open offer. The price moves from the client account to the seller and
+// the token to the client in the same transaction, so either both happen or neither does
+// This function triggers a TeaTraded event
+func (s *TeaContract) AcceptOffer(ctx contractapi.TransactionContextInterface, offerID string) error {
+
+	offer, err := readOpenTeaOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID == offer.Seller {
+		return fmt.Errorf("cannot accept an own offer")
+	}
+	if offer.Buyer != "" && clientID != offer.Buyer {
+		return fmt.Errorf("offer %s is reserved for another buyer", offerID)
+	}
+
+	openID, err := readOpenTeaOfferID(ctx, offer.TokenID)
+	if err != nil {
+		return err
+	}
+	if openID != offer.ID {
+		return fmt.Errorf("offer %s is no longer the open offer of token %s", offerID, offer.TokenID)
+	}
+
+	// The seller may have transferred or burned the token since offering it
+	token, err := s.QueryToken(ctx, offer.TokenID)
+	if err != nil {
+		return err
+	}
+	if token.Owner != offer.Seller {
+		return fmt.Errorf("token %s is no longer owned by the seller", offer.TokenID)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(offer.Price, decimals)
+	if err != nil {
+		return err
+	}
+
+	legs, _, err := transferWithFees(ctx, FeeTransfer, clientID, []payout{{offer.Seller, value}})
+	if err != nil {
+		return fmt.Errorf("failed to pay for token %s: %v", offer.TokenID, err)
+	}
+
+	token.Owner = clientID
+
+	err = putJSON(ctx, offer.TokenID, token)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	offer.Buyer = clientID
+	offer.Status = OfferSettled
+	offer.ClosedAt = now
+
+	err = putTeaOffer(ctx, offer)
+	if err != nil {
+		return err
+	}
+
+	err = emitPaymentEvent(ctx, "TeaTraded", offer.ID, teaTradeEvent{offer, token, legs}, offer.Seller, offer.Buyer)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("tea token %s sold by %s to %s for %s", offer.TokenID, offer.Seller, clientID, offer.Price)
+
+	return nil
+}
+
+// CancelOffer withdraws an open offer, only the seller can cancel it
+// This function triggers a TeaOfferCancelled event
+func (s *TeaContract) CancelOffer(ctx contractapi.TransactionContextInterface, offerID string) error {
+
+	offer, err := readOpenTeaOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != offer.Seller {
+		return fmt.Errorf("only the seller can cancel offer %s", offerID)
+	}
+
+	err = closeTeaOffer(ctx, offer)
+	if err != nil {
+		return err
+	}
+
+	return emitTeaOfferEvent(ctx, "TeaOfferCancelled", offer)
+}
+
+// GetOffer returns an offer of a tea token
+func (s *TeaContract) GetOffer(ctx contractapi.TransactionContextInterface, offerID string) (*TeaOffer, error) {
+	return readTeaOffer(ctx, offerID)
+}
+
+// Helper Functions
+
+// readOpenTeaOffer returns an offer that was neither accepted nor cancelled
+func readOpenTeaOffer(ctx contractapi.TransactionContextInterface, offerID string) (*TeaOffer, error) {
+	offer, err := readTeaOffer(ctx, offerID)
+	if err != nil {
+		return nil, err
+	}
+	if offer.Status != OfferOpen {
+		return nil, fmt.Errorf("offer %s is %s", offerID, offer.Status)
+	}
+
+	return offer, nil
+}
+
+// closeTeaOffer cancels an open offer
+func closeTeaOffer(ctx contractapi.TransactionContextInterface, offer *TeaOffer) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	offer.Status = OfferCancelled
+	offer.ClosedAt = now
+
+	return putTeaOffer(ctx, offer)
+}
+
+// closeTokenOffer cancels the open offer of a token, if any, when the token leaves its seller
+func closeTokenOffer(ctx contractapi.TransactionContextInterface, tokenID string) error {
+	offerID, err := readOpenTeaOfferID(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	if offerID == "" {
+		return nil
+	}
+
+	offer, err := readTeaOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	return closeTeaOffer(ctx, offer)
+}
+
+// readOpenTeaOfferID returns the ID of the open offer of a token, or an empty string when it is not offered
+func readOpenTeaOfferID(ctx contractapi.TransactionContextInterface, tokenID string) (string, error) {
+	key, err := compositeKey(ctx, openTeaOfferPrefix, tokenID)
+	if err != nil {
+		return "", err
+	}
+
+	offerID, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the open offer of token %s from world state: %v", tokenID, err)
+	}
+
+	return string(offerID), nil
+}
+
+func readTeaOffer(ctx contractapi.TransactionContextInterface, offerID string) (*TeaOffer, error) {
+	key, err := compositeKey(ctx, teaOfferPrefix, offerID)
+	if err != nil {
+		return nil, err
+	}
+
+	offerBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offer %s from world state: %v", offerID, err)
+	}
+	if offerBytes == nil {
+		return nil, fmt.Errorf("offer %s does not exist", offerID)
+	}
+
+	offer := new(TeaOffer)
+	err = json.Unmarshal(offerBytes, offer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode offer %s: %v", offerID, err)
+	}
+
+	return offer, nil
+}
+
+// putTeaOffer stores an offer and keeps the index of the open offer of its token up to date
+func putTeaOffer(ctx contractapi.TransactionContextInterface, offer *TeaOffer) error {
+	key, err := compositeKey(ctx, teaOfferPrefix, offer.ID)
+	if err != nil {
+		return err
+	}
+
+	err = putJSON(ctx, key, offer)
+	if err != nil {
+		return err
+	}
+
+	openKey, err := compositeKey(ctx, openTeaOfferPrefix, offer.TokenID)
+	if err != nil {
+		return err
+	}
+
+	openID, err := readOpenTeaOfferID(ctx, offer.TokenID)
+	if err != nil {
+		return err
+	}
+
+	if offer.Status == OfferOpen {
+		err = ctx.GetStub().PutState(openKey, []byte(offer.ID))
+	} else if openID == offer.ID {
+		err = ctx.GetStub().DelState(openKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update the open offer of token %s: %v", offer.TokenID, err)
+	}
+
+	return nil
+}
+
+// emitTeaOfferEvent emits an offer event carrying the offer
+func emitTeaOfferEvent(ctx contractapi.TransactionContextInterface, name string, offer *TeaOffer) error {
+	return emitPaymentEvent(ctx, name, offer.ID, offer, offer.Seller, offer.Buyer)
+}
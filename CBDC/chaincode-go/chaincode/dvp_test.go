@@ -0,0 +1,79 @@
+package chaincode
+
+import "testing"
+
+func TestTeaTrade(t *testing.T) {
+	tea := new(TeaContract)
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial)
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "100"))
+
+	_, err := tea.Mint(ledger.as(centralBank, "Org2MSP"), "Earl Grey", 40, 1, commercial)
+	mustSucceed(t, err)
+	tokenID := ledger.stub.TxID
+
+	_, err = tea.OfferToken(ledger.as(customer, "Org1MSP"), tokenID, "", "40")
+	mustFail(t, err)
+	_, err = tea.OfferToken(ledger.as(commercial, "Org1MSP"), tokenID, "", "0")
+	mustFail(t, err)
+
+	// An offer reserved for the central bank can't be taken by anyone else
+	reserved, err := tea.OfferToken(ledger.as(commercial, "Org1MSP"), tokenID, centralBank, "40")
+	mustSucceed(t, err)
+	if name := ledger.lastEvent(); name != "TeaOffered" {
+		t.Fatalf("expected TeaOffered event, got %q", name)
+	}
+	mustFail(t, tea.AcceptOffer(ledger.as(customer, "Org1MSP"), reserved))
+	mustFail(t, tea.CancelOffer(ledger.as(customer, "Org1MSP"), reserved))
+	mustSucceed(t, tea.CancelOffer(ledger.as(commercial, "Org1MSP"), reserved))
+	mustFail(t, tea.AcceptOffer(ledger.as(centralBank, "Org2MSP"), reserved))
+
+	// A buyer that can't pay gets neither the token nor a debit
+	expensive, err := tea.OfferToken(ledger.as(commercial, "Org1MSP"), tokenID, "", "150")
+	mustSucceed(t, err)
+	mustFail(t, tea.AcceptOffer(ledger.as(customer, "Org1MSP"), expensive))
+	mustSucceed(t, tea.CancelOffer(ledger.as(commercial, "Org1MSP"), expensive))
+
+	offerID, err := tea.OfferToken(ledger.as(commercial, "Org1MSP"), tokenID, "", "40")
+	mustSucceed(t, err)
+
+	// A token has one open offer at a time
+	_, err = tea.OfferToken(ledger.as(commercial, "Org1MSP"), tokenID, "", "35")
+	mustFail(t, err)
+	mustFail(t, tea.AcceptOffer(ledger.as(commercial, "Org1MSP"), offerID))
+	mustSucceed(t, tea.AcceptOffer(ledger.as(customer, "Org1MSP"), offerID))
+	if name := ledger.lastEvent(); name != "TeaTraded" {
+		t.Fatalf("expected TeaTraded event, got %q", name)
+	}
+	mustFail(t, tea.AcceptOffer(ledger.as(customer, "Org1MSP"), offerID))
+
+	token, err := tea.QueryToken(ledger.as(customer, "Org1MSP"), tokenID)
+	mustSucceed(t, err)
+	if token.Owner != customer {
+		t.Fatalf("expected the buyer to own the token, got %s", token.Owner)
+	}
+
+	// An offer of a token the seller no longer owns can't be accepted
+	stale, err := tea.OfferToken(ledger.as(customer, "Org1MSP"), tokenID, "", "50")
+	mustSucceed(t, err)
+	tea.Transfer(ledger.as(customer, "Org1MSP"), tokenID, centralBank)
+	mustFail(t, tea.AcceptOffer(ledger.as(commercial, "Org1MSP"), stale))
+
+	// Moving the token closes the offer, so it stays closed when the token comes back to the seller
+	tea.Transfer(ledger.as(centralBank, "Org2MSP"), tokenID, customer)
+	mustFail(t, tea.AcceptOffer(ledger.as(commercial, "Org1MSP"), stale))
+	offer, err := tea.GetOffer(ledger.as(customer, "Org1MSP"), stale)
+	mustSucceed(t, err)
+	if offer.Status != OfferCancelled {
+		t.Fatalf("expected the stale offer to be cancelled, got %s", offer.Status)
+	}
+	_, err = tea.OfferToken(ledger.as(customer, "Org1MSP"), tokenID, "", "50")
+	mustSucceed(t, err)
+
+	for account, expected := range map[string]string{customer: "60.00", commercial: "40.00"} {
+		balance, err := contract.BalanceOf(ledger.as(centralBank, "Org2MSP"), account)
+		mustSucceed(t, err)
+		if balance != expected {
+			t.Fatalf("expected balance %s, got %s", expected, balance)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const (
+	programPrefix      = "program"
+	programTotalPrefix = "programTotal"
+	earmarkPrefix      = "earmark"
+)
+
+// Define the totals tracked for every program
+const spentField = "spent"
+
+// Program is a government program whose funds can only be spent with the allowed recipients.
+// A recipient qualifies when it is listed in Accounts or its merchant category is listed in Categories
+type Program struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"owner"`
+	Categories []string  `json:"categories"`
+	Accounts   []string  `json:"accounts"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ProgramReport summarizes how much of the funds issued by a program were spent
+type ProgramReport struct {
+	Program string `json:"program"`
+	Issued  string `json:"issued"`
+	Spent   string `json:"spent"`
+	Unspent string `json:"unspent"`
+}
+
+// EarmarkedBalance is the part of the balance of an account that is bound to a program
+type EarmarkedBalance struct {
+	Program string `json:"program"`
+	Amount  string `json:"amount"`
+}
+
+// earmarkEvent provides an organized struct for emitting the issuance of earmarked funds
+type earmarkEvent struct {
+	Program string `json:"program"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Value   string `json:"value"`
+}
+
+// earmark is the amount of a program held by an account
+type earmark struct {
+	program string
+	amount  *big.Int
+}
+
+// earmarkSpend is the part of a payment covered by the earmarked funds of the sender
+type earmarkSpend struct {
+	held     *big.Int
+	used     *big.Int
+	programs []earmark
+}
+
+// CreateProgram creates a program the calling minter can issue earmarked funds for
+// param {[]String} categories The merchant categories the funds can be spent with, e.g. ["food"]
+// param {[]String} accounts The accounts the funds can be spent with regardless of their category
+// This function triggers a ProgramCreated event
+func (s *Erc20Contract) CreateProgram(ctx contractapi.TransactionContextInterface, programID string, categories []string, accounts []string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = requireRole(ctx, RoleMinter)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to create programs: %v", err)
+	}
+
+	if programID == "" {
+		return fmt.Errorf("program ID must not be empty")
+	}
+	if len(categories) == 0 && len(accounts) == 0 {
+		return fmt.Errorf("program %s must allow at least one category or account", programID)
+	}
+
+	key, err := compositeKey(ctx, programPrefix, programID)
+	if err != nil {
+		return err
+	}
+
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read program %s from world state: %v", programID, err)
+	}
+	if existing != nil {
+		return fmt.Errorf("program %s already exists", programID)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	if categories == nil {
+		categories = []string{}
+	}
+	if accounts == nil {
+		accounts = []string{}
+	}
+
+	programJSON, err := json.Marshal(Program{programID, clientID, categories, accounts, now})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, programJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create program %s: %v", programID, err)
+	}
+
+	err = ctx.GetStub().SetEvent("ProgramCreated", programJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("program %s created by %s", programID, clientID)
+
+	return nil
+}
+
+// GetProgram returns a program with its allowed categories and accounts
+func (s *Erc20Contract) GetProgram(ctx contractapi.TransactionContextInterface, programID string) (*Program, error) {
+	return readProgram(ctx, programID)
+}
+
+// IssueEarmarked transfers tokens of the program owner to recipient bound to the program.
+// The recipient can spend them only with qualifying recipients, where they become unrestricted
+// param {String} amount The decimal amount to issue, e.g. "125.50"
+// This function triggers an EarmarkedIssued event
+func (s *Erc20Contract) IssueEarmarked(ctx contractapi.TransactionContextInterface, programID string, recipient string, amount string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	program, err := readProgram(ctx, programID)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != program.Owner {
+		return fmt.Errorf("client is not the owner of program %s", programID)
+	}
+
+	if isInternalAccount(recipient) {
+		return fmt.Errorf("cannot issue earmarked funds to contract account %s", recipient)
+	}
+
+	// A holding cap would route the earmarked funds to a deposit account where they are no longer bound
+	waterfall, err := readWaterfall(ctx, recipient)
+	if err != nil {
+		return err
+	}
+	if waterfall != nil {
+		return fmt.Errorf("cannot issue earmarked funds to %s, it has a waterfall", recipient)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("issue amount must be positive")
+	}
+
+	_, err = transferHelper(ctx, clientID, recipient, value)
+	if err != nil {
+		return fmt.Errorf("failed to issue earmarked funds: %v", err)
+	}
+
+	key, err := compositeKey(ctx, earmarkPrefix, recipient, programID)
+	if err != nil {
+		return err
+	}
+
+	earmarked, _, err := readAccountAmount(ctx, recipient, key)
+	if err != nil {
+		return err
+	}
+
+	err = putAccountAmount(ctx, recipient, key, earmarked.Add(earmarked, value))
+	if err != nil {
+		return err
+	}
+
+	err = addProgramTotal(ctx, programID, issuedField, value)
+	if err != nil {
+		return err
+	}
+
+	err = emitPaymentEvent(ctx, "EarmarkedIssued", programID, earmarkEvent{programID, clientID, recipient, formatAmount(value, decimals)}, recipient)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("issued %s of program %s to %s", formatAmount(value, decimals), programID, recipient)
+
+	return nil
+}
+
+// GetEarmarkedBalances returns the parts of the balance of an account that are bound to programs
+// Only the account itself, its bank and the central bank roles can read them
+func (s *Erc20Contract) GetEarmarkedBalances(ctx contractapi.TransactionContextInterface, account string) ([]EarmarkedBalance, error) {
+
+	err := requireAccountReader(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	earmarks, err := readEarmarks(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := []EarmarkedBalance{}
+	for _, e := range earmarks {
+		balances = append(balances, EarmarkedBalance{e.program, formatAmount(e.amount, decimals)})
+	}
+
+	return balances, nil
+}
+
+// GetProgramReport returns how much of the funds issued by a program were spent with qualifying recipients
+// Only the program owner and the auditing roles can read it
+func (s *Erc20Contract) GetProgramReport(ctx contractapi.TransactionContextInterface, programID string) (*ProgramReport, error) {
+
+	program, err := readProgram(ctx, programID)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != program.Owner {
+		err = requireRole(ctx, RoleAdmin, RoleAuditor, RoleRegulator)
+		if err != nil {
+			return nil, fmt.Errorf("client is not authorized to read the report of program %s: %v", programID, err)
+		}
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]*big.Int)
+	for _, field := range []string{issuedField, spentField} {
+		key, err := compositeKey(ctx, programTotalPrefix, programID, field)
+		if err != nil {
+			return nil, err
+		}
+
+		totals[field], _, err = readAmount(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ProgramReport{
+		Program: programID,
+		Issued:  formatAmount(totals[issuedField], decimals),
+		Spent:   formatAmount(totals[spentField], decimals),
+		Unspent: formatAmount(new(big.Int).Sub(totals[issuedField], totals[spentField]), decimals),
+	}, nil
+}
+
+// Helper Functions
+
+// allocateEarmarks works out which part of the credits the earmarked funds of the sender pay for.
+// Earmarked funds pay for credits to qualifying recipients first, everything else has to come from general funds
+// Dependant functions include transferToMany
+func allocateEarmarks(ctx contractapi.TransactionContextInterface, from string, recipients []string, credits map[string]*big.Int) (*earmarkSpend, error) {
+	spend := &earmarkSpend{held: new(big.Int), used: new(big.Int)}
+
+	earmarks, err := readEarmarks(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if len(earmarks) == 0 {
+		return spend, nil
+	}
+
+	programs := make(map[string]*Program)
+	for _, e := range earmarks {
+		spend.held.Add(spend.held, e.amount)
+
+		programs[e.program], err = readProgram(ctx, e.program)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	remaining := make([]*big.Int, len(earmarks))
+	for i, e := range earmarks {
+		remaining[i] = new(big.Int).Set(e.amount)
+	}
+
+	for _, to := range recipients {
+		registered, err := readAccount(ctx, to)
+		if err != nil {
+			return nil, err
+		}
+		category := ""
+		if registered != nil {
+			category = registered.Category
+		}
+
+		due := new(big.Int).Set(credits[to])
+		for i, e := range earmarks {
+			if due.Sign() == 0 {
+				break
+			}
+			if remaining[i].Sign() == 0 || !programs[e.program].allows(to, category) {
+				continue
+			}
+
+			used := new(big.Int).Set(due)
+			if used.Cmp(remaining[i]) > 0 {
+				used.Set(remaining[i])
+			}
+			remaining[i].Sub(remaining[i], used)
+			due.Sub(due, used)
+			spend.used.Add(spend.used, used)
+		}
+	}
+
+	for i, e := range earmarks {
+		used := new(big.Int).Sub(e.amount, remaining[i])
+		if used.Sign() > 0 {
+			spend.programs = append(spend.programs, earmark{e.program, used})
+		}
+	}
+
+	return spend, nil
+}
+
+// spendEarmarks takes the earmarked funds a payment used off the sender and adds them to the spent totals
+// Dependant functions include transferToMany
+func spendEarmarks(ctx contractapi.TransactionContextInterface, from string, spend *earmarkSpend) error {
+	for _, e := range spend.programs {
+		key, err := compositeKey(ctx, earmarkPrefix, from, e.program)
+		if err != nil {
+			return err
+		}
+
+		earmarked, _, err := readAccountAmount(ctx, from, key)
+		if err != nil {
+			return err
+		}
+
+		earmarked.Sub(earmarked, e.amount)
+		if earmarked.Sign() == 0 {
+			err = delAccountState(ctx, from, key)
+			if err != nil {
+				return fmt.Errorf("failed to delete earmark of %s: %v", from, err)
+			}
+		} else {
+			err = putAccountAmount(ctx, from, key, earmarked)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = addProgramTotal(ctx, e.program, spentField, e.amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// allows checks if a recipient qualifies for the funds of a program
+func (p *Program) allows(account string, category string) bool {
+	return containsString(p.Accounts, account) || (category != "" && containsString(p.Categories, category))
+}
+
+// readEarmarks returns the earmarked funds of an account ordered by program
+func readEarmarks(ctx contractapi.TransactionContextInterface, account string) ([]earmark, error) {
+	results, err := readStateByPartialKey(ctx, earmarkPrefix, []string{account}, account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read earmarks of %s: %v", account, err)
+	}
+
+	earmarks := []earmark{}
+	for _, queryResponse := range results {
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key %s: %v", queryResponse.Key, err)
+		}
+
+		amount, ok := new(big.Int).SetString(string(queryResponse.Value), 10)
+		if !ok {
+			return nil, fmt.Errorf("earmark of %s in program %s is not an integer amount", account, attributes[1])
+		}
+		earmarks = append(earmarks, earmark{attributes[1], amount})
+	}
+
+	return earmarks, nil
+}
+
+func readProgram(ctx contractapi.TransactionContextInterface, programID string) (*Program, error) {
+	key, err := compositeKey(ctx, programPrefix, programID)
+	if err != nil {
+		return nil, err
+	}
+
+	programBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read program %s from world state: %v", programID, err)
+	}
+	if programBytes == nil {
+		return nil, fmt.Errorf("program %s does not exist", programID)
+	}
+
+	program := new(Program)
+	err = json.Unmarshal(programBytes, program)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode program %s: %v", programID, err)
+	}
+
+	return program, nil
+}
+
+func addProgramTotal(ctx contractapi.TransactionContextInterface, programID string, field string, value *big.Int) error {
+	key, err := compositeKey(ctx, programTotalPrefix, programID, field)
+	if err != nil {
+		return err
+	}
+
+	total, _, err := readAmount(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return putAmount(ctx, key, total.Add(total, value))
+}
@@ -0,0 +1,70 @@
+package chaincode
+
+import "testing"
+
+func TestEarmarkedFunds(t *testing.T) {
+	grocer := commercial
+	other := clientID("CN=user2,OU=client,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org1.example.com")
+	ledger, contract := newFundedLedger(t, TierFull, customer, grocer, other)
+	mustSucceed(t, contract.SetMerchantCategory(ledger.as(commercial, "Org1MSP"), grocer, "food"))
+
+	mustFail(t, contract.CreateProgram(ledger.as(customer, "Org3MSP"), "food-aid", []string{"food"}, nil))
+	mustSucceed(t, contract.CreateProgram(ledger.as(centralBank, "Org2MSP"), "food-aid", []string{"food"}, nil))
+	mustFail(t, contract.CreateProgram(ledger.as(centralBank, "Org2MSP"), "food-aid", []string{"food"}, nil))
+
+	mustSucceed(t, contract.IssueEarmarked(ledger.as(centralBank, "Org2MSP"), "food-aid", customer, "100"))
+	if name := ledger.lastEvent(); name != "EarmarkedIssued" {
+		t.Fatalf("expected EarmarkedIssued event, got %q", name)
+	}
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "30"))
+
+	// Only general funds can be spent with recipients outside the program
+	mustFail(t, contract.Transfer(ledger.as(customer, "Org1MSP"), other, "50"))
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), other, "20"))
+
+	// Qualifying recipients are paid from earmarked funds first
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), grocer, "60"))
+
+	earmarked, err := contract.GetEarmarkedBalances(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if len(earmarked) != 1 || earmarked[0].Amount != "40.00" {
+		t.Fatalf("expected 40.00 earmarked, got %+v", earmarked)
+	}
+
+	// Earmarks of registered accounts are kept in the collection of their bank
+	earmarkKey, err := compositeKey(ledger.as(customer, "Org1MSP"), earmarkPrefix, customer, "food-aid")
+	mustSucceed(t, err)
+	if ledger.stub.State[earmarkKey] != nil || ledger.stub.PvtState[balancesCollection("Org1MSP")][earmarkKey] == nil {
+		t.Fatalf("expected the earmark in the collection of the bank only")
+	}
+
+	_, err = contract.GetProgramReport(ledger.as(customer, "Org1MSP"), "food-aid")
+	mustFail(t, err)
+	report, err := contract.GetProgramReport(ledger.as(centralBank, "Org2MSP"), "food-aid")
+	mustSucceed(t, err)
+	if report.Issued != "100.00" || report.Spent != "60.00" || report.Unspent != "40.00" {
+		t.Fatalf("unexpected program report %+v", report)
+	}
+
+	// A payment larger than the earmarked funds takes the rest from general funds
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), grocer, "50"))
+	earmarked, err = contract.GetEarmarkedBalances(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if len(earmarked) != 0 {
+		t.Fatalf("expected no earmarked funds, got %+v", earmarked)
+	}
+	if ledger.stub.PvtState[balancesCollection("Org1MSP")][earmarkKey] != nil {
+		t.Fatalf("expected the spent earmark to be deleted")
+	}
+	_, err = contract.GetEarmarkedBalances(ledger.as(other, "Org3MSP"), customer)
+	mustFail(t, err)
+
+	// The merchant can spend what it received anywhere
+	mustSucceed(t, contract.Transfer(ledger.as(grocer, "Org1MSP"), other, "110"))
+
+	balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), other)
+	mustSucceed(t, err)
+	if balance != "130.00" {
+		t.Fatalf("expected balance 130.00, got %s", balance)
+	}
+}
@@ -5,23 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
+	"math/big"
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-// Define key names for options
-const nameKey = "CBR"
-const symbolKey = "CBR"
-const decimalsKey = "2"
-const totalSupplyKey = "0"
-
-// Define objectType names for prefix
-const allowancePrefix = "allowance"
-
-// Define key names for options
-
 // Erc20Contract provides functions for transferring tokens between accounts
 type Erc20Contract struct {
 	contractapi.Contract
@@ -33,12 +22,23 @@ type QueryResult struct {
 	Record *event
 }
 
+// QueryHistory structure used for handling result of history query
+type QueryHistory struct {
+	TxID      string    `json:"txID"`
+	TimeStamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+	Record    *event
+}
+
 // event provides an organized struct for emitting events
+// Value is a decimal string such as "125.50"
 type event struct {
-	From  string `json:"from"`
-	To    string `json:"to"`
-	Value int    `json:"value"`
-	Check *Check `json:"check"`
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	Value      string        `json:"value"`
+	Check      *Check        `json:"check"`
+	Remittance *Remittance   `json:"remittance,omitempty"`
+	Legs       []transferLeg `json:"legs,omitempty"`
 }
 
 type Check struct {
@@ -47,8 +47,10 @@ type Check struct {
 }
 
 // Mint creates new tokens and adds them to minter's account balance
+// param {String} amount The decimal amount to mint, e.g. "125.50"
+// While an approval policy is set minting goes through ProposeMint instead
 // This function triggers a Transfer event
-func (s *Erc20Contract) Mint(ctx contractapi.TransactionContextInterface, amount int, check Check) error {
+func (s *Erc20Contract) Mint(ctx contractapi.TransactionContextInterface, amount string, check Check) error {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -59,77 +61,48 @@ func (s *Erc20Contract) Mint(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check minter authorization against the role registry
+	err = requireRole(ctx, RoleMinter)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org2MSP" {
-		return fmt.Errorf("client is not authorized to mint new tokens")
+		return fmt.Errorf("client is not authorized to mint new tokens: %v", err)
 	}
 
-	// Get ID of submitting client identity
-	minter, err := ctx.GetClientIdentity().GetID()
-	if err != nil {
-		return fmt.Errorf("failed to get client id: %v", err)
-	}
-
-	if amount <= 0 {
-		return fmt.Errorf("mint amount must be a positive integer")
-	}
-
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
-	if err != nil {
-		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
-	}
-
-	var currentBalance int
-
-	// If minter current balance doesn't yet exist, we'll create it with a current balance of 0
-	if currentBalanceBytes == nil {
-		currentBalance = 0
-	} else {
-		currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
-	}
-
-	updatedBalance, err := add(currentBalance, amount)
+	err = checkDirectSupplyChange(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(minter, []byte(strconv.Itoa(updatedBalance)))
+	err = checkNotPaused(ctx, PauseMinting)
 	if err != nil {
 		return err
 	}
 
-	// Update the totalSupply
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	// Get ID of submitting client identity
+	minter, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve total token supply: %v", err)
+		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	var totalSupply int
-
-	// If no tokens have been minted, initialize the totalSupply
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Add the mint amount to the total supply and update the state
-	totalSupply, err = add(totalSupply, amount)
+	mintAmount, err := parseAmount(amount, decimals)
 	if err != nil {
 		return err
 	}
+	if mintAmount.Sign() <= 0 {
+		return fmt.Errorf("mint amount must be positive")
+	}
 
-	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	err = mintHelper(ctx, minter, mintAmount)
 	if err != nil {
 		return err
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{"0x0", minter, amount, check}
+	transferEvent := event{"0x0", minter, formatAmount(mintAmount, decimals), &check, nil, nil}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -139,14 +112,14 @@ func (s *Erc20Contract) Mint(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("failed to set event: %v", err)
 	}
 
-	log.Printf("minter account %s balance updated from %d to %d", minter, currentBalance, updatedBalance)
-
 	return nil
 }
 
 // Burn redeems tokens the minter's account balance
+// param {String} amount The decimal amount to burn, e.g. "125.50"
+// While an approval policy is set burning goes through ProposeBurn instead
 // This function triggers a Transfer event
-func (s *Erc20Contract) Burn(ctx contractapi.TransactionContextInterface, amount int) error {
+func (s *Erc20Contract) Burn(ctx contractapi.TransactionContextInterface, amount string) error {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -156,75 +129,48 @@ func (s *Erc20Contract) Burn(ctx contractapi.TransactionContextInterface, amount
 	if !initialized {
 		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to burn new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check burner authorization against the role registry
+	err = requireRole(ctx, RoleBurner)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org2MSP" {
-		return fmt.Errorf("client is not authorized to mint new tokens")
+		return fmt.Errorf("client is not authorized to burn tokens: %v", err)
 	}
 
-	// Get ID of submitting client identity
-	minter, err := ctx.GetClientIdentity().GetID()
-	if err != nil {
-		return fmt.Errorf("failed to get client id: %v", err)
-	}
-
-	if amount <= 0 {
-		return errors.New("burn amount must be a positive integer")
-	}
-
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
-	if err != nil {
-		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
-	}
-
-	var currentBalance int
-
-	// Check if minter current balance exists
-	if currentBalanceBytes == nil {
-		return errors.New("The balance does not exist")
-	}
-
-	currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
-
-	updatedBalance, err := sub(currentBalance, amount)
+	err = checkDirectSupplyChange(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(minter, []byte(strconv.Itoa(updatedBalance)))
+	err = checkNotPaused(ctx, PauseMinting)
 	if err != nil {
 		return err
 	}
 
-	// Update the totalSupply
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	// Get ID of submitting client identity
+	minter, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve total token supply: %v", err)
+		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	// If no tokens have been minted, throw error
-	if totalSupplyBytes == nil {
-		return errors.New("totalSupply does not exist")
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
 	}
 
-	totalSupply, _ := strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
-
-	// Subtract the burn amount to the total supply and update the state
-	totalSupply, err = sub(totalSupply, amount)
+	burnAmount, err := parseAmount(amount, decimals)
 	if err != nil {
 		return err
 	}
+	if burnAmount.Sign() <= 0 {
+		return errors.New("burn amount must be positive")
+	}
 
-	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	err = burnHelper(ctx, minter, burnAmount)
 	if err != nil {
 		return err
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{minter, "0x0", amount}
+	transferEvent := event{minter, "0x0", formatAmount(burnAmount, decimals), nil, nil, nil}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -234,15 +180,22 @@ func (s *Erc20Contract) Burn(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("failed to set event: %v", err)
 	}
 
-	log.Printf("minter account %s balance updated from %d to %d", minter, currentBalance, updatedBalance)
-
 	return nil
 }
 
 // Transfer transfers tokens from client account to recipient account
 // recipient account must be a valid clientID as returned by the ClientID() function
+// param {String} amount The decimal amount to transfer, e.g. "125.50"
 // This function triggers a Transfer event
-func (s *Erc20Contract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount int) error {
+func (s *Erc20Contract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount string) error {
+	return s.TransferWithRemittance(ctx, recipient, amount, Remittance{})
+}
+
+// TransferWithRemittance transfers tokens from client account to recipient account together with remittance data
+// param {String} amount The decimal amount to transfer, e.g. "125.50"
+// param {Remittance} remittance The memo, end-to-end reference and purpose code of the payment, all optional
+// This function triggers a Transfer event
+func (s *Erc20Contract) TransferWithRemittance(ctx contractapi.TransactionContextInterface, recipient string, amount string, remittance Remittance) error {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -259,79 +212,111 @@ func (s *Erc20Contract) Transfer(ctx contractapi.TransactionContextInterface, re
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	err = transferHelper(ctx, clientID, recipient, amount)
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return err
+	}
+
+	err = validateRemittance(ctx, remittance)
+	if err != nil {
+		return err
+	}
+
+	err = checkClientRecipient(recipient)
+	if err != nil {
+		return err
+	}
+
+	legs, _, err := transferWithFees(ctx, FeeTransfer, clientID, []payout{{recipient, value}})
 	if err != nil {
 		return fmt.Errorf("failed to transfer: %v", err)
 	}
 
-	// Emit the Transfer event
-	transferEvent := event{clientID, recipient, amount}
-	transferEventJSON, err := json.Marshal(transferEvent)
+	err = recordTransfer(ctx, clientID, recipient, value, remittance)
 	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		return err
 	}
-	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
+
+	// Emit the Transfer event
+	err = emitTransferEvent(ctx, event{clientID, recipient, formatAmount(value, decimals), nil, remittanceOrNil(remittance), legs})
 	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return err
 	}
 
 	return nil
 }
 
-// BalanceOf returns the balance of the given account
-func (s *Erc20Contract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+// BalanceOf returns the balance of the given account as a decimal string
+// Only the account itself, its bank and the central bank roles can read the balance of a registered account
+func (s *Erc20Contract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (string, error) {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
 	}
 	if !initialized {
-		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
-	balanceBytes, err := ctx.GetStub().GetState(account)
+	err = requireAccountReader(ctx, account)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read from world state: %v", err)
+		return "", err
 	}
-	if balanceBytes == nil {
-		return 0, fmt.Errorf("the account %s does not exist", account)
+
+	balance, exists, err := readBalance(ctx, account)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("the account %s does not exist", account)
 	}
 
-	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
 
-	return balance, nil
+	return formatAmount(balance, decimals), nil
 }
 
-// ClientAccountBalance returns the balance of the requesting client's account
-func (s *Erc20Contract) ClientAccountBalance(ctx contractapi.TransactionContextInterface) (int, error) {
+// ClientAccountBalance returns the balance of the requesting client's account as a decimal string
+func (s *Erc20Contract) ClientAccountBalance(ctx contractapi.TransactionContextInterface) (string, error) {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
 	}
 	if !initialized {
-		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
 	// Get ID of submitting client identity
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get client id: %v", err)
+		return "", fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	balanceBytes, err := ctx.GetStub().GetState(clientID)
+	balance, exists, err := readBalance(ctx, clientID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read from world state: %v", err)
+		return "", fmt.Errorf("failed to read from world state: %v", err)
 	}
-	if balanceBytes == nil {
-		return 0, fmt.Errorf("the account %s does not exist", clientID)
+	if !exists {
+		return "", fmt.Errorf("the account %s does not exist", clientID)
 	}
 
-	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
 
-	return balance, nil
+	return formatAmount(balance, decimals), nil
 }
 
 // ClientAccountID returns the id of the requesting client's account
@@ -357,42 +342,40 @@ func (s *Erc20Contract) ClientAccountID(ctx contractapi.TransactionContextInterf
 	return clientAccountID, nil
 }
 
-// TotalSupply returns the total token supply
-func (s *Erc20Contract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
+// TotalSupply returns the total token supply as a decimal string
+func (s *Erc20Contract) TotalSupply(ctx contractapi.TransactionContextInterface) (string, error) {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
 	}
 	if !initialized {
-		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
 	// Retrieve total supply of tokens from state of smart contract
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	// If no tokens have been minted, it is 0
+	totalSupply, err := readTotalSupply(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve total token supply: %v", err)
+		return "", fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
-	var totalSupply int
-
-	// If no tokens have been minted, return 0
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	log.Printf("TotalSupply: %d tokens", totalSupply)
+	log.Printf("TotalSupply: %s tokens", formatAmount(totalSupply, decimals))
 
-	return totalSupply, nil
+	return formatAmount(totalSupply, decimals), nil
 }
 
 // Approve allows the spender to withdraw from the calling client's token account
 // The spender can withdraw multiple times if necessary, up to the value amount
+// param {String} value The decimal allowance, e.g. "125.50"
 // This function triggers an Approval event
-func (s *Erc20Contract) Approve(ctx contractapi.TransactionContextInterface, spender string, value int) error {
+func (s *Erc20Contract) Approve(ctx contractapi.TransactionContextInterface, spender string, value string) error {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -403,26 +386,35 @@ func (s *Erc20Contract) Approve(ctx contractapi.TransactionContextInterface, spe
 		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
+	err = checkNotPaused(ctx, PauseApprovals)
+	if err != nil {
+		return err
+	}
+
 	// Get ID of submitting client identity
 	owner, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	decimals, err := readDecimals(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return err
+	}
+
+	allowance, err := parseAmount(value, decimals)
+	if err != nil {
+		return err
 	}
 
 	// Update the state of the smart contract by adding the allowanceKey and value
-	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(value)))
+	err = writeAllowance(ctx, owner, spender, allowance)
 	if err != nil {
-		return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
+		return err
 	}
 
 	// Emit the Approval event
-	approvalEvent := event{owner, spender, value}
+	approvalEvent := event{owner, spender, formatAmount(allowance, decimals), nil, nil, nil}
 	approvalEventJSON, err := json.Marshal(approvalEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -432,52 +424,64 @@ func (s *Erc20Contract) Approve(ctx contractapi.TransactionContextInterface, spe
 		return fmt.Errorf("failed to set event: %v", err)
 	}
 
-	log.Printf("client %s approved a withdrawal allowance of %d for spender %s", owner, value, spender)
+	log.Printf("client %s approved a withdrawal allowance of %s for spender %s", owner, formatAmount(allowance, decimals), spender)
 
 	return nil
 }
 
-// Allowance returns the amount still available for the spender to withdraw from the owner
-func (s *Erc20Contract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (int, error) {
+// Allowance returns the amount still available for the spender to withdraw from the owner as a decimal string
+// Only the spender, the owner, its bank and the central bank roles can read the allowance of a registered owner
+func (s *Erc20Contract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (string, error) {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
 	}
 	if !initialized {
-		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
-	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	// The spender can read its allowance, others need to be allowed to read the state of the owner
+	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != spender {
+		err = requireAccountReader(ctx, owner)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	// Read the allowance amount from the world state
-	allowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	// Read the allowance amount from the world state, if no current allowance it is 0
+	allowance, err := readAllowance(ctx, owner, spender)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read allowance for %s from world state: %v", allowanceKey, err)
+		return "", err
 	}
 
-	var allowance int
-
-	// If no current allowance, set allowance to 0
-	if allowanceBytes == nil {
-		allowance = 0
-	} else {
-		allowance, err = strconv.Atoi(string(allowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	log.Printf("The allowance left for spender %s to withdraw from owner %s: %d", spender, owner, allowance)
+	log.Printf("The allowance left for spender %s to withdraw from owner %s: %s", spender, owner, formatAmount(allowance, decimals))
 
-	return allowance, nil
+	return formatAmount(allowance, decimals), nil
 }
 
 // TransferFrom transfers the value amount from the "from" address to the "to" address
+// param {String} value The decimal amount to transfer, e.g. "125.50"
+// This function triggers a Transfer event
+func (s *Erc20Contract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value string) error {
+	return s.TransferFromWithRemittance(ctx, from, to, value, Remittance{})
+}
+
+// TransferFromWithRemittance transfers the value amount from the "from" address to the "to" address together with remittance data
+// param {String} value The decimal amount to transfer, e.g. "125.50"
+// param {Remittance} remittance The memo, end-to-end reference and purpose code of the payment, all optional
 // This function triggers a Transfer event
-func (s *Erc20Contract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+func (s *Erc20Contract) TransferFromWithRemittance(ctx contractapi.TransactionContextInterface, from string, to string, value string, remittance Remittance) error {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -494,55 +498,70 @@ func (s *Erc20Contract) TransferFrom(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{from, spender})
+	decimals, err := readDecimals(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return err
 	}
 
-	// Retrieve the allowance of the spender
-	currentAllowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	amount, err := parseAmount(value, decimals)
+	if err != nil {
+		return err
+	}
+
+	// A frozen spender cannot move funds on behalf of others either
+	err = checkNotFrozen(ctx, spender, FreezeOut)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve the allowance for %s from world state: %v", allowanceKey, err)
+		return err
 	}
 
-	var currentAllowance int
-	currentAllowance, _ = strconv.Atoi(string(currentAllowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	// Retrieve the allowance of the spender
+	currentAllowance, err := readAllowance(ctx, from, spender)
+	if err != nil {
+		return err
+	}
 
 	// Check if transferred value is less than allowance
-	if currentAllowance < value {
+	if currentAllowance.Cmp(amount) < 0 {
 		return fmt.Errorf("spender does not have enough allowance for transfer")
 	}
 
+	err = validateRemittance(ctx, remittance)
+	if err != nil {
+		return err
+	}
+
 	// Initiate the transfer
-	err = transferHelper(ctx, from, to, value)
+	err = checkClientRecipient(to)
+	if err != nil {
+		return err
+	}
+
+	// The fee is paid by the owner on top of the amount, it doesn't count against the allowance
+	legs, _, err := transferWithFees(ctx, FeeTransferFrom, from, []payout{{to, amount}})
 	if err != nil {
 		return fmt.Errorf("failed to transfer: %v", err)
 	}
 
 	// Decrease the allowance
-	updatedAllowance, err := sub(currentAllowance, value)
+	updatedAllowance := new(big.Int).Sub(currentAllowance, amount)
+
+	err = writeAllowance(ctx, from, spender, updatedAllowance)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(updatedAllowance)))
+	err = recordTransfer(ctx, from, to, amount, remittance)
 	if err != nil {
 		return err
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{from, to, value}
-	transferEventJSON, err := json.Marshal(transferEvent)
+	err = emitTransferEvent(ctx, event{from, to, formatAmount(amount, decimals), nil, remittanceOrNil(remittance), legs})
 	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
-	}
-	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
-	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return err
 	}
 
-	log.Printf("spender %s allowance updated from %d to %d", spender, currentAllowance, updatedAllowance)
+	log.Printf("spender %s allowance updated from %s to %s", spender, formatAmount(currentAllowance, decimals), formatAmount(updatedAllowance, decimals))
 
 	return nil
 }
@@ -561,6 +580,11 @@ func (s *Erc20Contract) Name(ctx contractapi.TransactionContextInterface) (strin
 		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
+	nameKey, err := metadataKey(ctx, nameField)
+	if err != nil {
+		return "", err
+	}
+
 	bytes, err := ctx.GetStub().GetState(nameKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to get Name bytes: %s", err)
@@ -583,6 +607,11 @@ func (s *Erc20Contract) Symbol(ctx contractapi.TransactionContextInterface) (str
 		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
+	symbolKey, err := metadataKey(ctx, symbolField)
+	if err != nil {
+		return "", err
+	}
+
 	bytes, err := ctx.GetStub().GetState(symbolKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to get Symbol: %v", err)
@@ -591,43 +620,67 @@ func (s *Erc20Contract) Symbol(ctx contractapi.TransactionContextInterface) (str
 	return string(bytes), nil
 }
 
+// Decimals returns the number of decimal places amounts of this token are expressed in.
+// returns {Number} Returns the decimals of the token
+
+func (s *Erc20Contract) Decimals(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return readDecimals(ctx)
+}
+
 // Set information for a token and intialize contract.
 // param {String} name The name of the token
 // param {String} symbol The symbol of the token
-// param {String} decimals The decimals used for the token operations
+// param {String} decimals The decimals used for the token operations, between 0 and 18
 func (s *Erc20Contract) Initialize(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals string) (bool, error) {
 
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to intitialize contract
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check admin authorization - before any ADMIN grant exists only the bootstrap admin MSP may intitialize contract
+	err := requireRole(ctx, RoleAdmin)
 	if err != nil {
-		return false, fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org2MSP" {
-		return false, fmt.Errorf("client is not authorized to initialize contract")
+		return false, fmt.Errorf("client is not authorized to initialize contract: %v", err)
 	}
 
 	// Check contract options are not already set, client is not authorized to change them once intitialized
-	bytes, err := ctx.GetStub().GetState(nameKey)
+	initialized, err := checkInitialized(ctx)
 	if err != nil {
-		return false, fmt.Errorf("failed to get Name: %v", err)
+		return false, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
 	}
-	if bytes != nil {
+	if initialized {
 		return false, fmt.Errorf("contract options are already set, client is not authorized to change them")
 	}
 
-	err = ctx.GetStub().PutState(nameKey, []byte(name))
+	// A ledger written with the flat key layout has to be migrated instead of initialized again
+	legacy, err := ctx.GetStub().GetState(legacyNameKey)
 	if err != nil {
-		return false, fmt.Errorf("failed to set token name: %v", err)
+		return false, fmt.Errorf("failed to check for legacy state: %v", err)
+	}
+	if legacy != nil {
+		return false, fmt.Errorf("ledger holds state in the legacy key layout, call MigrateState() instead")
 	}
 
-	err = ctx.GetStub().PutState(symbolKey, []byte(symbol))
+	_, err = parseDecimals(decimals)
 	if err != nil {
-		return false, fmt.Errorf("failed to set symbol: %v", err)
+		return false, err
 	}
 
-	err = ctx.GetStub().PutState(decimalsKey, []byte(decimals))
+	err = putMetadata(ctx, name, symbol, decimals)
 	if err != nil {
-		return false, fmt.Errorf("failed to set token name: %v", err)
+		return false, err
+	}
+
+	// Record the initializing MSP as the first ADMIN, MINTER and BURNER
+	err = bootstrapRoles(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to bootstrap roles: %v", err)
 	}
 
 	return true, nil
@@ -636,87 +689,279 @@ func (s *Erc20Contract) Initialize(ctx contractapi.TransactionContextInterface,
 // Helper Functions
 
 // transferHelper is a helper function that transfers tokens from the "from" address to the "to" address
+// It returns the waterfall legs the transfer caused, to be included in the Transfer event
 // Dependant functions include Transfer and TransferFrom
-func transferHelper(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+func transferHelper(ctx contractapi.TransactionContextInterface, from string, to string, value *big.Int) ([]transferLeg, error) {
+	return transferToMany(ctx, from, []payout{{to, value}})
+}
+
+// mintHelper creates new tokens in the "to" account and adds them to the total supply
+// Dependant functions include Mint and IssueToBank
+func mintHelper(ctx contractapi.TransactionContextInterface, to string, value *big.Int) error {
+
+	err := checkNotFrozen(ctx, to, FreezeIn)
+	if err != nil {
+		return err
+	}
 
-	if from == to {
-		return fmt.Errorf("cannot transfer to and from same client account")
+	// If the current balance doesn't yet exist, we'll create it with a current balance of 0
+	currentBalance, _, err := readBalance(ctx, to)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", to, err)
 	}
 
-	if value < 0 { // transfer of 0 is allowed in ERC-20, so just validate against negative amounts
-		return fmt.Errorf("transfer amount cannot be negative")
+	updatedBalance := new(big.Int).Add(currentBalance, value)
+
+	err = writeBalance(ctx, to, updatedBalance)
+	if err != nil {
+		return err
 	}
 
-	fromCurrentBalanceBytes, err := ctx.GetStub().GetState(from)
+	// Update the totalSupply
+	totalSupply, err := readTotalSupply(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read client account %s from world state: %v", from, err)
+		return fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
-	if fromCurrentBalanceBytes == nil {
-		return fmt.Errorf("client account %s has no balance", from)
+	// Add the mint amount to the total supply and update the state
+	totalSupply.Add(totalSupply, value)
+
+	err = writeTotalSupply(ctx, totalSupply)
+	if err != nil {
+		return err
 	}
 
-	fromCurrentBalance, _ := strconv.Atoi(string(fromCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	log.Printf("account %s balance updated from %s to %s", to, currentBalance, updatedBalance)
+
+	return nil
+}
+
+// burnHelper destroys tokens of the "from" account and subtracts them from the total supply
+// Dependant functions include Burn and ReturnToCentralBank
+func burnHelper(ctx contractapi.TransactionContextInterface, from string, value *big.Int) error {
 
-	if fromCurrentBalance < value {
-		return fmt.Errorf("client account %s has insufficient funds", from)
+	err := checkNotFrozen(ctx, from, FreezeOut)
+	if err != nil {
+		return err
 	}
 
-	toCurrentBalanceBytes, err := ctx.GetStub().GetState(to)
+	currentBalance, exists, err := readBalance(ctx, from)
 	if err != nil {
-		return fmt.Errorf("failed to read recipient account %s from world state: %v", to, err)
+		return fmt.Errorf("failed to read account %s from world state: %v", from, err)
 	}
 
-	var toCurrentBalance int
-	// If recipient current balance doesn't yet exist, we'll create it with a current balance of 0
-	if toCurrentBalanceBytes == nil {
-		toCurrentBalance = 0
-	} else {
-		toCurrentBalance, _ = strconv.Atoi(string(toCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	// Check if current balance exists
+	if !exists {
+		return errors.New("The balance does not exist")
 	}
 
-	fromUpdatedBalance, err := sub(fromCurrentBalance, value)
-	if err != nil {
-		return err
+	if currentBalance.Cmp(value) < 0 {
+		return fmt.Errorf("account %s has insufficient funds", from)
 	}
 
-	toUpdatedBalance, err := add(toCurrentBalance, value)
+	updatedBalance := new(big.Int).Sub(currentBalance, value)
+
+	err = writeBalance(ctx, from, updatedBalance)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(from, []byte(strconv.Itoa(fromUpdatedBalance)))
+	// Update the totalSupply
+	totalSupply, err := readTotalSupply(ctx)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(to, []byte(strconv.Itoa(toUpdatedBalance)))
+	// Subtract the burn amount to the total supply and update the state
+	if totalSupply.Cmp(value) < 0 {
+		return errors.New("burn amount exceeds total supply")
+	}
+	totalSupply.Sub(totalSupply, value)
+
+	err = writeTotalSupply(ctx, totalSupply)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("client %s balance updated from %d to %d", from, fromCurrentBalance, fromUpdatedBalance)
-	log.Printf("recipient %s balance updated from %d to %d", to, toCurrentBalance, toUpdatedBalance)
+	log.Printf("account %s balance updated from %s to %s", from, currentBalance, updatedBalance)
 
 	return nil
 }
 
-// add two number checking for overflow
-func add(b int, q int) (int, error) {
+// checkClientRecipient rejects client payments to accounts held by the contract, such as escrow accounts,
+// which only the contract itself moves funds to. Bank reserves can be paid into
+func checkClientRecipient(to string) error {
+	if isInternalAccount(to) && !isReserveAccount(to) {
+		return fmt.Errorf("cannot transfer to contract account %s", to)
+	}
 
-	// Check overflow
-	var sum int
-	sum = q + b
+	return nil
+}
+
+// payout is a single credit of a transfer from one account to many
+type payout struct {
+	to    string
+	value *big.Int
+}
+
+// transferToMany transfers tokens from the "from" address to every payout recipient.
+// All balances go through one balance sheet, see balanceSheet: the sender is debited once with the total
+// and every recipient is credited once with the sum of its payouts.
+// Holding caps route part of a credit to the linked deposit account, and a reverse waterfall tops up a short sender,
+// the legs this caused are returned. Earmarked funds of the sender are spent only with recipients their program allows.
+// Nothing is written before every check passed, so a caller can go on after a failed transfer
+// Dependant functions include transferHelper and transferWithFees
+func transferToMany(ctx contractapi.TransactionContextInterface, from string, payouts []payout) ([]transferLeg, error) {
+
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("no recipients to transfer to")
+	}
+
+	total := new(big.Int)
+	largest := new(big.Int)
+	recipients := []string{}
+	credits := make(map[string]*big.Int)
+	for _, p := range payouts {
+		if from == p.to {
+			return nil, fmt.Errorf("cannot transfer to and from same client account")
+		}
+
+		if p.value.Sign() < 0 { // transfer of 0 is allowed in ERC-20, so just validate against negative amounts
+			return nil, fmt.Errorf("transfer amount cannot be negative")
+		}
+
+		total.Add(total, p.value)
+		if p.value.Cmp(largest) > 0 {
+			largest.Set(p.value)
+		}
+
+		if _, ok := credits[p.to]; !ok {
+			recipients = append(recipients, p.to)
+			credits[p.to] = new(big.Int)
+		}
+		credits[p.to].Add(credits[p.to], p.value)
+	}
+
+	err := checkNotPaused(ctx, PauseTransfers)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkNotFrozen(ctx, from, FreezeOut)
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := newBalanceSheet(ctx)
+	legs := []transferLeg{}
+
+	fromCurrentBalance, exists, err := sheet.balance(from)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("client account %s has no balance", from)
+	}
+
+	// Earmarked funds only pay for qualifying recipients, the rest has to be covered by general funds
+	spend, err := allocateEarmarks(ctx, from, recipients, credits)
+	if err != nil {
+		return nil, err
+	}
+
+	generalFunds := new(big.Int).Sub(fromCurrentBalance, spend.held)
+	if generalFunds.Sign() < 0 {
+		generalFunds.SetInt64(0)
+	}
+	shortfall := new(big.Int).Sub(total, spend.used)
+	shortfall.Sub(shortfall, generalFunds)
+	if overall := new(big.Int).Sub(total, fromCurrentBalance); overall.Cmp(shortfall) > 0 {
+		shortfall = overall
+	}
+
+	if shortfall.Sign() > 0 {
+		leg, err := reverseWaterfall(ctx, sheet, from, shortfall)
+		if err != nil {
+			return nil, err
+		}
+		if leg == nil {
+			if spend.held.Sign() > 0 {
+				return nil, fmt.Errorf("client account %s has insufficient funds that can be spent with these recipients", from)
+			}
+			return nil, fmt.Errorf("client account %s has insufficient funds", from)
+		}
+		legs = append(legs, *leg)
+	}
 
-	if (sum < q) == (b >= 0 && q >= 0) {
-		return 0, fmt.Errorf("Math: addition overflow occurred %d + %d", b, q)
+	err = sheet.add(from, new(big.Int).Neg(total))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, to := range recipients {
+		err = checkNotFrozen(ctx, to, FreezeIn)
+		if err != nil {
+			return nil, err
+		}
+
+		err = sheet.add(to, credits[to])
+		if err != nil {
+			return nil, err
+		}
+
+		leg, err := sweepWaterfall(ctx, sheet, to, credits[to])
+		if err != nil {
+			return nil, err
+		}
+		if leg != nil {
+			legs = append(legs, *leg)
+		}
+
+		toUpdatedBalance, _, err := sheet.balance(to)
+		if err != nil {
+			return nil, err
+		}
+
+		// Enforce the KYC registry and the limits of the recipient tier
+		err = checkRecipientLimits(ctx, to, toUpdatedBalance)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return sum, nil
+	// Enforce the limits of the sender tier
+	err = checkSenderLimits(ctx, sheet, from, largest, total)
+	if err != nil {
+		return nil, err
+	}
+
+	sheet.onWrite(func() error {
+		return spendEarmarks(ctx, from, spend)
+	})
+
+	err = sheet.write()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("client %s transferred %s to %d recipients", from, total, len(recipients))
+
+	return legs, nil
+}
+
+// emitTransferEvent emits a Transfer event
+func emitTransferEvent(ctx contractapi.TransactionContextInterface, transferEvent event) error {
+	return emitPaymentEvent(ctx, "Transfer", "", transferEvent, transferEvent.From, transferEvent.To)
 }
 
 // Checks that contract options have been already initialized
 func checkInitialized(ctx contractapi.TransactionContextInterface) (bool, error) {
+	nameKey, err := metadataKey(ctx, nameField)
+	if err != nil {
+		return false, err
+	}
+
 	tokenName, err := ctx.GetStub().GetState(nameKey)
 	if err != nil {
 		return false, fmt.Errorf("failed to get token name: %v", err)
@@ -729,19 +974,6 @@ func checkInitialized(ctx contractapi.TransactionContextInterface) (bool, error)
 	return true, nil
 }
 
-// sub two number checking for overflow
-func sub(b int, q int) (int, error) {
-
-	// Check overflow
-	var diff int
-	diff = b - q
-
-	if (diff > b) == (b >= 0 && q >= 0) {
-		return 0, fmt.Errorf("Math: Subtraction overflow occurred  %d - %d", b, q)
-	}
-
-	return diff, nil
-}
 func (s *Erc20Contract) GetChannelID(ctx contractapi.TransactionContextInterface) string {
 	id := ctx.GetStub().GetChannelID()
 	return id
@@ -758,7 +990,7 @@ func (s *Erc20Contract) GetHistory(ctx contractapi.TransactionContextInterface,
 
 		modification, err := historyIter.Next()
 		if err != nil {
-			return "0", fmt.Errorf("Error in getting History by Key in Iteration", name)
+			return "0", fmt.Errorf("Error in getting History by Key %s in Iteration: %v", name, err)
 		}
 		result += string(modification.Value)
 	}
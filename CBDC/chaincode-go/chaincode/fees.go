@@ -0,0 +1,484 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the operations a fee schedule can be set for
+const (
+	FeeTransfer     = "transfer"
+	FeeTransferFrom = "transferFrom"
+	FeeBatch        = "batch"
+	FeeRedemption   = "redemption"
+)
+
+// CollectorServicingBank stands for the reserve of the payer's servicing bank in the collectors of a fee schedule
+const CollectorServicingBank = "servicingBank"
+
+// Define objectType names for prefix
+const feeSchedulePrefix = "feeSchedule"
+
+var knownFeeOperations = []string{FeeTransfer, FeeTransferFrom, FeeBatch, FeeRedemption}
+
+// FeeTier is a band of payment amounts up to and including UpTo, an empty UpTo leaves the last tier open.
+// The fee of a payment in the tier is Flat plus RateBps basis points of the payment
+type FeeTier struct {
+	UpTo    string `json:"upTo"`
+	Flat    string `json:"flat"`
+	RateBps int    `json:"rateBps"`
+}
+
+// FeeSplit is the share of a fee, in basis points, paid to a collector account
+type FeeSplit struct {
+	Collector string `json:"collector"`
+	ShareBps  int    `json:"shareBps"`
+}
+
+// FeeSchedule is the fee charged on top of every payment of an operation. A single open tier makes a flat or
+// percentage fee, several tiers make a tiered fee and Cap limits the fee of a payment. Accounts of the exempt
+// KYC tiers, and accounts not registered with the KYC registry, don't pay fees
+type FeeSchedule struct {
+	Operation   string     `json:"operation"`
+	Tiers       []FeeTier  `json:"tiers"`
+	Cap         string     `json:"cap"`
+	ExemptTiers []string   `json:"exemptTiers"`
+	Collectors  []FeeSplit `json:"collectors"`
+}
+
+// FeeLine is the part of a fee paid to a collector
+type FeeLine struct {
+	Collector string `json:"collector"`
+	Amount    string `json:"amount"`
+}
+
+// FeeQuote is the fee a payer would be charged for a payment
+type FeeQuote struct {
+	Operation string    `json:"operation"`
+	Payer     string    `json:"payer"`
+	Amount    string    `json:"amount"`
+	Fee       string    `json:"fee"`
+	Total     string    `json:"total"`
+	Lines     []FeeLine `json:"lines"`
+}
+
+// SetFeeSchedule sets the fee charged on an operation, replacing the previous schedule of the operation
+// This function triggers a FeeScheduleSet event
+func (s *Erc20Contract) SetFeeSchedule(ctx contractapi.TransactionContextInterface, schedule FeeSchedule) error {
+
+	err := requireRole(ctx, RolePolicy)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set fee schedules: %v", err)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = validateFeeSchedule(&schedule, decimals)
+	if err != nil {
+		return err
+	}
+
+	err = checkFeeCollectors(ctx, &schedule)
+	if err != nil {
+		return err
+	}
+
+	key, err := compositeKey(ctx, feeSchedulePrefix, schedule.Operation)
+	if err != nil {
+		return err
+	}
+
+	err = putJSON(ctx, key, schedule)
+	if err != nil {
+		return err
+	}
+
+	scheduleJSON, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("FeeScheduleSet", scheduleJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("fee schedule of %s set with %d tiers", schedule.Operation, len(schedule.Tiers))
+
+	return nil
+}
+
+// RemoveFeeSchedule stops charging fees on an operation
+// This function triggers a FeeScheduleRemoved event
+func (s *Erc20Contract) RemoveFeeSchedule(ctx contractapi.TransactionContextInterface, operation string) error {
+
+	err := requireRole(ctx, RolePolicy)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to remove fee schedules: %v", err)
+	}
+
+	schedule, err := readFeeSchedule(ctx, operation)
+	if err != nil {
+		return err
+	}
+	if schedule == nil {
+		return fmt.Errorf("no fee schedule is set for %s", operation)
+	}
+
+	key, err := compositeKey(ctx, feeSchedulePrefix, operation)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to remove fee schedule of %s: %v", operation, err)
+	}
+
+	scheduleJSON, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("FeeScheduleRemoved", scheduleJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("fee schedule of %s removed", operation)
+
+	return nil
+}
+
+// GetFeeSchedule returns the fee schedule of an operation
+func (s *Erc20Contract) GetFeeSchedule(ctx contractapi.TransactionContextInterface, operation string) (*FeeSchedule, error) {
+
+	schedule, err := readFeeSchedule(ctx, operation)
+	if err != nil {
+		return nil, err
+	}
+	if schedule == nil {
+		return nil, fmt.Errorf("no fee schedule is set for %s", operation)
+	}
+
+	return schedule, nil
+}
+
+// QuoteFee returns the fee a payer would be charged for a payment of amount, without charging it
+// param {String} payer The paying account, the client account when empty
+// param {String} amount The decimal amount of the payment, e.g. "125.50"
+func (s *Erc20Contract) QuoteFee(ctx contractapi.TransactionContextInterface, operation string, payer string, amount string) (*FeeQuote, error) {
+
+	if payer == "" {
+		clientID, err := ctx.GetClientIdentity().GetID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client id: %v", err)
+		}
+		payer = clientID
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, fees, err := assessFees(ctx, operation, payer, []*big.Int{value})
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &FeeQuote{
+		Operation: operation,
+		Payer:     payer,
+		Amount:    formatAmount(value, decimals),
+		Fee:       formatAmount(fee, decimals),
+		Total:     formatAmount(new(big.Int).Add(value, fee), decimals),
+		Lines:     []FeeLine{},
+	}
+	for _, p := range fees {
+		quote.Lines = append(quote.Lines, FeeLine{p.to, formatAmount(p.value, decimals)})
+	}
+
+	return quote, nil
+}
+
+// Helper Functions
+
+// transferWithFees transfers the payouts of an operation together with the fees charged on each of them.
+// The fees go through the same balance sheet, so the payment and its fees are written together or not at all.
+// It returns the fee charged and the legs of the transfer, which include one leg per fee collector
+func transferWithFees(ctx contractapi.TransactionContextInterface, operation string, from string, payouts []payout) ([]transferLeg, *big.Int, error) {
+	values := make([]*big.Int, len(payouts))
+	for i, p := range payouts {
+		values[i] = p.value
+	}
+
+	fee, fees, err := assessFees(ctx, operation, from, values)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	legs, err := transferToMany(ctx, from, append(append([]payout{}, payouts...), fees...))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(fees) == 0 {
+		return legs, fee, nil
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range fees {
+		legs = append(legs, transferLeg{from, p.to, formatAmount(p.value, decimals)})
+	}
+
+	return legs, fee, nil
+}
+
+// assessFees returns the fee a payer is charged on payments of an operation and the payouts splitting it
+// among the collectors. The fee of every payment is computed on its own, as a batch is charged per payment
+func assessFees(ctx contractapi.TransactionContextInterface, operation string, payer string, values []*big.Int) (*big.Int, []payout, error) {
+	err := validateFeeOperation(operation)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	schedule, err := readFeeSchedule(ctx, operation)
+	if err != nil || schedule == nil {
+		return new(big.Int), nil, err
+	}
+
+	// Internal accounts and unregistered accounts, such as the minter, don't pay fees
+	registered, err := readAccount(ctx, payer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if isInternalAccount(payer) || registered == nil || containsString(schedule.ExemptTiers, registered.Tier) {
+		return new(big.Int), nil, nil
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fee := new(big.Int)
+	for _, value := range values {
+		paymentFee, err := scheduleFee(schedule, value, decimals)
+		if err != nil {
+			return nil, nil, err
+		}
+		fee.Add(fee, paymentFee)
+	}
+
+	// Every collector gets its share rounded down, the rounding remainder goes to the first collector
+	fees := []payout{}
+	remainder := new(big.Int).Set(fee)
+	for _, split := range schedule.Collectors {
+		collector := split.Collector
+		if collector == CollectorServicingBank {
+			collector = reserveAccount(registered.Bank)
+		}
+
+		share := new(big.Int).Mul(fee, big.NewInt(int64(split.ShareBps)))
+		share.Quo(share, basisPoints)
+		remainder.Sub(remainder, share)
+
+		fees = append(fees, payout{collector, share})
+	}
+	fees[0].value.Add(fees[0].value, remainder)
+
+	// A collector paying a fee would pay itself, so its share is waived
+	charged := new(big.Int)
+	payouts := []payout{}
+	for _, p := range fees {
+		if p.value.Sign() == 0 || p.to == payer {
+			continue
+		}
+		charged.Add(charged, p.value)
+		payouts = append(payouts, p)
+	}
+
+	return charged, payouts, nil
+}
+
+// scheduleFee returns the fee of a single payment, from the first tier the payment falls in
+func scheduleFee(schedule *FeeSchedule, value *big.Int, decimals int) (*big.Int, error) {
+	tier := schedule.Tiers[len(schedule.Tiers)-1]
+	for _, t := range schedule.Tiers {
+		if t.UpTo == "" {
+			break
+		}
+		upTo, err := parseAmount(t.UpTo, decimals)
+		if err != nil {
+			return nil, err
+		}
+		if value.Cmp(upTo) <= 0 {
+			tier = t
+			break
+		}
+	}
+
+	fee, err := parseLimit(tier.Flat, decimals)
+	if err != nil {
+		return nil, err
+	}
+	if fee == nil {
+		fee = new(big.Int)
+	}
+
+	percentage := new(big.Int).Mul(value, big.NewInt(int64(tier.RateBps)))
+	fee.Add(fee, percentage.Quo(percentage, basisPoints))
+
+	feeCap, err := parseLimit(schedule.Cap, decimals)
+	if err != nil {
+		return nil, err
+	}
+	if feeCap != nil && fee.Cmp(feeCap) > 0 {
+		fee.Set(feeCap)
+	}
+
+	return fee, nil
+}
+
+// validateFeeSchedule checks the tiers are in ascending order, the amounts are valid and the collector shares add up to 100%
+func validateFeeSchedule(schedule *FeeSchedule, decimals int) error {
+	err := validateFeeOperation(schedule.Operation)
+	if err != nil {
+		return err
+	}
+
+	if len(schedule.Tiers) == 0 {
+		return fmt.Errorf("a fee schedule needs at least one tier")
+	}
+	previous := new(big.Int)
+	for i, tier := range schedule.Tiers {
+		if tier.UpTo == "" && i != len(schedule.Tiers)-1 {
+			return fmt.Errorf("only the last fee tier can be open")
+		}
+		if tier.UpTo != "" {
+			upTo, err := parseAmount(tier.UpTo, decimals)
+			if err != nil {
+				return fmt.Errorf("invalid upper bound of fee tier %d: %v", i+1, err)
+			}
+			if i > 0 && upTo.Cmp(previous) <= 0 {
+				return fmt.Errorf("fee tiers must be in ascending order")
+			}
+			previous = upTo
+		}
+		_, err = parseLimit(tier.Flat, decimals)
+		if err != nil {
+			return fmt.Errorf("invalid flat fee of tier %d: %v", i+1, err)
+		}
+		if tier.RateBps < 0 || tier.RateBps > 10000 {
+			return fmt.Errorf("fee rate of tier %d must be between 0 and 10000 basis points", i+1)
+		}
+	}
+
+	_, err = parseLimit(schedule.Cap, decimals)
+	if err != nil {
+		return fmt.Errorf("invalid fee cap: %v", err)
+	}
+
+	for _, tier := range schedule.ExemptTiers {
+		err = validateTier(tier)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(schedule.Collectors) == 0 {
+		return fmt.Errorf("a fee schedule needs at least one collector")
+	}
+	shares := 0
+	for _, split := range schedule.Collectors {
+		if split.ShareBps <= 0 {
+			return fmt.Errorf("share of collector %s must be positive", split.Collector)
+		}
+		if split.Collector != CollectorServicingBank {
+			err = checkClientRecipient(split.Collector)
+			if err != nil {
+				return fmt.Errorf("invalid fee collector: %v", err)
+			}
+		}
+		shares += split.ShareBps
+	}
+	if shares != 10000 {
+		return fmt.Errorf("collector shares must add up to 10000 basis points, got %d", shares)
+	}
+
+	return nil
+}
+
+// checkFeeCollectors checks every collector of a schedule can be credited, otherwise each payment charged
+// a fee would fail on it. Collectors must be bank reserves or registered accounts not frozen for incoming funds
+func checkFeeCollectors(ctx contractapi.TransactionContextInterface, schedule *FeeSchedule) error {
+	for _, split := range schedule.Collectors {
+		if split.Collector == CollectorServicingBank {
+			continue
+		}
+
+		if !isInternalAccount(split.Collector) {
+			account, err := readAccount(ctx, split.Collector)
+			if err != nil {
+				return err
+			}
+			if account == nil {
+				return fmt.Errorf("fee collector %s is not registered by a licensed bank", split.Collector)
+			}
+		}
+
+		err := checkNotFrozen(ctx, split.Collector, FreezeIn)
+		if err != nil {
+			return fmt.Errorf("invalid fee collector: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func validateFeeOperation(operation string) error {
+	if !containsString(knownFeeOperations, operation) {
+		return fmt.Errorf("unknown fee operation %s, must be one of %s", operation, strings.Join(knownFeeOperations, ", "))
+	}
+
+	return nil
+}
+
+// readFeeSchedule returns the fee schedule of an operation, or nil when no fee is charged on it
+func readFeeSchedule(ctx contractapi.TransactionContextInterface, operation string) (*FeeSchedule, error) {
+	key, err := compositeKey(ctx, feeSchedulePrefix, operation)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduleBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fee schedule of %s from world state: %v", operation, err)
+	}
+	if scheduleBytes == nil {
+		return nil, nil
+	}
+
+	schedule := new(FeeSchedule)
+	err = json.Unmarshal(scheduleBytes, schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode fee schedule of %s: %v", operation, err)
+	}
+
+	return schedule, nil
+}
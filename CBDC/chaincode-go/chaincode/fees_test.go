@@ -0,0 +1,99 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestFeeSchedule(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial)
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RolePolicy, MemberTypeClient, centralBank))
+
+	// Unregistered payers such as the minter don't pay fees
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "500"))
+
+	schedule := FeeSchedule{
+		Operation:  FeeTransfer,
+		Tiers:      []FeeTier{{UpTo: "100", Flat: "1"}, {RateBps: 100}},
+		Cap:        "5",
+		Collectors: []FeeSplit{{CollectorServicingBank, 7000}, {reserveAccount("Org2MSP"), 3000}},
+	}
+	mustFail(t, contract.SetFeeSchedule(ledger.as(customer, "Org1MSP"), schedule))
+	invalid := schedule
+	invalid.Collectors = []FeeSplit{{CollectorServicingBank, 9000}}
+	mustFail(t, contract.SetFeeSchedule(ledger.as(centralBank, "Org2MSP"), invalid))
+	invalid = schedule
+	invalid.Tiers = []FeeTier{{UpTo: "100", Flat: "1"}, {UpTo: "50", RateBps: 100}}
+	mustFail(t, contract.SetFeeSchedule(ledger.as(centralBank, "Org2MSP"), invalid))
+
+	// Collectors that can't be credited would make every payment charged a fee fail
+	invalid = schedule
+	invalid.Collectors = []FeeSplit{{CollectorServicingBank, 7000}, {centralBank, 3000}}
+	mustFail(t, contract.SetFeeSchedule(ledger.as(centralBank, "Org2MSP"), invalid))
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleRegulator, MemberTypeMSP, "Org2MSP"))
+	mustSucceed(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), commercial, FreezeIn, "fraud", "case 17/2023"))
+	invalid.Collectors = []FeeSplit{{CollectorServicingBank, 7000}, {commercial, 3000}}
+	mustFail(t, contract.SetFeeSchedule(ledger.as(centralBank, "Org2MSP"), invalid))
+	mustSucceed(t, contract.UnfreezeAccount(ledger.as(centralBank, "Org2MSP"), commercial, "case 17/2023"))
+
+	mustSucceed(t, contract.SetFeeSchedule(ledger.as(centralBank, "Org2MSP"), schedule))
+	if name := ledger.lastEvent(); name != "FeeScheduleSet" {
+		t.Fatalf("expected FeeScheduleSet event, got %q", name)
+	}
+
+	for amount, expected := range map[string]string{"50": "1.00", "200": "2.00", "1000": "5.00"} {
+		quote, err := contract.QuoteFee(ledger.as(customer, "Org1MSP"), FeeTransfer, "", amount)
+		mustSucceed(t, err)
+		if quote.Fee != expected {
+			t.Fatalf("expected fee %s on %s, got %s", expected, amount, quote.Fee)
+		}
+	}
+	quote, err := contract.QuoteFee(ledger.as(customer, "Org1MSP"), FeeTransfer, "", "200")
+	mustSucceed(t, err)
+	if quote.Total != "202.00" || len(quote.Lines) != 2 || quote.Lines[0].Collector != reserveAccount("Org1MSP") || quote.Lines[0].Amount != "1.40" {
+		t.Fatalf("unexpected quote %+v", quote)
+	}
+
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "200"))
+
+	// Payment and fee are charged together, a payment the fee can't be paid for fails as a whole
+	mustFail(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "297"))
+
+	// Fees of a batch are charged per payment
+	mustSucceed(t, contract.SetFeeSchedule(ledger.as(centralBank, "Org2MSP"), FeeSchedule{
+		Operation:  FeeBatch,
+		Tiers:      []FeeTier{{Flat: "0.50"}},
+		Collectors: []FeeSplit{{CollectorServicingBank, 10000}},
+	}))
+	mustSucceed(t, contract.TransferBatch(ledger.as(customer, "Org1MSP"), []BatchPayment{{Recipient: commercial, Amount: "10"}, {Recipient: commercial, Amount: "20"}}))
+
+	// Funds locked for a payment are charged like a transfer
+	hashlock := sha256.Sum256([]byte("secret"))
+	_, err = contract.LockPayment(ledger.as(customer, "Org1MSP"), commercial, "50", hex.EncodeToString(hashlock[:]), ledger.now.Add(time.Hour).Unix())
+	mustSucceed(t, err)
+
+	// Exempt tiers pay nothing
+	schedule.ExemptTiers = []string{TierFull}
+	mustSucceed(t, contract.SetFeeSchedule(ledger.as(centralBank, "Org2MSP"), schedule))
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "10"))
+
+	mustSucceed(t, contract.RemoveFeeSchedule(ledger.as(centralBank, "Org2MSP"), FeeBatch))
+	_, err = contract.GetFeeSchedule(ledger.as(customer, "Org1MSP"), FeeBatch)
+	mustFail(t, err)
+
+	expected := map[string]string{
+		customer:                  "206.00",
+		commercial:                "240.00",
+		reserveAccount("Org1MSP"): "3.10",
+		reserveAccount("Org2MSP"): "0.90",
+	}
+	for account, balance := range expected {
+		actual, err := contract.BalanceOf(ledger.as(centralBank, "Org2MSP"), account)
+		mustSucceed(t, err)
+		if actual != balance {
+			t.Fatalf("expected balance %s, got %s", balance, actual)
+		}
+	}
+}
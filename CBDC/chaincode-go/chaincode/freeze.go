@@ -0,0 +1,234 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the directions of funds a freeze can block
+const (
+	FreezeIn   = "in"
+	FreezeOut  = "out"
+	FreezeBoth = "both"
+)
+
+// Define objectType names for prefix
+const freezePrefix = "freeze"
+
+// Freeze records a regulator freeze of an account together with its legal basis
+type Freeze struct {
+	Account   string    `json:"account"`
+	Direction string    `json:"direction"`
+	Reason    string    `json:"reason"`
+	Reference string    `json:"reference"`
+	FrozenBy  string    `json:"frozenBy"`
+	FrozenAt  time.Time `json:"frozenAt"`
+}
+
+// freezeEvent provides an organized struct for emitting freeze events
+type freezeEvent struct {
+	Account   string `json:"account"`
+	Direction string `json:"direction"`
+	Reason    string `json:"reason"`
+	Reference string `json:"reference"`
+	Sender    string `json:"sender"`
+}
+
+// FreezeAccount blocks incoming funds, outgoing funds or both for an account
+// param {String} direction "in", "out" or "both"
+// param {String} reason The reason of the freeze, e.g. "fraud investigation"
+// param {String} reference The legal reference of the freeze, e.g. a court order number
+// Freezing an already frozen account replaces the previous freeze
+// This function triggers an AccountFrozen event
+func (s *Erc20Contract) FreezeAccount(ctx contractapi.TransactionContextInterface, account string, direction string, reason string, reference string) error {
+
+	err := requireRole(ctx, RoleRegulator)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to freeze accounts: %v", err)
+	}
+
+	if account == "" {
+		return fmt.Errorf("account must not be empty")
+	}
+	if direction != FreezeIn && direction != FreezeOut && direction != FreezeBoth {
+		return fmt.Errorf("unknown freeze direction %s, expected %s, %s or %s", direction, FreezeIn, FreezeOut, FreezeBoth)
+	}
+	if reference == "" {
+		return fmt.Errorf("a legal reference is required to freeze an account")
+	}
+
+	sender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	freeze := Freeze{account, direction, reason, reference, sender, now}
+
+	key, err := compositeKey(ctx, freezePrefix, account)
+	if err != nil {
+		return err
+	}
+
+	freezeJSON, err := json.Marshal(freeze)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, freezeJSON)
+	if err != nil {
+		return fmt.Errorf("failed to freeze account %s: %v", account, err)
+	}
+
+	err = emitFreezeEvent(ctx, "AccountFrozen", freezeEvent{account, direction, reason, reference, sender})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("account %s frozen (%s) under reference %s", account, direction, reference)
+
+	return nil
+}
+
+// UnfreezeAccount lifts the freeze of an account
+// param {String} reference The legal reference of the release, e.g. a court decision number
+// This function triggers an AccountUnfrozen event
+func (s *Erc20Contract) UnfreezeAccount(ctx contractapi.TransactionContextInterface, account string, reference string) error {
+
+	err := requireRole(ctx, RoleRegulator)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to unfreeze accounts: %v", err)
+	}
+
+	freeze, err := readFreeze(ctx, account)
+	if err != nil {
+		return err
+	}
+	if freeze == nil {
+		return fmt.Errorf("account %s is not frozen", account)
+	}
+
+	key, err := compositeKey(ctx, freezePrefix, account)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to unfreeze account %s: %v", account, err)
+	}
+
+	sender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	err = emitFreezeEvent(ctx, "AccountUnfrozen", freezeEvent{account, freeze.Direction, "", reference, sender})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("account %s unfrozen under reference %s", account, reference)
+
+	return nil
+}
+
+// ListFrozenAccounts returns all currently frozen accounts with the legal references of their freezes
+func (s *Erc20Contract) ListFrozenAccounts(ctx contractapi.TransactionContextInterface) ([]Freeze, error) {
+
+	err := requireRole(ctx, RoleRegulator, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to list frozen accounts: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(freezePrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read frozen accounts from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	freezes := []Freeze{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var freeze Freeze
+		err = json.Unmarshal(queryResponse.Value, &freeze)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode freeze %s: %v", queryResponse.Key, err)
+		}
+		freezes = append(freezes, freeze)
+	}
+
+	return freezes, nil
+}
+
+// Helper Functions
+
+// checkNotFrozen fails when the account is frozen for the given direction of funds
+func checkNotFrozen(ctx contractapi.TransactionContextInterface, account string, direction string) error {
+	freeze, err := readFreeze(ctx, account)
+	if err != nil {
+		return err
+	}
+	if freeze == nil {
+		return nil
+	}
+
+	if freeze.Direction == FreezeBoth || freeze.Direction == direction {
+		if direction == FreezeIn {
+			return fmt.Errorf("account %s is frozen for incoming funds under reference %s", account, freeze.Reference)
+		}
+		return fmt.Errorf("account %s is frozen for outgoing funds under reference %s", account, freeze.Reference)
+	}
+
+	return nil
+}
+
+// readFreeze returns the freeze of an account, or nil when the account is not frozen
+func readFreeze(ctx contractapi.TransactionContextInterface, account string) (*Freeze, error) {
+	key, err := compositeKey(ctx, freezePrefix, account)
+	if err != nil {
+		return nil, err
+	}
+
+	freezeBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read freeze of account %s from world state: %v", account, err)
+	}
+	if freezeBytes == nil {
+		return nil, nil
+	}
+
+	freeze := new(Freeze)
+	err = json.Unmarshal(freezeBytes, freeze)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode freeze of account %s: %v", account, err)
+	}
+
+	return freeze, nil
+}
+
+// emitFreezeEvent emits an AccountFrozen or AccountUnfrozen event
+func emitFreezeEvent(ctx contractapi.TransactionContextInterface, name string, e freezeEvent) error {
+	eventJSON, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package chaincode
+
+import "testing"
+
+func TestFreezeAccount(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial)
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleRegulator, MemberTypeMSP, "Org2MSP"))
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "100"))
+
+	mustFail(t, contract.FreezeAccount(ledger.as(commercial, "Org1MSP"), customer, FreezeOut, "fraud", "case 17/2023"))
+	mustFail(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, "sideways", "fraud", "case 17/2023"))
+	mustFail(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, FreezeOut, "fraud", ""))
+
+	mustSucceed(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, FreezeOut, "fraud", "case 17/2023"))
+	if name := ledger.lastEvent(); name != "AccountFrozen" {
+		t.Fatalf("expected AccountFrozen event, got %q", name)
+	}
+
+	// Outgoing funds are blocked, incoming funds still arrive
+	mustFail(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "10"))
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "10"))
+
+	// Allowances granted by or to a frozen account cannot be used to move funds out
+	mustSucceed(t, contract.Approve(ledger.as(customer, "Org1MSP"), commercial, "50"))
+	mustFail(t, contract.TransferFrom(ledger.as(commercial, "Org1MSP"), customer, commercial, "10"))
+
+	mustSucceed(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, FreezeBoth, "fraud", "case 17/2023"))
+	mustFail(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "10"))
+
+	frozen, err := contract.ListFrozenAccounts(ledger.as(centralBank, "Org2MSP"))
+	mustSucceed(t, err)
+	if len(frozen) != 1 || frozen[0].Reference != "case 17/2023" || frozen[0].Direction != FreezeBoth {
+		t.Fatalf("unexpected frozen accounts %+v", frozen)
+	}
+
+	mustSucceed(t, contract.UnfreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, "decision 3/2023"))
+	mustFail(t, contract.UnfreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, "decision 3/2023"))
+	mustSucceed(t, contract.TransferFrom(ledger.as(commercial, "Org1MSP"), customer, commercial, "10"))
+
+	// A frozen burner cannot burn its balance
+	mustSucceed(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), centralBank, FreezeOut, "audit", "order 5"))
+	mustFail(t, contract.Burn(ledger.as(centralBank, "Org2MSP"), "1"))
+}
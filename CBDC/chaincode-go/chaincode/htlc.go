@@ -0,0 +1,340 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the statuses of a hash time-locked payment
+const (
+	LockLocked   = "locked"
+	LockClaimed  = "claimed"
+	LockRefunded = "refunded"
+)
+
+// Define objectType names for prefix
+const lockPrefix = "htlc"
+
+// LockedPayment is a payment held in escrow until the recipient reveals the preimage of the hashlock,
+// or returned to the sender once the timelock passed
+type LockedPayment struct {
+	ID        string    `json:"id"`
+	Sender    string    `json:"sender"`
+	Recipient string    `json:"recipient"`
+	Amount    string    `json:"amount"`
+	Hashlock  string    `json:"hashlock"`
+	Timelock  time.Time `json:"timelock"`
+	Status    string    `json:"status"`
+	Preimage  string    `json:"preimage,omitempty"`
+	Escrow    string    `json:"escrow,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// LockPayment moves tokens of the client account into escrow for recipient until the preimage of hashlock is revealed
+// param {String} recipient The account that receives the tokens on ClaimPayment
+// param {String} amount The decimal amount to lock, e.g. "125.50"
+// param {String} hashlock The hex encoded SHA-256 hash of the secret preimage
+// param {int64} timelock The Unix time in seconds from which the payment can no longer be claimed and can be refunded
+// returns {String} The ID of the lock
+// This function triggers a PaymentLocked event
+func (s *Erc20Contract) LockPayment(ctx contractapi.TransactionContextInterface, recipient string, amount string, hashlock string, timelock int64) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = checkClientRecipient(recipient)
+	if err != nil {
+		return "", err
+	}
+
+	hashlock = strings.ToLower(hashlock)
+	hashBytes, err := hex.DecodeString(hashlock)
+	if err != nil || len(hashBytes) != sha256.Size {
+		return "", fmt.Errorf("hashlock must be a hex encoded SHA-256 hash")
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return "", err
+	}
+	if value.Sign() <= 0 {
+		return "", fmt.Errorf("lock amount must be positive")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	expiry := time.Unix(timelock, 0).UTC()
+	if !expiry.After(now) {
+		return "", fmt.Errorf("timelock must be in the future")
+	}
+
+	if clientID == recipient {
+		return "", fmt.Errorf("cannot lock a payment to the client account itself")
+	}
+
+	id := ctx.GetStub().GetTxID()
+	escrow, err := escrowAccount(ctx, lockPrefix, id, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	lock := &LockedPayment{
+		ID:        id,
+		Sender:    clientID,
+		Recipient: recipient,
+		Amount:    formatAmount(value, decimals),
+		Hashlock:  hashlock,
+		Timelock:  expiry,
+		Status:    LockLocked,
+		Escrow:    escrow,
+		CreatedAt: now,
+	}
+
+	_, _, err = transferWithFees(ctx, FeeTransfer, clientID, []payout{{escrow, value}})
+	if err != nil {
+		return "", fmt.Errorf("failed to lock payment: %v", err)
+	}
+
+	err = putLock(ctx, lock)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitLockEvent(ctx, "PaymentLocked", lock)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("client %s locked %s for %s until %s, lock %s", clientID, lock.Amount, recipient, expiry, id)
+
+	return id, nil
+}
+
+// ClaimPayment releases a locked payment to its recipient, any client that knows the preimage can claim it
+// before the timelock. The revealed preimage is part of the event so the sender can use it on another ledger
+// param {String} preimage The hex encoded secret whose SHA-256 hash is the hashlock
+// This function triggers a PaymentClaimed event
+func (s *Erc20Contract) ClaimPayment(ctx contractapi.TransactionContextInterface, lockID string, preimage string) error {
+
+	lock, err := readActiveLock(ctx, lockID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !now.Before(lock.Timelock) {
+		return fmt.Errorf("lock %s expired at %s, the sender can refund it", lockID, lock.Timelock)
+	}
+
+	preimageBytes, err := hex.DecodeString(preimage)
+	if err != nil {
+		return fmt.Errorf("preimage must be hex encoded")
+	}
+	hash := sha256.Sum256(preimageBytes)
+	if hex.EncodeToString(hash[:]) != lock.Hashlock {
+		return fmt.Errorf("preimage does not match the hashlock of lock %s", lockID)
+	}
+
+	err = releaseLock(ctx, lock, lock.Recipient, LockClaimed)
+	if err != nil {
+		return err
+	}
+
+	lock.Preimage = strings.ToLower(preimage)
+
+	err = putLock(ctx, lock)
+	if err != nil {
+		return err
+	}
+
+	err = emitLockEvent(ctx, "PaymentClaimed", lock)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("lock %s of %s claimed by %s", lockID, lock.Amount, lock.Recipient)
+
+	return nil
+}
+
+// RefundLockedPayment returns a locked payment that was not claimed before its timelock to the sender,
+// any client can trigger the refund
+// This function triggers a PaymentRefunded event
+func (s *Erc20Contract) RefundLockedPayment(ctx contractapi.TransactionContextInterface, lockID string) error {
+
+	lock, err := readActiveLock(ctx, lockID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now.Before(lock.Timelock) {
+		return fmt.Errorf("lock %s can't be refunded before %s", lockID, lock.Timelock)
+	}
+
+	err = releaseLock(ctx, lock, lock.Sender, LockRefunded)
+	if err != nil {
+		return err
+	}
+
+	err = putLock(ctx, lock)
+	if err != nil {
+		return err
+	}
+
+	err = emitLockEvent(ctx, "PaymentRefunded", lock)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("lock %s of %s refunded to %s", lockID, lock.Amount, lock.Sender)
+
+	return nil
+}
+
+// GetLockedPayment returns a hash time-locked payment.
+// Only its parties, their banks and the central bank roles can read a lock of registered accounts
+func (s *Erc20Contract) GetLockedPayment(ctx contractapi.TransactionContextInterface, lockID string) (*LockedPayment, error) {
+	lock, err := readLock(ctx, lockID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireRecordReader(ctx, lock.Sender, lock.Recipient)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to read lock %s: %v", lockID, err)
+	}
+
+	return lock, nil
+}
+
+// Helper Functions
+
+// lockEscrow returns the account holding the tokens of a hash time-locked payment until it is claimed or refunded
+func lockEscrow(lock *LockedPayment) string {
+	if lock.Escrow == "" {
+		return internalAccount(lockPrefix, lock.ID)
+	}
+
+	return lock.Escrow
+}
+
+// readActiveLock returns a hash time-locked payment that was neither claimed nor refunded
+func readActiveLock(ctx contractapi.TransactionContextInterface, lockID string) (*LockedPayment, error) {
+	lock, err := readLock(ctx, lockID)
+	if err != nil {
+		return nil, err
+	}
+	if lock.Status != LockLocked {
+		return nil, fmt.Errorf("lock %s is %s", lockID, lock.Status)
+	}
+
+	return lock, nil
+}
+
+// releaseLock transfers the escrowed tokens of a lock to an account and sets its final status.
+// Tokens going back to the sender are returned with returnEscrow
+func releaseLock(ctx contractapi.TransactionContextInterface, lock *LockedPayment, to string, status string) error {
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(lock.Amount, decimals)
+	if err != nil {
+		return err
+	}
+
+	if to == lock.Sender {
+		err = returnEscrow(ctx, "", lockEscrow(lock), to, value)
+	} else {
+		_, err = transferHelper(ctx, lockEscrow(lock), to, value)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %v", lock.ID, err)
+	}
+
+	lock.Status = status
+
+	return nil
+}
+
+func readLock(ctx contractapi.TransactionContextInterface, lockID string) (*LockedPayment, error) {
+	key, err := compositeKey(ctx, lockPrefix, lockID)
+	if err != nil {
+		return nil, err
+	}
+
+	lockBytes, err := readRecord(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock %s: %v", lockID, err)
+	}
+	if lockBytes == nil {
+		return nil, fmt.Errorf("lock %s does not exist", lockID)
+	}
+
+	lock := new(LockedPayment)
+	err = json.Unmarshal(lockBytes, lock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode lock %s: %v", lockID, err)
+	}
+
+	return lock, nil
+}
+
+func putLock(ctx contractapi.TransactionContextInterface, lock *LockedPayment) error {
+	key, err := compositeKey(ctx, lockPrefix, lock.ID)
+	if err != nil {
+		return err
+	}
+
+	lockJSON, err := json.Marshal(lock)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putRecord(ctx, key, lockJSON, lock.Sender, lock.Recipient)
+	if err != nil {
+		return fmt.Errorf("failed to update lock %s: %v", lock.ID, err)
+	}
+
+	return nil
+}
+
+// emitLockEvent emits a hash time-locked payment event carrying the lock
+func emitLockEvent(ctx contractapi.TransactionContextInterface, name string, lock *LockedPayment) error {
+	return emitPaymentEvent(ctx, name, lock.ID, lock, lock.Sender, lock.Recipient)
+}
@@ -0,0 +1,85 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestHashTimeLockedPayment(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, centralBank)
+
+	preimage := hex.EncodeToString([]byte("settlement secret"))
+	hash := sha256.Sum256([]byte("settlement secret"))
+	hashlock := hex.EncodeToString(hash[:])
+	timelock := ledger.now.Add(time.Hour).Unix()
+
+	_, err := contract.LockPayment(ledger.as(centralBank, "Org2MSP"), customer, "100", "not a hash", timelock)
+	mustFail(t, err)
+	_, err = contract.LockPayment(ledger.as(centralBank, "Org2MSP"), customer, "100", hashlock, ledger.now.Unix())
+	mustFail(t, err)
+
+	claimed, err := contract.LockPayment(ledger.as(centralBank, "Org2MSP"), customer, "100", hashlock, timelock)
+	mustSucceed(t, err)
+	if name := ledger.lastEvent(); name != "PaymentLocked" {
+		t.Fatalf("expected PaymentLocked event, got %q", name)
+	}
+
+	// Locked funds are no longer spendable by the sender
+	balance, err := contract.BalanceOf(ledger.as(centralBank, "Org2MSP"), centralBank)
+	mustSucceed(t, err)
+	if balance != "900.00" {
+		t.Fatalf("expected balance 900.00, got %s", balance)
+	}
+
+	// The lock and its escrow are kept in the collection of the bank of the parties
+	ctx := ledger.as(centralBank, "Org2MSP")
+	lockKey, err := compositeKey(ctx, lockPrefix, claimed)
+	mustSucceed(t, err)
+	if ledger.stub.State[lockKey] != nil || ledger.stub.PvtState[balancesCollection("Org1MSP")][lockKey] == nil {
+		t.Fatalf("expected the lock in the collection of the bank only")
+	}
+	attestation, err := contract.AttestSupply(ctx)
+	mustSucceed(t, err)
+	if !attestation.Balanced || attestation.PublicBalances != "0.00" {
+		t.Fatalf("unexpected attestation %+v", attestation)
+	}
+	other := clientID("CN=user1,OU=client,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org3.example.com")
+	_, err = contract.GetLockedPayment(ledger.as(other, "Org3MSP"), claimed)
+	mustFail(t, err)
+
+	mustFail(t, contract.ClaimPayment(ledger.as(customer, "Org1MSP"), claimed, hex.EncodeToString([]byte("wrong secret"))))
+	mustFail(t, contract.RefundLockedPayment(ledger.as(centralBank, "Org2MSP"), claimed))
+	mustSucceed(t, contract.ClaimPayment(ledger.as(customer, "Org1MSP"), claimed, preimage))
+	if name := ledger.lastEvent(); name != "PaymentClaimed" {
+		t.Fatalf("expected PaymentClaimed event, got %q", name)
+	}
+	mustFail(t, contract.ClaimPayment(ledger.as(customer, "Org1MSP"), claimed, preimage))
+
+	lock, err := contract.GetLockedPayment(ledger.as(centralBank, "Org2MSP"), claimed)
+	mustSucceed(t, err)
+	if lock.Status != LockClaimed || lock.Preimage != preimage {
+		t.Fatalf("unexpected lock %+v", lock)
+	}
+
+	// After the timelock the payment can only be refunded
+	refunded, err := contract.LockPayment(ledger.as(centralBank, "Org2MSP"), customer, "50", hashlock, timelock)
+	mustSucceed(t, err)
+	ledger.advance(time.Hour)
+	mustFail(t, contract.ClaimPayment(ledger.as(customer, "Org1MSP"), refunded, preimage))
+	mustSucceed(t, contract.RefundLockedPayment(ledger.as(centralBank, "Org2MSP"), refunded))
+	if name := ledger.lastEvent(); name != "PaymentRefunded" {
+		t.Fatalf("expected PaymentRefunded event, got %q", name)
+	}
+
+	lock, err = contract.GetLockedPayment(ledger.as(customer, "Org1MSP"), refunded)
+	mustSucceed(t, err)
+	for account, expected := range map[string]string{centralBank: "900.00", customer: "100.00", lockEscrow(lock): "0.00"} {
+		balance, err := contract.BalanceOf(ledger.as(centralBank, "Org2MSP"), account)
+		mustSucceed(t, err)
+		if balance != expected {
+			t.Fatalf("expected balance %s, got %s", expected, balance)
+		}
+	}
+}
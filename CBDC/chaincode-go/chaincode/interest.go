@@ -0,0 +1,484 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const accrualPrefix = "accrual"
+
+// Define key names for options
+const rateBandsField = "rateBands"
+
+// Accrued interest is kept with more precision than the token has, so that
+// interest below the smallest unit isn't lost between applications
+var (
+	accrualScale   = big.NewInt(1000000000000)
+	secondsPerYear = big.NewInt(365 * 24 * 60 * 60)
+	basisPoints    = big.NewInt(10000)
+)
+
+// RateBand is the annual rate applied to the part of a balance that falls into the band.
+// Bands are ordered by UpTo, the first band starts at 0 and every next band starts where the previous one ended
+type RateBand struct {
+	UpTo    string `json:"upTo"`
+	RateBps int    `json:"rateBps"`
+}
+
+// AccruedInterest is the interest, or demurrage when negative, an account accrued but that was not applied yet
+type AccruedInterest struct {
+	Account string    `json:"account"`
+	Accrued string    `json:"accrued"`
+	Since   time.Time `json:"since"`
+	AsOf    time.Time `json:"asOf"`
+}
+
+// accrualRecord holds the scaled interest accrued by an account up to LastUpdate
+type accrualRecord struct {
+	LastUpdate time.Time `json:"lastUpdate"`
+	Accrued    string    `json:"accrued"`
+}
+
+// interestLine provides an organized struct for emitting the interest applied to an account
+type interestLine struct {
+	Account string `json:"account"`
+	Amount  string `json:"amount"`
+}
+
+// interestEvent provides an organized struct for emitting the interest applied by AccrueInterest
+type interestEvent struct {
+	Lines        []interestLine `json:"lines"`
+	SupplyChange string         `json:"supplyChange"`
+}
+
+// SetRateBands sets the annual remuneration rates of KYC registered accounts by balance band
+// param {[]RateBand} bands The bands ordered by their upper bound, e.g. [{"upTo":"1000.00","rateBps":100},{"upTo":"","rateBps":-50}].
+// An empty upper bound is only allowed on the last band and makes it unbounded, the part of a balance above
+// a bounded last band accrues nothing. Negative rates accrue demurrage
+// Accrual since the last balance change of an account uses the bands in force when it is checkpointed,
+// so AccrueInterest should be called for all accounts before the bands are changed
+// This function triggers a RateBandsSet event
+func (s *Erc20Contract) SetRateBands(ctx contractapi.TransactionContextInterface, bands []RateBand) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = requireRole(ctx, RolePolicy)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set rate bands: %v", err)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = parseRateBands(bands, decimals)
+	if err != nil {
+		return err
+	}
+
+	key, err := configKey(ctx, rateBandsField)
+	if err != nil {
+		return err
+	}
+
+	bandsJSON, err := json.Marshal(bands)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, bandsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set rate bands: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("RateBandsSet", bandsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("rate bands set to %s", bandsJSON)
+
+	return nil
+}
+
+// GetRateBands returns the annual remuneration rates by balance band
+func (s *Erc20Contract) GetRateBands(ctx contractapi.TransactionContextInterface) ([]RateBand, error) {
+	return readRateBands(ctx)
+}
+
+// AccrueInterest applies the interest accrued by the given accounts up to the transaction timestamp.
+// Positive interest is minted to the accounts and demurrage is burned from them, up to their balance.
+// Any client can call it, accounts without accrual are skipped
+// This function triggers an InterestApplied event
+func (s *Erc20Contract) AccrueInterest(ctx contractapi.TransactionContextInterface, accounts []string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return err
+	}
+
+	maxBatchSize, err := readConfigInt(ctx, maxBatchSizeField, defaultMaxBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(accounts) > maxBatchSize {
+		return fmt.Errorf("%d accounts exceed the maximum batch size of %d", len(accounts), maxBatchSize)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	supplyChange := new(big.Int)
+	lines := []interestLine{}
+	seen := make(map[string]bool)
+	for _, account := range accounts {
+		// Every account is applied once, see balanceSheet
+		if seen[account] {
+			continue
+		}
+		seen[account] = true
+
+		record, balance, err := accruedUntil(ctx, account, now)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			continue
+		}
+
+		accrued, ok := new(big.Int).SetString(record.Accrued, 10)
+		if !ok {
+			return fmt.Errorf("accrued interest of %s is not an integer", account)
+		}
+
+		applied, remainder := new(big.Int).QuoRem(accrued, accrualScale, new(big.Int))
+		if new(big.Int).Neg(applied).Cmp(balance) > 0 {
+			// Demurrage can't take more than the balance, what is left over is waived
+			applied.Neg(balance)
+			remainder.SetInt64(0)
+		}
+		record.Accrued = remainder.String()
+
+		err = putAccrual(ctx, account, record)
+		if err != nil {
+			return err
+		}
+
+		if applied.Sign() == 0 {
+			continue
+		}
+
+		err = storeBalance(ctx, account, balance.Add(balance, applied))
+		if err != nil {
+			return err
+		}
+
+		supplyChange.Add(supplyChange, applied)
+		lines = append(lines, interestLine{account, formatAmount(applied, decimals)})
+	}
+
+	totalSupply, err := readTotalSupply(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve total token supply: %v", err)
+	}
+
+	err = writeTotalSupply(ctx, totalSupply.Add(totalSupply, supplyChange))
+	if err != nil {
+		return err
+	}
+
+	err = emitPaymentEvent(ctx, "InterestApplied", "", interestEvent{lines, formatAmount(supplyChange, decimals)}, accounts...)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("interest applied to %d accounts, total supply changed by %s", len(lines), formatAmount(supplyChange, decimals))
+
+	return nil
+}
+
+// GetAccruedInterest returns the interest an account accrued up to the transaction timestamp that was not applied yet
+// Only the account itself, its bank and the central bank roles can read it
+func (s *Erc20Contract) GetAccruedInterest(ctx contractapi.TransactionContextInterface, account string) (*AccruedInterest, error) {
+
+	err := requireAccountReader(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	since := now
+	stored, err := readAccrual(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		since = stored.LastUpdate
+	}
+
+	record, _, err := accruedUntil(ctx, account, now)
+	if err != nil {
+		return nil, err
+	}
+
+	accrued := new(big.Int)
+	if record != nil {
+		accrued.SetString(record.Accrued, 10)
+	}
+
+	return &AccruedInterest{account, formatAmount(accrued.Quo(accrued, accrualScale), decimals), since, now}, nil
+}
+
+// Helper Functions
+
+// checkpointAccrual adds the interest accrued on the balance held since the last checkpoint to the account
+// Dependant functions include writeBalance
+func checkpointAccrual(ctx contractapi.TransactionContextInterface, account string) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	record, _, err := accruedUntil(ctx, account, now)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return nil
+	}
+
+	return putAccrual(ctx, account, record)
+}
+
+// accruedUntil returns the accrual record of an account brought up to now together with its balance.
+// The record is nil for accounts that don't accrue: contract accounts, accounts without KYC registration,
+// and any account while no rate bands are set
+func accruedUntil(ctx contractapi.TransactionContextInterface, account string, now time.Time) (*accrualRecord, *big.Int, error) {
+	if isInternalAccount(account) {
+		return nil, nil, nil
+	}
+
+	bands, err := readRateBands(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(bands) == 0 {
+		return nil, nil, nil
+	}
+
+	registered, err := readAccount(ctx, account)
+	if err != nil {
+		return nil, nil, err
+	}
+	if registered == nil {
+		return nil, nil, nil
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsedBands, err := parseRateBands(bands, decimals)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	balance, _, err := readBalance(ctx, account)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	record, err := readAccrual(ctx, account)
+	if err != nil {
+		return nil, nil, err
+	}
+	if record == nil {
+		return &accrualRecord{now, "0"}, balance, nil
+	}
+
+	accrued, ok := new(big.Int).SetString(record.Accrued, 10)
+	if !ok {
+		return nil, nil, fmt.Errorf("accrued interest of %s is not an integer", account)
+	}
+
+	seconds := int64(now.Sub(record.LastUpdate) / time.Second)
+	if seconds > 0 {
+		accrued.Add(accrued, accrue(balance, parsedBands, seconds))
+	}
+
+	return &accrualRecord{now, accrued.String()}, balance, nil
+}
+
+// rateBand is a RateBand with its upper bound in base units, nil when unbounded
+type rateBand struct {
+	upTo    *big.Int
+	rateBps *big.Int
+}
+
+// accrue returns the scaled interest a balance accrues over the given number of seconds.
+// Every band applies its rate to the part of the balance that falls into it
+func accrue(balance *big.Int, bands []rateBand, seconds int64) *big.Int {
+	weighted := new(big.Int)
+	lower := new(big.Int)
+	for _, band := range bands {
+		if balance.Cmp(lower) <= 0 {
+			break
+		}
+
+		upper := balance
+		if band.upTo != nil && band.upTo.Cmp(balance) < 0 {
+			upper = band.upTo
+		}
+
+		portion := new(big.Int).Sub(upper, lower)
+		weighted.Add(weighted, portion.Mul(portion, band.rateBps))
+
+		if band.upTo == nil {
+			break
+		}
+		lower = band.upTo
+	}
+
+	weighted.Mul(weighted, big.NewInt(seconds))
+	weighted.Mul(weighted, accrualScale)
+
+	divisor := new(big.Int).Mul(basisPoints, secondsPerYear)
+
+	// Quo truncates toward zero, so neither interest nor demurrage is rounded up
+	return weighted.Quo(weighted, divisor)
+}
+
+// parseRateBands validates the rate bands and converts their upper bounds to base units
+func parseRateBands(bands []RateBand, decimals int) ([]rateBand, error) {
+	parsed := make([]rateBand, len(bands))
+	previous := new(big.Int)
+	for i, band := range bands {
+		parsed[i].rateBps = big.NewInt(int64(band.RateBps))
+
+		if band.UpTo == "" {
+			if i != len(bands)-1 {
+				return nil, fmt.Errorf("only the last rate band can be unbounded")
+			}
+			continue
+		}
+
+		upTo, err := parseAmount(band.UpTo, decimals)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upper bound of rate band %d: %v", i+1, err)
+		}
+		if upTo.Cmp(previous) <= 0 {
+			return nil, fmt.Errorf("rate bands must be ordered by increasing upper bound")
+		}
+
+		parsed[i].upTo = upTo
+		previous = upTo
+	}
+
+	return parsed, nil
+}
+
+func readRateBands(ctx contractapi.TransactionContextInterface) ([]RateBand, error) {
+	key, err := configKey(ctx, rateBandsField)
+	if err != nil {
+		return nil, err
+	}
+
+	bandsBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate bands from world state: %v", err)
+	}
+
+	bands := []RateBand{}
+	if bandsBytes == nil {
+		return bands, nil
+	}
+
+	err = json.Unmarshal(bandsBytes, &bands)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rate bands: %v", err)
+	}
+
+	return bands, nil
+}
+
+func readAccrual(ctx contractapi.TransactionContextInterface, account string) (*accrualRecord, error) {
+	key, err := compositeKey(ctx, accrualPrefix, account)
+	if err != nil {
+		return nil, err
+	}
+
+	recordBytes, err := readAccountState(ctx, account, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accrual of %s: %v", account, err)
+	}
+	if recordBytes == nil {
+		return nil, nil
+	}
+
+	record := new(accrualRecord)
+	err = json.Unmarshal(recordBytes, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode accrual of %s: %v", account, err)
+	}
+
+	return record, nil
+}
+
+func putAccrual(ctx contractapi.TransactionContextInterface, account string, record *accrualRecord) error {
+	key, err := compositeKey(ctx, accrualPrefix, account)
+	if err != nil {
+		return err
+	}
+
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putAccountState(ctx, account, key, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update accrual of %s: %v", account, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterestAccrual(t *testing.T) {
+	ledger, contract := newInitializedLedger(t)
+	ledger.registerAccounts(contract, TierFull, customer, commercial)
+	mustSucceed(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "2000", Check{}))
+
+	remuneration := []RateBand{{UpTo: "1000", RateBps: 1000}, {UpTo: "", RateBps: -200}}
+	mustFail(t, contract.SetRateBands(ledger.as(centralBank, "Org2MSP"), remuneration))
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RolePolicy, MemberTypeClient, centralBank))
+	mustFail(t, contract.SetRateBands(ledger.as(centralBank, "Org2MSP"), []RateBand{{UpTo: "", RateBps: 100}, {UpTo: "1000", RateBps: 0}}))
+	mustFail(t, contract.SetRateBands(ledger.as(centralBank, "Org2MSP"), []RateBand{{UpTo: "1000", RateBps: 100}, {UpTo: "500", RateBps: 0}}))
+	mustSucceed(t, contract.SetRateBands(ledger.as(centralBank, "Org2MSP"), remuneration))
+
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "1500"))
+
+	// 10% on the first 1000.00 and -2% on the remaining 500.00 over a year
+	ledger.advance(365 * 24 * time.Hour)
+	accrued, err := contract.GetAccruedInterest(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if accrued.Accrued != "90.00" {
+		t.Fatalf("expected 90.00 accrued, got %s", accrued.Accrued)
+	}
+	other := clientID("CN=user1,OU=client,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org3.example.com")
+	_, err = contract.GetAccruedInterest(ledger.as(other, "Org3MSP"), customer)
+	mustFail(t, err)
+
+	// Accounts that aren't KYC registered don't accrue
+	accrued, err = contract.GetAccruedInterest(ledger.as(customer, "Org1MSP"), centralBank)
+	mustSucceed(t, err)
+	if accrued.Accrued != "0.00" {
+		t.Fatalf("expected nothing accrued by the central bank, got %s", accrued.Accrued)
+	}
+
+	mustSucceed(t, contract.AccrueInterest(ledger.as(commercial, "Org1MSP"), []string{customer, customer, centralBank}))
+	if name := ledger.lastEvent(); name != "InterestApplied" {
+		t.Fatalf("expected InterestApplied event, got %q", name)
+	}
+
+	// Applying twice at the same time changes nothing
+	mustSucceed(t, contract.AccrueInterest(ledger.as(commercial, "Org1MSP"), []string{customer}))
+
+	// Demurrage of 10% a year burns from the balance
+	mustSucceed(t, contract.SetRateBands(ledger.as(centralBank, "Org2MSP"), []RateBand{{UpTo: "", RateBps: -1000}}))
+	ledger.advance(73 * 24 * time.Hour)
+
+	// A transfer checkpoints the accrual on the balance held before it
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "590"))
+	ledger.advance(73 * 24 * time.Hour)
+	mustSucceed(t, contract.AccrueInterest(ledger.as(commercial, "Org1MSP"), []string{customer}))
+
+	// 1590.00 and then 1000.00 at -10% over a fifth of a year each
+	balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if balance != "948.20" {
+		t.Fatalf("expected balance 948.20, got %s", balance)
+	}
+
+	totalSupply, err := contract.TotalSupply(ledger.as(customer, "Org1MSP"))
+	mustSucceed(t, err)
+	if totalSupply != "2038.20" {
+		t.Fatalf("expected total supply 2038.20, got %s", totalSupply)
+	}
+}
@@ -0,0 +1,385 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the statuses of a payment request
+const (
+	RequestOpen          = "open"
+	RequestPartiallyPaid = "partiallyPaid"
+	RequestPaid          = "paid"
+	RequestCancelled     = "cancelled"
+	RequestExpired       = "expired"
+)
+
+// Define objectType names for prefix
+const (
+	paymentRequestPrefix  = "paymentRequest"
+	merchantRequestPrefix = "merchantRequest"
+)
+
+var knownRequestStatuses = []string{RequestOpen, RequestPartiallyPaid, RequestPaid, RequestCancelled, RequestExpired}
+
+// PaymentRequest asks a payer to pay an amount to a merchant for the order identified by the reference.
+// An unpaid request that passed its expiry reads as expired
+type PaymentRequest struct {
+	ID        string    `json:"id"`
+	Merchant  string    `json:"merchant"`
+	Payer     string    `json:"payer,omitempty"`
+	Amount    string    `json:"amount"`
+	Paid      string    `json:"paid"`
+	Reference string    `json:"reference"`
+	Status    string    `json:"status"`
+	Payments  []string  `json:"payments"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// requestPaymentEvent provides an organized struct for emitting a payment towards a request
+type requestPaymentEvent struct {
+	Request *PaymentRequest `json:"request"`
+	From    string          `json:"from"`
+	Value   string          `json:"value"`
+	Legs    []transferLeg   `json:"legs,omitempty"`
+}
+
+// CreatePaymentRequest asks for a payment to the client account
+// param {String} amount The decimal amount to be paid, e.g. "125.50"
+// param {String} reference The order the payment is for, it becomes the reference of the payments
+// param {int64} expiry The Unix time in seconds from which the request can no longer be paid, 0 for none
+// param {String} payer The only account that can pay the request, anyone can pay it when empty
+// returns {String} The ID of the request
+// This function triggers a PaymentRequestCreated event
+func (s *Erc20Contract) CreatePaymentRequest(ctx contractapi.TransactionContextInterface, amount string, reference string, expiry int64, payer string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if payer == clientID {
+		return "", fmt.Errorf("cannot request a payment from the client account itself")
+	}
+
+	if reference == "" {
+		return "", fmt.Errorf("payment request reference must not be empty")
+	}
+	err = validateRemittance(ctx, Remittance{Reference: reference})
+	if err != nil {
+		return "", err
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return "", err
+	}
+	if value.Sign() <= 0 {
+		return "", fmt.Errorf("requested amount must be positive")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	request := &PaymentRequest{
+		ID:        ctx.GetStub().GetTxID(),
+		Merchant:  clientID,
+		Payer:     payer,
+		Amount:    formatAmount(value, decimals),
+		Paid:      formatAmount(new(big.Int), decimals),
+		Reference: reference,
+		Status:    RequestOpen,
+		Payments:  []string{},
+		CreatedAt: now,
+	}
+	if expiry != 0 {
+		request.ExpiresAt = time.Unix(expiry, 0).UTC()
+		if !request.ExpiresAt.After(now) {
+			return "", fmt.Errorf("expiry must be in the future")
+		}
+	}
+
+	err = putPaymentRequest(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	// Index the request under its merchant so that GetPaymentRequests doesn't scan every request
+	indexKey, err := compositeKey(ctx, merchantRequestPrefix, clientID, request.ID)
+	if err != nil {
+		return "", err
+	}
+
+	err = putAccountState(ctx, clientID, indexKey, []byte{0})
+	if err != nil {
+		return "", fmt.Errorf("failed to index payment request %s: %v", request.ID, err)
+	}
+
+	err = emitPaymentRequestEvent(ctx, "PaymentRequestCreated", request)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("client %s requested %s for %s, request %s", clientID, request.Amount, reference, request.ID)
+
+	return request.ID, nil
+}
+
+// PayRequest pays towards a payment request from the client account and records the payment on the request
+// in the same transaction. The payment carries the reference of the request
+// param {String} amount The decimal amount to pay, e.g. "125.50", empty for everything still outstanding
+// This function triggers a PaymentRequestPaid event
+func (s *Erc20Contract) PayRequest(ctx contractapi.TransactionContextInterface, requestID string, amount string) error {
+
+	request, err := readPaymentRequest(ctx, requestID)
+	if err != nil {
+		return err
+	}
+	if request.Status != RequestOpen && request.Status != RequestPartiallyPaid {
+		return fmt.Errorf("payment request %s is %s", requestID, request.Status)
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if request.Payer != "" && clientID != request.Payer {
+		return fmt.Errorf("payment request %s is addressed to another payer", requestID)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	requested, err := parseAmount(request.Amount, decimals)
+	if err != nil {
+		return err
+	}
+
+	paid, err := parseAmount(request.Paid, decimals)
+	if err != nil {
+		return err
+	}
+
+	outstanding := new(big.Int).Sub(requested, paid)
+	value := outstanding
+	if amount != "" {
+		value, err = parseAmount(amount, decimals)
+		if err != nil {
+			return err
+		}
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("payment amount must be positive")
+	}
+	if value.Cmp(outstanding) > 0 {
+		return fmt.Errorf("payment of %s exceeds the outstanding %s of request %s", formatAmount(value, decimals), formatAmount(outstanding, decimals), requestID)
+	}
+
+	remittance := Remittance{Reference: request.Reference}
+
+	legs, _, err := transferWithFees(ctx, FeeTransfer, clientID, []payout{{request.Merchant, value}})
+	if err != nil {
+		return fmt.Errorf("failed to pay request %s: %v", requestID, err)
+	}
+
+	err = recordTransfer(ctx, clientID, request.Merchant, value, remittance)
+	if err != nil {
+		return err
+	}
+
+	paid.Add(paid, value)
+	request.Paid = formatAmount(paid, decimals)
+	request.Payments = append(request.Payments, ctx.GetStub().GetTxID())
+	request.Status = RequestPartiallyPaid
+	if paid.Cmp(requested) == 0 {
+		request.Status = RequestPaid
+	}
+
+	err = putPaymentRequest(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	err = emitPaymentEvent(ctx, "PaymentRequestPaid", request.ID, requestPaymentEvent{request, clientID, formatAmount(value, decimals), legs}, request.Merchant, clientID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s paid %s towards request %s, %s of %s paid", clientID, formatAmount(value, decimals), requestID, request.Paid, request.Amount)
+
+	return nil
+}
+
+// CancelPaymentRequest withdraws a request that is not fully paid, only its merchant can cancel it.
+// Partial payments already made stay with the merchant, which can return them with RefundPayment
+// This function triggers a PaymentRequestCancelled event
+func (s *Erc20Contract) CancelPaymentRequest(ctx contractapi.TransactionContextInterface, requestID string) error {
+
+	request, err := readPaymentRequest(ctx, requestID)
+	if err != nil {
+		return err
+	}
+	if request.Status != RequestOpen && request.Status != RequestPartiallyPaid {
+		return fmt.Errorf("payment request %s is %s", requestID, request.Status)
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != request.Merchant {
+		return fmt.Errorf("only the merchant can cancel payment request %s", requestID)
+	}
+
+	request.Status = RequestCancelled
+
+	err = putPaymentRequest(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	return emitPaymentRequestEvent(ctx, "PaymentRequestCancelled", request)
+}
+
+// GetPaymentRequest returns a payment request, to its merchant and to the payer it is addressed to
+func (s *Erc20Contract) GetPaymentRequest(ctx contractapi.TransactionContextInterface, requestID string) (*PaymentRequest, error) {
+
+	request, err := readPaymentRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != request.Merchant && request.Payer != "" && clientID != request.Payer {
+		return nil, fmt.Errorf("client is not a party to payment request %s", requestID)
+	}
+
+	return request, nil
+}
+
+// GetPaymentRequests returns the payment requests of the client account with the given status, all of them when empty
+func (s *Erc20Contract) GetPaymentRequests(ctx contractapi.TransactionContextInterface, status string) ([]PaymentRequest, error) {
+
+	if status != "" && !containsString(knownRequestStatuses, status) {
+		return nil, fmt.Errorf("unknown payment request status %s", status)
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	indexEntries, err := readStateByPartialKey(ctx, merchantRequestPrefix, []string{clientID}, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payment requests: %v", err)
+	}
+
+	requests := []PaymentRequest{}
+	for _, queryResponse := range indexEntries {
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key %s: %v", queryResponse.Key, err)
+		}
+
+		request, err := readPaymentRequest(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		if status == "" || request.Status == status {
+			requests = append(requests, *request)
+		}
+	}
+
+	return requests, nil
+}
+
+// Helper Functions
+
+// readPaymentRequest returns a payment request, an unpaid request past its expiry is returned as expired
+func readPaymentRequest(ctx contractapi.TransactionContextInterface, requestID string) (*PaymentRequest, error) {
+	key, err := compositeKey(ctx, paymentRequestPrefix, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	requestBytes, err := readRecord(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payment request %s: %v", requestID, err)
+	}
+	if requestBytes == nil {
+		return nil, fmt.Errorf("payment request %s does not exist", requestID)
+	}
+
+	request := new(PaymentRequest)
+	err = json.Unmarshal(requestBytes, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payment request %s: %v", requestID, err)
+	}
+
+	if (request.Status == RequestOpen || request.Status == RequestPartiallyPaid) && !request.ExpiresAt.IsZero() {
+		now, err := txTime(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !now.Before(request.ExpiresAt) {
+			request.Status = RequestExpired
+		}
+	}
+
+	return request, nil
+}
+
+func putPaymentRequest(ctx contractapi.TransactionContextInterface, request *PaymentRequest) error {
+	key, err := compositeKey(ctx, paymentRequestPrefix, request.ID)
+	if err != nil {
+		return err
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putRecord(ctx, key, requestJSON, request.Merchant, request.Payer)
+	if err != nil {
+		return fmt.Errorf("failed to update payment request %s: %v", request.ID, err)
+	}
+
+	return nil
+}
+
+// emitPaymentRequestEvent emits a payment request event carrying the request
+func emitPaymentRequestEvent(ctx contractapi.TransactionContextInterface, name string, request *PaymentRequest) error {
+	return emitPaymentEvent(ctx, name, request.ID, request, request.Merchant, request.Payer)
+}
@@ -0,0 +1,101 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPaymentRequests(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial)
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "300"))
+
+	expiry := ledger.now.Add(time.Hour).Unix()
+	_, err := contract.CreatePaymentRequest(ledger.as(commercial, "Org1MSP"), "100", "", expiry, "")
+	mustFail(t, err)
+	_, err = contract.CreatePaymentRequest(ledger.as(commercial, "Org1MSP"), "0", "ORDER-1", expiry, "")
+	mustFail(t, err)
+	_, err = contract.CreatePaymentRequest(ledger.as(commercial, "Org1MSP"), "100", "ORDER-1", ledger.now.Unix(), "")
+	mustFail(t, err)
+
+	partial, err := contract.CreatePaymentRequest(ledger.as(commercial, "Org1MSP"), "100", "ORDER-1", expiry, customer)
+	mustSucceed(t, err)
+	if name := ledger.lastEvent(); name != "PaymentRequestCreated" {
+		t.Fatalf("expected PaymentRequestCreated event, got %q", name)
+	}
+
+	// Only the addressed payer can pay, and never more than is outstanding
+	mustFail(t, contract.PayRequest(ledger.as(centralBank, "Org2MSP"), partial, "10"))
+	mustFail(t, contract.PayRequest(ledger.as(customer, "Org1MSP"), partial, "100.01"))
+	mustSucceed(t, contract.PayRequest(ledger.as(customer, "Org1MSP"), partial, "40"))
+	if name := ledger.lastEvent(); name != "PaymentRequestPaid" {
+		t.Fatalf("expected PaymentRequestPaid event, got %q", name)
+	}
+
+	request, err := contract.GetPaymentRequest(ledger.as(customer, "Org1MSP"), partial)
+	mustSucceed(t, err)
+	if request.Status != RequestPartiallyPaid || request.Paid != "40.00" || len(request.Payments) != 1 {
+		t.Fatalf("unexpected payment request %+v", request)
+	}
+	_, err = contract.GetPaymentRequest(ledger.as(centralBank, "Org2MSP"), partial)
+	mustFail(t, err)
+
+	// Paying without an amount settles what is outstanding
+	mustSucceed(t, contract.PayRequest(ledger.as(customer, "Org1MSP"), partial, ""))
+	mustFail(t, contract.PayRequest(ledger.as(customer, "Org1MSP"), partial, "1"))
+	mustFail(t, contract.CancelPaymentRequest(ledger.as(commercial, "Org1MSP"), partial))
+
+	transfers, err := contract.GetTransfersByReference(ledger.as(commercial, "Org1MSP"), "ORDER-1")
+	mustSucceed(t, err)
+	if len(transfers) != 2 {
+		t.Fatalf("expected 2 payments with the request reference, got %d", len(transfers))
+	}
+
+	cancelled, err := contract.CreatePaymentRequest(ledger.as(commercial, "Org1MSP"), "50", "ORDER-2", 0, "")
+	mustSucceed(t, err)
+	mustFail(t, contract.CancelPaymentRequest(ledger.as(customer, "Org1MSP"), cancelled))
+	mustSucceed(t, contract.CancelPaymentRequest(ledger.as(commercial, "Org1MSP"), cancelled))
+	if name := ledger.lastEvent(); name != "PaymentRequestCancelled" {
+		t.Fatalf("expected PaymentRequestCancelled event, got %q", name)
+	}
+	mustFail(t, contract.PayRequest(ledger.as(customer, "Org1MSP"), cancelled, ""))
+
+	expired, err := contract.CreatePaymentRequest(ledger.as(commercial, "Org1MSP"), "20", "ORDER-3", expiry, "")
+	mustSucceed(t, err)
+	_, err = contract.CreatePaymentRequest(ledger.as(commercial, "Org1MSP"), "30", "ORDER-4", 0, "")
+	mustSucceed(t, err)
+	ledger.advance(time.Hour)
+	mustFail(t, contract.PayRequest(ledger.as(customer, "Org1MSP"), expired, ""))
+
+	expectedCounts := map[string]int{RequestPaid: 1, RequestCancelled: 1, RequestExpired: 1, RequestOpen: 1, "": 4}
+	for status, count := range expectedCounts {
+		requests, err := contract.GetPaymentRequests(ledger.as(commercial, "Org1MSP"), status)
+		mustSucceed(t, err)
+		if len(requests) != count {
+			t.Fatalf("expected %d %q requests, got %d", count, status, len(requests))
+		}
+	}
+	_, err = contract.GetPaymentRequests(ledger.as(commercial, "Org1MSP"), "overdue")
+	mustFail(t, err)
+
+	// Requests of registered merchants and their index are kept in the collection of their bank
+	ctx := ledger.as(commercial, "Org1MSP")
+	for _, attributes := range [][]string{{paymentRequestPrefix, expired}, {merchantRequestPrefix, commercial, expired}} {
+		key, err := compositeKey(ctx, attributes[0], attributes[1:]...)
+		mustSucceed(t, err)
+		if ledger.stub.State[key] != nil || ledger.stub.PvtState[balancesCollection("Org1MSP")][key] == nil {
+			t.Fatalf("expected %v in the collection of the bank only", attributes)
+		}
+	}
+
+	requests, err := contract.GetPaymentRequests(ledger.as(customer, "Org1MSP"), "")
+	mustSucceed(t, err)
+	if len(requests) != 0 {
+		t.Fatalf("expected the payer to have no requests of its own, got %d", len(requests))
+	}
+
+	balance, err := contract.BalanceOf(ledger.as(commercial, "Org1MSP"), commercial)
+	mustSucceed(t, err)
+	if balance != "100.00" {
+		t.Fatalf("expected balance 100.00, got %s", balance)
+	}
+}
@@ -0,0 +1,360 @@
+package chaincode
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const (
+	reservePrefix   = "reserve"
+	bankTotalPrefix = "bankTotal"
+)
+
+// Define the totals tracked for every bank
+const (
+	issuedField      = "issued"
+	distributedField = "distributed"
+	returnedField    = "returned"
+	redeemedField    = "redeemed"
+)
+
+// BankPosition summarizes the CBR a commercial bank received from the central bank and passed on to customers
+type BankPosition struct {
+	Bank          string `json:"bank"`
+	Reserve       string `json:"reserve"`
+	Issued        string `json:"issued"`
+	Distributed   string `json:"distributed"`
+	Returned      string `json:"returned"`
+	Redeemed      string `json:"redeemed"`
+	InCirculation string `json:"inCirculation"`
+}
+
+// IssueToBank issues new tokens to the reserve account of a commercial bank
+// param {String} bankMSP The MSP ID of a bank holding the BANK role
+// param {String} amount The decimal amount to issue, e.g. "125.50"
+// This function triggers a Transfer event
+func (s *Erc20Contract) IssueToBank(ctx contractapi.TransactionContextInterface, bankMSP string, amount string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Check minter authorization against the role registry
+	err = requireRole(ctx, RoleMinter)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to issue tokens: %v", err)
+	}
+
+	err = checkDirectSupplyChange(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return err
+	}
+
+	isBank, err := roleGranted(ctx, RoleBank, MemberTypeMSP, bankMSP)
+	if err != nil {
+		return err
+	}
+	if !isBank {
+		return fmt.Errorf("%s is not a licensed bank, %s role required", bankMSP, RoleBank)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("issue amount must be positive")
+	}
+
+	reserve := reserveAccount(bankMSP)
+
+	err = mintHelper(ctx, reserve, value)
+	if err != nil {
+		return err
+	}
+
+	err = addBankTotal(ctx, bankMSP, issuedField, value)
+	if err != nil {
+		return err
+	}
+
+	err = emitTransferEvent(ctx, event{"0x0", reserve, formatAmount(value, decimals), nil, nil, nil})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("issued %s to bank %s", formatAmount(value, decimals), bankMSP)
+
+	return nil
+}
+
+// DistributeToCustomer transfers tokens from the reserve account of the calling bank to one of its customers
+// param {String} customer An account registered by the calling bank
+// param {String} amount The decimal amount to distribute, e.g. "125.50"
+// This function triggers a Transfer event
+func (s *Erc20Contract) DistributeToCustomer(ctx contractapi.TransactionContextInterface, customer string, amount string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to distribute tokens: %v", err)
+	}
+
+	// Banks distribute only to the customers they service
+	_, err = requireServicedAccount(ctx, customer)
+	if err != nil {
+		return err
+	}
+
+	bankMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("distribution amount must be positive")
+	}
+
+	reserve := reserveAccount(bankMSP)
+
+	legs, err := transferHelper(ctx, reserve, customer, value)
+	if err != nil {
+		return fmt.Errorf("failed to distribute: %v", err)
+	}
+
+	err = addBankTotal(ctx, bankMSP, distributedField, value)
+	if err != nil {
+		return err
+	}
+
+	err = emitTransferEvent(ctx, event{reserve, customer, formatAmount(value, decimals), nil, nil, legs})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("bank %s distributed %s to %s", bankMSP, formatAmount(value, decimals), customer)
+
+	return nil
+}
+
+// ReturnToCentralBank returns tokens from the reserve account of the calling bank to the central bank,
+// the returned tokens are taken out of circulation
+// param {String} amount The decimal amount to return, e.g. "125.50"
+// This function triggers a Transfer event
+func (s *Erc20Contract) ReturnToCentralBank(ctx contractapi.TransactionContextInterface, amount string) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to return tokens: %v", err)
+	}
+
+	err = checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return err
+	}
+
+	bankMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("return amount must be positive")
+	}
+
+	reserve := reserveAccount(bankMSP)
+
+	err = burnHelper(ctx, reserve, value)
+	if err != nil {
+		return fmt.Errorf("failed to return: %v", err)
+	}
+
+	err = addBankTotal(ctx, bankMSP, returnedField, value)
+	if err != nil {
+		return err
+	}
+
+	err = emitTransferEvent(ctx, event{reserve, "0x0", formatAmount(value, decimals), nil, nil, nil})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("bank %s returned %s to the central bank", bankMSP, formatAmount(value, decimals))
+
+	return nil
+}
+
+// GetBankPosition returns the reserve and the issued, distributed, returned and redeemed totals of a bank
+// Only the bank itself and the central bank roles can read it
+func (s *Erc20Contract) GetBankPosition(ctx contractapi.TransactionContextInterface, bankMSP string) (*BankPosition, error) {
+
+	err := requireBankOrCentralBank(ctx, bankMSP)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to read the position of bank %s: %v", bankMSP, err)
+	}
+
+	return readBankPosition(ctx, bankMSP)
+}
+
+// ListBankPositions returns the positions of all banks holding the BANK role as an MSP
+func (s *Erc20Contract) ListBankPositions(ctx contractapi.TransactionContextInterface) ([]BankPosition, error) {
+
+	err := requireRole(ctx, RoleAdmin, RoleMinter, RoleRegulator, RoleAuditor)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to read bank positions: %v", err)
+	}
+
+	banks, err := listRoleMembers(ctx, RoleBank)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := []BankPosition{}
+	for _, bank := range banks {
+		if bank.MemberType != MemberTypeMSP {
+			continue
+		}
+
+		position, err := readBankPosition(ctx, bank.Member)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, *position)
+	}
+
+	return positions, nil
+}
+
+// Helper Functions
+
+// reserveAccount returns the account holding the CBR a bank received from the central bank
+func reserveAccount(bankMSP string) string {
+	return internalAccount(reservePrefix, bankMSP)
+}
+
+// requireBankOrCentralBank succeeds for clients of the given bank MSP and for the central bank roles
+func requireBankOrCentralBank(ctx contractapi.TransactionContextInterface, bankMSP string) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if clientMSPID == bankMSP {
+		return nil
+	}
+
+	return requireRole(ctx, RoleAdmin, RoleMinter, RoleRegulator, RoleAuditor)
+}
+
+// isReserveAccount reports whether account is the reserve account of a bank
+func isReserveAccount(account string) bool {
+	return strings.HasPrefix(account, internalAccount(reservePrefix, ""))
+}
+
+// addBankTotal adds value to one of the issued, distributed or returned totals of a bank
+func addBankTotal(ctx contractapi.TransactionContextInterface, bankMSP string, field string, value *big.Int) error {
+	key, err := compositeKey(ctx, bankTotalPrefix, bankMSP, field)
+	if err != nil {
+		return err
+	}
+
+	total, _, err := readAmount(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return putAmount(ctx, key, total.Add(total, value))
+}
+
+func readBankPosition(ctx contractapi.TransactionContextInterface, bankMSP string) (*BankPosition, error) {
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]*big.Int)
+	for _, field := range []string{issuedField, distributedField, returnedField, redeemedField} {
+		key, err := compositeKey(ctx, bankTotalPrefix, bankMSP, field)
+		if err != nil {
+			return nil, err
+		}
+
+		totals[field], _, err = readAmount(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reserve, _, err := readBalance(ctx, reserveAccount(bankMSP))
+	if err != nil {
+		return nil, err
+	}
+
+	// Customer redemptions confirmed by the bank take its CBR out of circulation as well
+	inCirculation := new(big.Int).Sub(totals[issuedField], totals[returnedField])
+	inCirculation.Sub(inCirculation, totals[redeemedField])
+
+	return &BankPosition{
+		Bank:          bankMSP,
+		Reserve:       formatAmount(reserve, decimals),
+		Issued:        formatAmount(totals[issuedField], decimals),
+		Distributed:   formatAmount(totals[distributedField], decimals),
+		Returned:      formatAmount(totals[returnedField], decimals),
+		Redeemed:      formatAmount(totals[redeemedField], decimals),
+		InCirculation: formatAmount(inCirculation, decimals),
+	}, nil
+}
@@ -0,0 +1,45 @@
+package chaincode
+
+import "testing"
+
+func TestTwoTierIssuance(t *testing.T) {
+	ledger, contract := newInitializedLedger(t)
+	ledger.registerAccounts(contract, TierFull, customer)
+
+	mustFail(t, contract.IssueToBank(ledger.as(centralBank, "Org2MSP"), "Org3MSP", "1000"))
+	mustFail(t, contract.IssueToBank(ledger.as(commercial, "Org1MSP"), "Org1MSP", "1000"))
+	mustSucceed(t, contract.IssueToBank(ledger.as(centralBank, "Org2MSP"), "Org1MSP", "1000"))
+
+	// Banks distribute only to their own customers
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleBank, MemberTypeMSP, "Org3MSP"))
+	mustFail(t, contract.DistributeToCustomer(ledger.as(commercial, "Org3MSP"), customer, "100"))
+	mustFail(t, contract.DistributeToCustomer(ledger.as(commercial, "Org1MSP"), customer, "1000.01"))
+	mustSucceed(t, contract.DistributeToCustomer(ledger.as(commercial, "Org1MSP"), customer, "300"))
+
+	// Customers can pay back into the reserve of a bank
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), reserveAccount("Org1MSP"), "50"))
+	mustSucceed(t, contract.ReturnToCentralBank(ledger.as(commercial, "Org1MSP"), "200"))
+	mustFail(t, contract.ReturnToCentralBank(ledger.as(commercial, "Org1MSP"), "600"))
+
+	position, err := contract.GetBankPosition(ledger.as(commercial, "Org1MSP"), "Org1MSP")
+	mustSucceed(t, err)
+	expected := BankPosition{"Org1MSP", "550.00", "1000.00", "300.00", "200.00", "0.00", "800.00"}
+	if *position != expected {
+		t.Fatalf("expected position %+v, got %+v", expected, *position)
+	}
+
+	_, err = contract.GetBankPosition(ledger.as(commercial, "Org3MSP"), "Org1MSP")
+	mustFail(t, err)
+
+	positions, err := contract.ListBankPositions(ledger.as(centralBank, "Org2MSP"))
+	mustSucceed(t, err)
+	if len(positions) != 2 {
+		t.Fatalf("expected 2 bank positions, got %d", len(positions))
+	}
+
+	supply, err := contract.TotalSupply(ledger.as(centralBank, "Org2MSP"))
+	mustSucceed(t, err)
+	if supply != "800.00" {
+		t.Fatalf("expected total supply 800.00, got %s", supply)
+	}
+}
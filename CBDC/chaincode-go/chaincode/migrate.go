@@ -0,0 +1,195 @@
+package chaincode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the flat key names used before state was namespaced by composite key prefixes.
+// Name and symbol shared one key, so the name was overwritten by the symbol on Initialize
+const (
+	legacyNameKey        = "CBR"
+	legacyDecimalsKey    = "2"
+	legacyTotalSupplyKey = "0"
+)
+
+// MigrationResult summarizes what MigrateState moved to the namespaced key layout
+type MigrationResult struct {
+	Accounts    int    `json:"accounts"`
+	TotalSupply string `json:"totalSupply"`
+	Name        string `json:"name"`
+	Symbol      string `json:"symbol"`
+	Decimals    string `json:"decimals"`
+}
+
+// MigrateState moves a ledger written with the flat key layout to the namespaced layout.
+// param {String} name The token name to store, the legacy layout lost it when the symbol was written over it.
+// If empty the legacy symbol is used as the name.
+// The migration fails and nothing is written when the migrated balances do not add up to the total supply
+// This function triggers a StateMigrated event
+func (s *Erc20Contract) MigrateState(ctx contractapi.TransactionContextInterface, name string) (*MigrationResult, error) {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to migrate state: %v", err)
+	}
+
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if initialized {
+		return nil, fmt.Errorf("state is already stored in the namespaced key layout")
+	}
+
+	symbolBytes, err := ctx.GetStub().GetState(legacyNameKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy token symbol: %v", err)
+	}
+	if symbolBytes == nil {
+		return nil, fmt.Errorf("no legacy state found, call Initialize() to initialize contract")
+	}
+
+	decimalsBytes, err := ctx.GetStub().GetState(legacyDecimalsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy token decimals: %v", err)
+	}
+
+	// Stored decimals can't be changed once the contract is initialized, so they are checked before anything is written
+	_, err = parseDecimals(string(decimalsBytes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid legacy token decimals: %v", err)
+	}
+
+	totalSupplyBytes, err := ctx.GetStub().GetState(legacyTotalSupplyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy total supply: %v", err)
+	}
+
+	totalSupply := new(big.Int)
+	if totalSupplyBytes != nil {
+		_, ok := totalSupply.SetString(string(totalSupplyBytes), 10)
+		if !ok {
+			return nil, fmt.Errorf("legacy total supply %q is not an integer", totalSupplyBytes)
+		}
+	}
+
+	balances, err := legacyBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the totals still match before anything is written
+	sum := new(big.Int)
+	for _, balance := range balances {
+		sum.Add(sum, balance)
+	}
+	if sum.Cmp(totalSupply) != 0 {
+		return nil, fmt.Errorf("legacy balances add up to %s but total supply is %s, refusing to migrate", sum, totalSupply)
+	}
+
+	for account, balance := range balances {
+		err = writeBalance(ctx, account, balance)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate balance of %s: %v", account, err)
+		}
+
+		err = ctx.GetStub().DelState(account)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete legacy balance of %s: %v", account, err)
+		}
+	}
+
+	err = writeTotalSupply(ctx, totalSupply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate total supply: %v", err)
+	}
+
+	symbol := string(symbolBytes)
+	if name == "" {
+		name = symbol
+	}
+
+	err = putMetadata(ctx, name, symbol, string(decimalsBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{legacyNameKey, legacyDecimalsKey, legacyTotalSupplyKey} {
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete legacy key %s: %v", key, err)
+		}
+	}
+
+	// The legacy layout had no role registry, record the migrating MSP as the first ADMIN
+	err = bootstrapRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bootstrap roles: %v", err)
+	}
+
+	result := &MigrationResult{len(balances), totalSupply.String(), name, symbol, string(decimalsBytes)}
+
+	// Emit the StateMigrated event
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("StateMigrated", resultJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("migrated %d accounts holding %s tokens to the namespaced key layout", len(balances), totalSupply)
+
+	return result, nil
+}
+
+// Helper Functions
+
+// legacyBalances returns the balances stored under raw client IDs in the flat key layout.
+// Composite keys are not returned by a range query, and TeaContract tokens are skipped
+// since they are keyed by transaction ID and hold JSON documents
+func legacyBalances(ctx contractapi.TransactionContextInterface) (map[string]*big.Int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	balances := make(map[string]*big.Int)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if !isClientID(queryResponse.Key) {
+			continue
+		}
+
+		balance, ok := new(big.Int).SetString(string(queryResponse.Value), 10)
+		if !ok {
+			return nil, fmt.Errorf("legacy balance of %s is not an integer", queryResponse.Key)
+		}
+		balances[queryResponse.Key] = balance
+	}
+
+	return balances, nil
+}
+
+// isClientID reports whether key looks like an ID returned by GetClientIdentity().GetID()
+func isClientID(key string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(string(decoded), "x509::")
+}
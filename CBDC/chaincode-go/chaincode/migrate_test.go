@@ -0,0 +1,79 @@
+package chaincode
+
+import "testing"
+
+// seedLegacyState writes the flat key layout used before state was namespaced
+func seedLegacyState(ledger *testLedger, totalSupply string) {
+	ledger.stub.MockTransactionStart("legacy")
+	ledger.stub.PutState(legacyNameKey, []byte("CBR"))
+	ledger.stub.PutState(legacyDecimalsKey, []byte("2"))
+	ledger.stub.PutState(legacyTotalSupplyKey, []byte(totalSupply))
+	ledger.stub.PutState(centralBank, []byte("700"))
+	ledger.stub.PutState(customer, []byte("300"))
+	ledger.stub.PutState("0b8bb8e4d0c43b3f4c3e1c5e1ac8a8fb5f7f6f0f3d1dd4ea4b1c2c3f8f1e3d2a", []byte(`{"name":"green tea"}`))
+	ledger.stub.MockTransactionEnd("legacy")
+}
+
+func TestMigrateState(t *testing.T) {
+	ledger := newTestLedger(t)
+	contract := new(Erc20Contract)
+	seedLegacyState(ledger, "1000")
+
+	_, err := contract.Initialize(ledger.as(centralBank, "Org2MSP"), "Belarusian ruble", "CBR", "2")
+	mustFail(t, err)
+
+	result, err := contract.MigrateState(ledger.as(centralBank, "Org2MSP"), "Belarusian ruble")
+	mustSucceed(t, err)
+	if result.Accounts != 2 || result.TotalSupply != "1000" {
+		t.Fatalf("unexpected migration result %+v", result)
+	}
+
+	name, err := contract.Name(ledger.as(customer, "Org1MSP"))
+	mustSucceed(t, err)
+	symbol, err := contract.Symbol(ledger.as(customer, "Org1MSP"))
+	mustSucceed(t, err)
+	if name != "Belarusian ruble" || symbol != "CBR" {
+		t.Fatalf("unexpected token options %q %q", name, symbol)
+	}
+
+	balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if balance != "3.00" {
+		t.Fatalf("expected migrated balance 3.00, got %s", balance)
+	}
+
+	for _, key := range []string{legacyNameKey, legacyDecimalsKey, legacyTotalSupplyKey, customer} {
+		if ledger.stub.State[key] != nil {
+			t.Fatalf("legacy key %q was not deleted", key)
+		}
+	}
+
+	_, err = contract.MigrateState(ledger.as(centralBank, "Org2MSP"), "")
+	mustFail(t, err)
+}
+
+func TestMigrateStateRejectsMismatchedSupply(t *testing.T) {
+	ledger := newTestLedger(t)
+	seedLegacyState(ledger, "900")
+
+	_, err := new(Erc20Contract).MigrateState(ledger.as(centralBank, "Org2MSP"), "")
+	mustFail(t, err)
+}
+
+func TestMigrateStateRejectsInvalidDecimals(t *testing.T) {
+	ledger := newTestLedger(t)
+	contract := new(Erc20Contract)
+	seedLegacyState(ledger, "1000")
+	ledger.stub.MockTransactionStart("legacy")
+	ledger.stub.DelState(legacyDecimalsKey)
+	ledger.stub.MockTransactionEnd("legacy")
+
+	_, err := contract.MigrateState(ledger.as(centralBank, "Org2MSP"), "")
+	mustFail(t, err)
+
+	initialized, err := checkInitialized(ledger.as(centralBank, "Org2MSP"))
+	mustSucceed(t, err)
+	if initialized {
+		t.Fatalf("a failed migration must leave the contract uninitialized")
+	}
+}
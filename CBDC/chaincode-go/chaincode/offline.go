@@ -0,0 +1,532 @@
+package chaincode
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the statuses of an offline purse
+const (
+	PurseActive   = "active"
+	PurseClosed   = "closed"
+	VoucherPaid   = "settled"
+	VoucherFaulty = "rejected"
+)
+
+// Define objectType names for prefix
+const (
+	pursePrefix   = "purse"
+	voucherPrefix = "voucher"
+)
+
+// defaultPurseValidity gives payees 30 days to redeem the vouchers of a purse before its owner can reclaim it
+const defaultPurseValidity = 30 * 24 * 60 * 60
+
+// Define key names for options
+const purseValidityField = "offlinePurseValidity"
+
+// voucherDomain separates voucher signatures from anything else the purse key could sign
+const voucherDomain = "CBDC-OFFLINE-VOUCHER"
+
+// OfflinePurse holds funds locked for offline payments. Vouchers signed with the key of the purse are settled
+// from it until it expires and its owner reclaims what was not redeemed
+type OfflinePurse struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	PublicKey string    `json:"publicKey"`
+	Funded    string    `json:"funded"`
+	Redeemed  string    `json:"redeemed"`
+	Status    string    `json:"status"`
+	Escrow    string    `json:"escrow,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// OfflineVoucher is a payment signed offline by a purse, sequence numbers of a purse are used once
+type OfflineVoucher struct {
+	PurseID   string `json:"purseID"`
+	Sequence  uint64 `json:"sequence"`
+	Payee     string `json:"payee"`
+	Amount    string `json:"amount"`
+	Signature string `json:"signature"`
+}
+
+// VoucherResult is the outcome of redeeming a voucher
+type VoucherResult struct {
+	PurseID  string `json:"purseID"`
+	Sequence uint64 `json:"sequence"`
+	Payee    string `json:"payee"`
+	Amount   string `json:"amount"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// FundOfflinePurse locks tokens of the client account in a new offline purse
+// param {String} publicKey The base64 encoded ed25519 public key the purse signs its vouchers with
+// param {String} amount The decimal amount to lock, e.g. "125.50"
+// returns {String} The ID of the purse
+// This function triggers an OfflinePurseFunded event
+func (s *Erc20Contract) FundOfflinePurse(ctx contractapi.TransactionContextInterface, publicKey string, amount string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(keyBytes) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("public key must be a base64 encoded ed25519 public key")
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return "", err
+	}
+	if value.Sign() <= 0 {
+		return "", fmt.Errorf("purse amount must be positive")
+	}
+
+	validity, err := readConfigInt(ctx, purseValidityField, defaultPurseValidity)
+	if err != nil {
+		return "", err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	id := ctx.GetStub().GetTxID()
+	escrow, err := escrowAccount(ctx, pursePrefix, id, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	purse := &OfflinePurse{
+		ID:        id,
+		Owner:     clientID,
+		PublicKey: publicKey,
+		Funded:    formatAmount(value, decimals),
+		Redeemed:  formatAmount(new(big.Int), decimals),
+		Status:    PurseActive,
+		Escrow:    escrow,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(validity) * time.Second),
+	}
+
+	_, _, err = transferWithFees(ctx, FeeTransfer, clientID, []payout{{escrow, value}})
+	if err != nil {
+		return "", fmt.Errorf("failed to fund offline purse: %v", err)
+	}
+
+	err = putPurse(ctx, purse)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitPurseEvent(ctx, "OfflinePurseFunded", purse)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("client %s locked %s in offline purse %s", clientID, purse.Funded, id)
+
+	return id, nil
+}
+
+// RedeemOfflineVouchers settles vouchers collected offline from the purses that signed them.
+// A voucher with a bad signature, a sequence number used before or more than is left in its purse is rejected,
+// the others are paid to their payees. A payee that can't receive the funds, e.g. because it is not registered
+// or is frozen for incoming funds, fails the whole transaction
+// returns {[]VoucherResult} The outcome of every voucher
+// This function triggers an OfflineVouchersRedeemed event
+func (s *Erc20Contract) RedeemOfflineVouchers(ctx contractapi.TransactionContextInterface, vouchers []OfflineVoucher) ([]VoucherResult, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	maxBatchSize, err := readConfigInt(ctx, maxBatchSizeField, defaultMaxBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(vouchers) == 0 || len(vouchers) > maxBatchSize {
+		return nil, fmt.Errorf("between 1 and the maximum batch size of %d vouchers can be redeemed at once", maxBatchSize)
+	}
+
+	err = checkNotPaused(ctx, PauseTransfers)
+	if err != nil {
+		return nil, err
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Purses and used sequence numbers are tracked in memory next to the balance sheet and written once with it
+	sheet := newBalanceSheet(ctx)
+	purses := make(map[string]*OfflinePurse)
+	used := make(map[string]bool)
+	credits := make(map[string]*big.Int)
+	payees := []string{}
+	results := make([]VoucherResult, len(vouchers))
+	for i, voucher := range vouchers {
+		results[i] = VoucherResult{voucher.PurseID, voucher.Sequence, voucher.Payee, voucher.Amount, VoucherPaid, ""}
+
+		value, err := checkVoucher(ctx, sheet, purses, used, &voucher, decimals)
+		if err != nil {
+			results[i].Status = VoucherFaulty
+			results[i].Reason = err.Error()
+			continue
+		}
+
+		purse := purses[voucher.PurseID]
+		err = sheet.add(purseEscrow(purse), new(big.Int).Neg(value))
+		if err != nil {
+			return nil, err
+		}
+		err = sheet.add(voucher.Payee, value)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := credits[voucher.Payee]; !ok {
+			payees = append(payees, voucher.Payee)
+			credits[voucher.Payee] = new(big.Int)
+		}
+		credits[voucher.Payee].Add(credits[voucher.Payee], value)
+
+		redeemed, err := parseAmount(purse.Redeemed, decimals)
+		if err != nil {
+			return nil, err
+		}
+		purse.Redeemed = formatAmount(redeemed.Add(redeemed, value), decimals)
+
+		key, err := compositeKey(ctx, voucherPrefix, voucher.PurseID, sequenceKey(voucher.Sequence))
+		if err != nil {
+			return nil, err
+		}
+		resultJSON, err := json.Marshal(results[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		}
+		owner, payee := purse.Owner, voucher.Payee
+		sheet.onWrite(func() error {
+			return putRecord(ctx, key, resultJSON, owner, payee)
+		})
+	}
+
+	for _, payee := range payees {
+		_, err := sweepWaterfall(ctx, sheet, payee, credits[payee])
+		if err != nil {
+			return nil, err
+		}
+
+		payeeBalance, _, err := sheet.balance(payee)
+		if err != nil {
+			return nil, err
+		}
+
+		// Enforce the KYC registry and the limits of the payee tier
+		err = checkRecipientLimits(ctx, payee, payeeBalance)
+		if err != nil {
+			return nil, err
+		}
+
+		err = checkNotFrozen(ctx, payee, FreezeIn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = sheet.write()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, purse := range purses {
+		err = putPurse(ctx, purse)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = emitPaymentEvent(ctx, "OfflineVouchersRedeemed", "", results, payees...)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("%d offline vouchers redeemed to %d payees", len(vouchers), len(payees))
+
+	return results, nil
+}
+
+// ReclaimOfflinePurse returns what was not redeemed from an expired purse to its owner and closes it,
+// vouchers of the purse can't be redeemed afterwards
+// This function triggers an OfflinePurseReclaimed event
+func (s *Erc20Contract) ReclaimOfflinePurse(ctx contractapi.TransactionContextInterface, purseID string) error {
+
+	purse, err := readPurse(ctx, purseID)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if purse.Owner != clientID {
+		return fmt.Errorf("offline purse %s is not owned by the client", purseID)
+	}
+	if purse.Status != PurseActive {
+		return fmt.Errorf("offline purse %s is %s", purseID, purse.Status)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now.Before(purse.ExpiresAt) {
+		return fmt.Errorf("offline purse %s can't be reclaimed before %s", purseID, purse.ExpiresAt)
+	}
+
+	remaining, _, err := readBalance(ctx, purseEscrow(purse))
+	if err != nil {
+		return err
+	}
+	if remaining.Sign() > 0 {
+		err = returnEscrow(ctx, "", purseEscrow(purse), clientID, remaining)
+		if err != nil {
+			return fmt.Errorf("failed to reclaim offline purse: %v", err)
+		}
+	}
+
+	purse.Status = PurseClosed
+
+	err = putPurse(ctx, purse)
+	if err != nil {
+		return err
+	}
+
+	err = emitPurseEvent(ctx, "OfflinePurseReclaimed", purse)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("offline purse %s reclaimed by %s", purseID, clientID)
+
+	return nil
+}
+
+// GetOfflinePurse returns an offline purse.
+// Only its owner, the bank of the owner and the central bank roles can read a purse of a registered account
+func (s *Erc20Contract) GetOfflinePurse(ctx contractapi.TransactionContextInterface, purseID string) (*OfflinePurse, error) {
+	purse, err := readPurse(ctx, purseID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireRecordReader(ctx, purse.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to read offline purse %s: %v", purseID, err)
+	}
+
+	return purse, nil
+}
+
+// SetOfflinePurseValidity sets the number of seconds the vouchers of a new purse can be redeemed before it can be reclaimed
+func (s *Erc20Contract) SetOfflinePurseValidity(ctx contractapi.TransactionContextInterface, seconds int) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set the offline purse validity: %v", err)
+	}
+
+	if seconds <= 0 {
+		return fmt.Errorf("offline purse validity must be positive")
+	}
+
+	err = putConfigInt(ctx, purseValidityField, seconds)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("offline purse validity set to %d seconds", seconds)
+
+	return nil
+}
+
+// Helper Functions
+
+// purseEscrow returns the account holding the funds of an offline purse
+func purseEscrow(purse *OfflinePurse) string {
+	if purse.Escrow == "" {
+		return internalAccount(pursePrefix, purse.ID)
+	}
+
+	return purse.Escrow
+}
+
+// voucherMessage returns the bytes a purse signs for a voucher, application-go/offline builds the same message
+func voucherMessage(voucher *OfflineVoucher) []byte {
+	return []byte(voucherDomain + "\n" + voucher.PurseID + "\n" + strconv.FormatUint(voucher.Sequence, 10) + "\n" + voucher.Payee + "\n" + voucher.Amount)
+}
+
+// sequenceKey pads a sequence number so that the vouchers of a purse are stored in order
+func sequenceKey(sequence uint64) string {
+	return fmt.Sprintf("%020d", sequence)
+}
+
+// checkVoucher validates a voucher against its purse and returns its value. purses and used carry the purses read
+// and the sequence numbers accepted so far in the transaction, the purse of a valid voucher is added to purses
+func checkVoucher(ctx contractapi.TransactionContextInterface, sheet *balanceSheet, purses map[string]*OfflinePurse, used map[string]bool, voucher *OfflineVoucher, decimals int) (*big.Int, error) {
+	purse, ok := purses[voucher.PurseID]
+	if !ok {
+		var err error
+		purse, err = readPurse(ctx, voucher.PurseID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if purse.Status != PurseActive {
+		return nil, fmt.Errorf("offline purse %s is %s", purse.ID, purse.Status)
+	}
+
+	if isInternalAccount(voucher.Payee) || voucher.Payee == purse.Owner {
+		return nil, fmt.Errorf("payee %s can't redeem vouchers", voucher.Payee)
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(purse.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the public key of offline purse %s: %v", purse.ID, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(voucher.Signature)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(publicKey), voucherMessage(voucher), signature) {
+		return nil, fmt.Errorf("signature is not valid for offline purse %s", purse.ID)
+	}
+
+	seqKey := sequenceKey(voucher.Sequence)
+	key, err := compositeKey(ctx, voucherPrefix, purse.ID, seqKey)
+	if err != nil {
+		return nil, err
+	}
+	redeemed, err := readRecord(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read voucher: %v", err)
+	}
+	if redeemed != nil || used[purse.ID+seqKey] {
+		return nil, fmt.Errorf("sequence number %d of offline purse %s was already redeemed", voucher.Sequence, purse.ID)
+	}
+
+	value, err := parseAmount(voucher.Amount, decimals)
+	if err != nil {
+		return nil, err
+	}
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("voucher amount must be positive")
+	}
+
+	remaining, _, err := sheet.balance(purseEscrow(purse))
+	if err != nil {
+		return nil, err
+	}
+	if remaining.Cmp(value) < 0 {
+		return nil, fmt.Errorf("offline purse %s has only %s left", purse.ID, formatAmount(remaining, decimals))
+	}
+
+	purses[purse.ID] = purse
+	used[purse.ID+seqKey] = true
+
+	return value, nil
+}
+
+func readPurse(ctx contractapi.TransactionContextInterface, purseID string) (*OfflinePurse, error) {
+	key, err := compositeKey(ctx, pursePrefix, purseID)
+	if err != nil {
+		return nil, err
+	}
+
+	purseBytes, err := readRecord(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offline purse %s: %v", purseID, err)
+	}
+	if purseBytes == nil {
+		return nil, fmt.Errorf("offline purse %s does not exist", purseID)
+	}
+
+	purse := new(OfflinePurse)
+	err = json.Unmarshal(purseBytes, purse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode offline purse %s: %v", purseID, err)
+	}
+
+	return purse, nil
+}
+
+func putPurse(ctx contractapi.TransactionContextInterface, purse *OfflinePurse) error {
+	key, err := compositeKey(ctx, pursePrefix, purse.ID)
+	if err != nil {
+		return err
+	}
+
+	purseJSON, err := json.Marshal(purse)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putRecord(ctx, key, purseJSON, purse.Owner)
+	if err != nil {
+		return fmt.Errorf("failed to update offline purse %s: %v", purse.ID, err)
+	}
+
+	return nil
+}
+
+// putJSON stores the JSON encoding of value under key
+func putJSON(ctx contractapi.TransactionContextInterface, key string, value interface{}) error {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, valueJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// emitPurseEvent emits an offline purse event carrying the purse
+func emitPurseEvent(ctx contractapi.TransactionContextInterface, name string, purse *OfflinePurse) error {
+	return emitPaymentEvent(ctx, name, purse.ID, purse, purse.Owner)
+}
@@ -0,0 +1,103 @@
+package chaincode
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestOfflineVouchers(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial, centralBank)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	mustSucceed(t, err)
+	encodedKey := base64.StdEncoding.EncodeToString(publicKey)
+
+	_, err = contract.FundOfflinePurse(ledger.as(centralBank, "Org2MSP"), "not a key", "100")
+	mustFail(t, err)
+	purseID, err := contract.FundOfflinePurse(ledger.as(centralBank, "Org2MSP"), encodedKey, "100")
+	mustSucceed(t, err)
+	if name := ledger.lastEvent(); name != "OfflinePurseFunded" {
+		t.Fatalf("expected OfflinePurseFunded event, got %q", name)
+	}
+
+	sign := func(sequence uint64, payee string, amount string, key ed25519.PrivateKey) OfflineVoucher {
+		voucher := OfflineVoucher{PurseID: purseID, Sequence: sequence, Payee: payee, Amount: amount}
+		voucher.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, voucherMessage(&voucher)))
+		return voucher
+	}
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	mustSucceed(t, err)
+
+	results, err := contract.RedeemOfflineVouchers(ledger.as(customer, "Org1MSP"), []OfflineVoucher{
+		sign(1, customer, "30", privateKey),
+		sign(2, commercial, "20", otherKey),
+		sign(1, commercial, "20", privateKey),
+		sign(3, commercial, "80", privateKey),
+		sign(4, commercial, "20", privateKey),
+	})
+	mustSucceed(t, err)
+	expected := []string{VoucherPaid, VoucherFaulty, VoucherFaulty, VoucherFaulty, VoucherPaid}
+	for i, result := range results {
+		if result.Status != expected[i] {
+			t.Fatalf("expected voucher %d to be %s, got %+v", i, expected[i], result)
+		}
+	}
+	if name := ledger.lastEvent(); name != "OfflineVouchersRedeemed" {
+		t.Fatalf("expected OfflineVouchersRedeemed event, got %q", name)
+	}
+
+	// Vouchers can't get funds to a payee frozen for incoming funds
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleRegulator, MemberTypeMSP, "Org2MSP"))
+	mustSucceed(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), commercial, FreezeIn, "fraud", "case 17/2023"))
+	_, err = contract.RedeemOfflineVouchers(ledger.as(commercial, "Org1MSP"), []OfflineVoucher{sign(6, commercial, "10", privateKey)})
+	mustFail(t, err)
+	mustSucceed(t, contract.UnfreezeAccount(ledger.as(centralBank, "Org2MSP"), commercial, "case 17/2023"))
+
+	// A sequence number settled in an earlier transaction can't be redeemed again
+	results, err = contract.RedeemOfflineVouchers(ledger.as(commercial, "Org1MSP"), []OfflineVoucher{sign(4, commercial, "20", privateKey)})
+	mustSucceed(t, err)
+	if results[0].Status != VoucherFaulty {
+		t.Fatalf("expected replayed voucher to be rejected, got %+v", results[0])
+	}
+
+	purse, err := contract.GetOfflinePurse(ledger.as(centralBank, "Org2MSP"), purseID)
+	mustSucceed(t, err)
+	if purse.Redeemed != "50.00" {
+		t.Fatalf("expected 50.00 redeemed, got %s", purse.Redeemed)
+	}
+
+	// Purses and settled vouchers of registered accounts are kept in the collection of their bank
+	ctx := ledger.as(centralBank, "Org2MSP")
+	for _, attributes := range [][]string{{pursePrefix, purseID}, {voucherPrefix, purseID, sequenceKey(4)}} {
+		key, err := compositeKey(ctx, attributes[0], attributes[1:]...)
+		mustSucceed(t, err)
+		if ledger.stub.State[key] != nil || ledger.stub.PvtState[balancesCollection("Org1MSP")][key] == nil {
+			t.Fatalf("expected %v in the collection of the bank only", attributes)
+		}
+	}
+
+	// The owner reclaims the rest once the purse expires
+	mustFail(t, contract.ReclaimOfflinePurse(ledger.as(centralBank, "Org2MSP"), purseID))
+	ledger.advance(defaultPurseValidity * time.Second)
+	mustFail(t, contract.ReclaimOfflinePurse(ledger.as(customer, "Org1MSP"), purseID))
+	mustSucceed(t, contract.ReclaimOfflinePurse(ledger.as(centralBank, "Org2MSP"), purseID))
+	if name := ledger.lastEvent(); name != "OfflinePurseReclaimed" {
+		t.Fatalf("expected OfflinePurseReclaimed event, got %q", name)
+	}
+
+	results, err = contract.RedeemOfflineVouchers(ledger.as(customer, "Org1MSP"), []OfflineVoucher{sign(5, customer, "10", privateKey)})
+	mustSucceed(t, err)
+	if results[0].Status != VoucherFaulty {
+		t.Fatalf("expected voucher of a closed purse to be rejected, got %+v", results[0])
+	}
+
+	for account, expected := range map[string]string{centralBank: "950.00", customer: "30.00", commercial: "20.00", purseEscrow(purse): "0.00"} {
+		balance, err := contract.BalanceOf(ledger.as(centralBank, "Org2MSP"), account)
+		mustSucceed(t, err)
+		if balance != expected {
+			t.Fatalf("expected balance %s for %s, got %s", expected, account, balance)
+		}
+	}
+}
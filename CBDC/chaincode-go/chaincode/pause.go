@@ -0,0 +1,231 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the scopes of operations that can be paused
+const (
+	PauseAll       = "all"
+	PauseTransfers = "transfers"
+	PauseMinting   = "minting"
+	PauseApprovals = "approvals"
+)
+
+// Define objectType names for prefix
+const pausePrefix = "pause"
+
+var knownPauseScopes = []string{PauseAll, PauseTransfers, PauseMinting, PauseApprovals}
+
+// PauseState records an active pause of a scope of operations
+type PauseState struct {
+	Scope    string    `json:"scope"`
+	Reason   string    `json:"reason"`
+	PausedBy string    `json:"pausedBy"`
+	PausedAt time.Time `json:"pausedAt"`
+}
+
+// pauseEvent provides an organized struct for emitting pause events
+type pauseEvent struct {
+	Scope  string `json:"scope"`
+	Reason string `json:"reason"`
+	Sender string `json:"sender"`
+}
+
+// Pause stops a scope of operations in Erc20Contract and TeaContract until Unpause is called.
+// param {String} scope "all", "transfers", "minting" (mint and burn) or "approvals"
+// Pausing transfers also stops escrowed funds from being released or returned, e.g. by RejectRedemption or CancelSwap.
+// Queries and the role, account registry and pause management functions keep working while paused,
+// so that administrators and regulators can respond to the incident
+// This function triggers a Paused event
+func (s *Erc20Contract) Pause(ctx contractapi.TransactionContextInterface, scope string, reason string) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to pause the contract: %v", err)
+	}
+
+	err = validatePauseScope(scope)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		return fmt.Errorf("a reason is required to pause the contract")
+	}
+
+	existing, err := readPause(ctx, scope)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("scope %s is already paused: %s", scope, existing.Reason)
+	}
+
+	sender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	key, err := compositeKey(ctx, pausePrefix, scope)
+	if err != nil {
+		return err
+	}
+
+	pauseJSON, err := json.Marshal(PauseState{scope, reason, sender, now})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, pauseJSON)
+	if err != nil {
+		return fmt.Errorf("failed to pause scope %s: %v", scope, err)
+	}
+
+	err = emitPauseEvent(ctx, "Paused", pauseEvent{scope, reason, sender})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("scope %s paused: %s", scope, reason)
+
+	return nil
+}
+
+// Unpause resumes a paused scope of operations
+// This function triggers an Unpaused event
+func (s *Erc20Contract) Unpause(ctx contractapi.TransactionContextInterface, scope string, reason string) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to unpause the contract: %v", err)
+	}
+
+	err = validatePauseScope(scope)
+	if err != nil {
+		return err
+	}
+
+	existing, err := readPause(ctx, scope)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return fmt.Errorf("scope %s is not paused", scope)
+	}
+
+	key, err := compositeKey(ctx, pausePrefix, scope)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to unpause scope %s: %v", scope, err)
+	}
+
+	sender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	err = emitPauseEvent(ctx, "Unpaused", pauseEvent{scope, reason, sender})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("scope %s unpaused: %s", scope, reason)
+
+	return nil
+}
+
+// ListPauses returns all currently paused scopes
+func (s *Erc20Contract) ListPauses(ctx contractapi.TransactionContextInterface) ([]PauseState, error) {
+
+	pauses := []PauseState{}
+	for _, scope := range knownPauseScopes {
+		pause, err := readPause(ctx, scope)
+		if err != nil {
+			return nil, err
+		}
+		if pause != nil {
+			pauses = append(pauses, *pause)
+		}
+	}
+
+	return pauses, nil
+}
+
+// Helper Functions
+
+// checkNotPaused fails when the scope, or all operations, are paused
+func checkNotPaused(ctx contractapi.TransactionContextInterface, scope string) error {
+	for _, paused := range []string{PauseAll, scope} {
+		pause, err := readPause(ctx, paused)
+		if err != nil {
+			return err
+		}
+		if pause != nil {
+			return fmt.Errorf("%s operations are paused: %s", scope, pause.Reason)
+		}
+	}
+
+	return nil
+}
+
+// readPause returns the active pause of a scope, or nil when the scope is not paused
+func readPause(ctx contractapi.TransactionContextInterface, scope string) (*PauseState, error) {
+	key, err := compositeKey(ctx, pausePrefix, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	pauseBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pause of scope %s from world state: %v", scope, err)
+	}
+	if pauseBytes == nil {
+		return nil, nil
+	}
+
+	pause := new(PauseState)
+	err = json.Unmarshal(pauseBytes, pause)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pause of scope %s: %v", scope, err)
+	}
+
+	return pause, nil
+}
+
+func validatePauseScope(scope string) error {
+	for _, known := range knownPauseScopes {
+		if scope == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown pause scope %s, expected %s, %s, %s or %s", scope, PauseAll, PauseTransfers, PauseMinting, PauseApprovals)
+}
+
+// emitPauseEvent emits a Paused or Unpaused event
+func emitPauseEvent(ctx contractapi.TransactionContextInterface, name string, e pauseEvent) error {
+	eventJSON, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package chaincode
+
+import "testing"
+
+func TestPauseScopes(t *testing.T) {
+	tea := new(TeaContract)
+	ledger, contract := newFundedLedger(t, TierFull, customer)
+
+	mustFail(t, contract.Pause(ledger.as(commercial, "Org1MSP"), PauseAll, "incident"))
+	mustFail(t, contract.Pause(ledger.as(centralBank, "Org2MSP"), "everything", "incident"))
+	mustFail(t, contract.Pause(ledger.as(centralBank, "Org2MSP"), PauseTransfers, ""))
+
+	mustSucceed(t, contract.Pause(ledger.as(centralBank, "Org2MSP"), PauseTransfers, "double spend investigation"))
+	if name := ledger.lastEvent(); name != "Paused" {
+		t.Fatalf("expected Paused event, got %q", name)
+	}
+	mustFail(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "10"))
+	mustSucceed(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "10", Check{}))
+	mustSucceed(t, contract.Approve(ledger.as(centralBank, "Org2MSP"), commercial, "10"))
+
+	// Queries keep working while paused
+	_, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), centralBank)
+	mustSucceed(t, err)
+
+	mustSucceed(t, contract.Pause(ledger.as(centralBank, "Org2MSP"), PauseAll, "network attack"))
+	mustFail(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "10", Check{}))
+	mustFail(t, contract.Approve(ledger.as(centralBank, "Org2MSP"), commercial, "10"))
+	_, err = tea.Mint(ledger.as(centralBank, "Org2MSP"), "Earl Grey", 10, 1, "")
+	mustFail(t, err)
+
+	pauses, err := contract.ListPauses(ledger.as(customer, "Org1MSP"))
+	mustSucceed(t, err)
+	if len(pauses) != 2 {
+		t.Fatalf("expected 2 paused scopes, got %d", len(pauses))
+	}
+
+	mustSucceed(t, contract.Unpause(ledger.as(centralBank, "Org2MSP"), PauseAll, "attack mitigated"))
+	if name := ledger.lastEvent(); name != "Unpaused" {
+		t.Fatalf("expected Unpaused event, got %q", name)
+	}
+	mustFail(t, contract.Unpause(ledger.as(centralBank, "Org2MSP"), PauseAll, "attack mitigated"))
+	mustSucceed(t, contract.Unpause(ledger.as(centralBank, "Org2MSP"), PauseTransfers, "investigation closed"))
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "10"))
+}
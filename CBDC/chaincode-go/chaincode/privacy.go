@@ -0,0 +1,937 @@
+package chaincode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// Private data collections are generated per bank by collections.sh. Balances, allowances and other state of an
+// account registered with the KYC registry live in the collection of its servicing bank, which the central bank
+// is a member of too. Transfers between customers of two banks are recorded in the collection of the bank pair
+const (
+	balancesCollectionPrefix  = "balances"
+	transfersCollectionPrefix = "transfers"
+)
+
+// Define objectType names for prefix
+const (
+	transferLocatorPrefix = "transferAt"
+	recordLocatorPrefix   = "recordAt"
+	attestationPrefix     = "attestation"
+)
+
+// Define key names for options
+const (
+	saltSeedField     = "saltSeed"
+	saltSeedTransient = "seed"
+	latestField       = "latest"
+)
+
+// minSaltSeedLength is the minimum number of bytes of a salt seed
+const minSaltSeedLength = 32
+
+// saltedValue wraps every value stored in a private data collection. Fabric puts the hash of private values on the
+// channel ledger, the salt keeps small values such as balances from being found by hashing every candidate
+type saltedValue struct {
+	Value string `json:"value"`
+	Salt  string `json:"salt"`
+}
+
+// privateEvent replaces the payload of an event of a payment involving an account with a servicing bank.
+// Events are public to the whole channel, so parties and amounts stay in the collection the payment is recorded in
+type privateEvent struct {
+	TxID string `json:"txID"`
+	ID   string `json:"id,omitempty"`
+}
+
+// BankHoldings is the total held by the customers of a bank in its private data collection
+type BankHoldings struct {
+	Bank  string `json:"bank"`
+	Total string `json:"total"`
+}
+
+// SupplyAttestation shows that the balances kept in private data collections and world state add up to the total
+// supply, without revealing the balance of any single account
+type SupplyAttestation struct {
+	TxID           string         `json:"txID"`
+	TotalSupply    string         `json:"totalSupply"`
+	PublicBalances string         `json:"publicBalances"`
+	Banks          []BankHoldings `json:"banks"`
+	Balanced       bool           `json:"balanced"`
+	AttestedBy     string         `json:"attestedBy"`
+	AttestedAt     time.Time      `json:"attestedAt"`
+}
+
+// SetSaltSeed sets the secret the salts of the private data collection of the calling bank are derived from.
+// The seed is passed in the transient field "seed" so that it never reaches the channel ledger.
+// Until a bank sets its seed, no state of its customers can be written
+// This function triggers a SaltSeedSet event
+func (s *Erc20Contract) SetSaltSeed(ctx contractapi.TransactionContextInterface) error {
+
+	err := requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set salt seeds: %v", err)
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get transient data: %v", err)
+	}
+	seed := transient[saltSeedTransient]
+	if len(seed) < minSaltSeedLength {
+		return fmt.Errorf("transient field %q must hold a seed of at least %d bytes", saltSeedTransient, minSaltSeedLength)
+	}
+
+	bank, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	key, err := configKey(ctx, saltSeedField)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutPrivateData(balancesCollection(bank), key, seed)
+	if err != nil {
+		return fmt.Errorf("failed to set salt seed of %s: %v", bank, err)
+	}
+
+	eventJSON, err := json.Marshal(struct {
+		Bank string `json:"bank"`
+	}{bank})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("SaltSeedSet", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("salt seed of %s set", bank)
+
+	return nil
+}
+
+// AttestSupply adds up the balances of every bank's customers and the balances kept in world state and compares
+// them with the total supply. Only the totals per bank are stored on the channel ledger.
+// It must be endorsed by a peer that is a member of every balances collection, i.e. one of the central bank
+// This function triggers a SupplyAttested event
+func (s *Erc20Contract) AttestSupply(ctx contractapi.TransactionContextInterface) (*SupplyAttestation, error) {
+
+	err := requireRole(ctx, RoleAdmin, RoleAuditor, RoleRegulator)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to attest the supply: %v", err)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	holdings, registered, err := sumBankHoldings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	publicBalances, err := sumPublicBalances(ctx, registered)
+	if err != nil {
+		return nil, err
+	}
+
+	totalSupply, err := readTotalSupply(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve total token supply: %v", err)
+	}
+
+	sum := new(big.Int).Set(publicBalances)
+	banks := make([]string, 0, len(holdings))
+	for bank, total := range holdings {
+		banks = append(banks, bank)
+		sum.Add(sum, total)
+	}
+	sort.Strings(banks)
+
+	attestation := &SupplyAttestation{
+		TxID:           ctx.GetStub().GetTxID(),
+		TotalSupply:    formatAmount(totalSupply, decimals),
+		PublicBalances: formatAmount(publicBalances, decimals),
+		Banks:          []BankHoldings{},
+		Balanced:       sum.Cmp(totalSupply) == 0,
+		AttestedBy:     clientID,
+		AttestedAt:     now,
+	}
+	for _, bank := range banks {
+		attestation.Banks = append(attestation.Banks, BankHoldings{bank, formatAmount(holdings[bank], decimals)})
+	}
+
+	key, err := compositeKey(ctx, attestationPrefix, latestField)
+	if err != nil {
+		return nil, err
+	}
+
+	attestationJSON, err := json.Marshal(attestation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, attestationJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store supply attestation: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("SupplyAttested", attestationJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("supply of %s attested by %s, balanced: %t", attestation.TotalSupply, clientID, attestation.Balanced)
+
+	return attestation, nil
+}
+
+// GetSupplyAttestation returns the latest supply attestation
+func (s *Erc20Contract) GetSupplyAttestation(ctx contractapi.TransactionContextInterface) (*SupplyAttestation, error) {
+
+	key, err := compositeKey(ctx, attestationPrefix, latestField)
+	if err != nil {
+		return nil, err
+	}
+
+	attestationBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read supply attestation from world state: %v", err)
+	}
+	if attestationBytes == nil {
+		return nil, fmt.Errorf("the supply has not been attested yet")
+	}
+
+	attestation := new(SupplyAttestation)
+	err = json.Unmarshal(attestationBytes, attestation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode supply attestation: %v", err)
+	}
+
+	return attestation, nil
+}
+
+// Helper Functions
+
+// balancesCollection returns the private data collection holding the state of the customers of a bank
+func balancesCollection(bank string) string {
+	return balancesCollectionPrefix + bank
+}
+
+// transfersCollection returns the private data collection holding the transfers between customers of two banks
+func transfersCollection(bank string, otherBank string) string {
+	if bank > otherBank {
+		bank, otherBank = otherBank, bank
+	}
+
+	return transfersCollectionPrefix + bank + "_" + otherBank
+}
+
+// accountBank returns the servicing bank of an account, or "" for accounts whose state is kept in world state,
+// which are accounts not registered with the KYC registry and internal accounts other than escrows of registered accounts
+func accountBank(ctx contractapi.TransactionContextInterface, account string) (string, error) {
+	if isInternalAccount(account) {
+		return escrowBank(account), nil
+	}
+
+	registered, err := readAccount(ctx, account)
+	if err != nil {
+		return "", err
+	}
+	if registered == nil {
+		return "", nil
+	}
+
+	return registered.Bank, nil
+}
+
+// escrowAccount returns the internal account holding tokens of owner for an object such as a lock. The escrow of an
+// account with a servicing bank is kept in the collection of that bank, which is part of the escrow ID so that it
+// does not depend on state written by the same transaction. Objects store the ID as the bank of the owner may change
+func escrowAccount(ctx contractapi.TransactionContextInterface, kind string, id string, owner string) (string, error) {
+	bank, err := accountBank(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+	if bank == "" {
+		return internalAccount(kind, id), nil
+	}
+
+	return internalAccount(kind, internalAccount(id, bank)), nil
+}
+
+// escrowBank returns the servicing bank of an escrow returned by escrowAccount, or "" for other internal accounts
+func escrowBank(account string) string {
+	parts := strings.SplitN(account, "::", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+
+	return parts[2]
+}
+
+// transferCollection returns the private data collection recording a transfer between two accounts together with
+// the servicing banks of the two, or "" when neither has a servicing bank and the transfer is recorded in world state
+func transferCollection(ctx contractapi.TransactionContextInterface, from string, to string) (string, []string, error) {
+	fromBank, err := accountBank(ctx, from)
+	if err != nil {
+		return "", nil, err
+	}
+
+	toBank, err := accountBank(ctx, to)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case fromBank == "" && toBank == "":
+		return "", nil, nil
+	case fromBank == "" || fromBank == toBank:
+		return balancesCollection(toBank), []string{toBank}, nil
+	case toBank == "":
+		return balancesCollection(fromBank), []string{fromBank}, nil
+	}
+
+	return transfersCollection(fromBank, toBank), []string{fromBank, toBank}, nil
+}
+
+// emitPaymentEvent emits the event of a payment between accounts, every event naming parties or amounts goes
+// through it. Events are public to the whole channel, so when any of the accounts has a servicing bank the event
+// only carries the transaction and the ID of the affected object, e.g. a lock, instead of the payload
+func emitPaymentEvent(ctx contractapi.TransactionContextInterface, name string, id string, payload interface{}, accounts ...string) error {
+	for _, account := range accounts {
+		bank, err := accountBank(ctx, account)
+		if err != nil {
+			return err
+		}
+		if bank != "" {
+			payload = privateEvent{ctx.GetStub().GetTxID(), id}
+			break
+		}
+	}
+
+	eventJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// visibleBanks returns the banks whose collections are searched for the transfers of the client: its MSP and the
+// servicing bank of its account, or every bank with registered accounts for clients with the AUDITOR or REGULATOR role
+func visibleBanks(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	overseer, err := callerHasAnyRole(ctx, RoleAuditor, RoleRegulator)
+	if err != nil {
+		return nil, err
+	}
+	if !overseer {
+		mspID, err := ctx.GetClientIdentity().GetMSPID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get MSPID: %v", err)
+		}
+
+		clientID, err := ctx.GetClientIdentity().GetID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client id: %v", err)
+		}
+
+		bank, err := accountBank(ctx, clientID)
+		if err != nil {
+			return nil, err
+		}
+		if bank == "" || bank == mspID {
+			return []string{mspID}, nil
+		}
+
+		return []string{mspID, bank}, nil
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accounts from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	seen := make(map[string]bool)
+	banks := []string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		account := new(Account)
+		err = json.Unmarshal(queryResponse.Value, account)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode account %s: %v", queryResponse.Key, err)
+		}
+
+		if !seen[account.Bank] {
+			seen[account.Bank] = true
+			banks = append(banks, account.Bank)
+		}
+	}
+	sort.Strings(banks)
+
+	return banks, nil
+}
+
+// requireAccountReader succeeds for the clients that may read the private state of an account: the account itself,
+// clients of its servicing bank and the central bank roles. State of accounts without a servicing bank is public
+func requireAccountReader(ctx contractapi.TransactionContextInterface, account string) error {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID == account {
+		return nil
+	}
+
+	bank, err := accountBank(ctx, account)
+	if err != nil {
+		return err
+	}
+	if bank == "" {
+		return nil
+	}
+
+	err = requireBankOrCentralBank(ctx, bank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to read the state of %s: %v", account, err)
+	}
+
+	return nil
+}
+
+// requireRecordReader succeeds for the clients that may read a record naming the accounts, such as a lock: the
+// accounts themselves, clients of their servicing banks and the central bank roles. Other records are public
+func requireRecordReader(ctx contractapi.TransactionContextInterface, accounts ...string) error {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	banks, err := accountBanks(ctx, accounts...)
+	if err != nil {
+		return err
+	}
+	if len(banks) == 0 {
+		return nil
+	}
+
+	for _, account := range accounts {
+		if account == clientID {
+			return nil
+		}
+	}
+	for _, bank := range banks {
+		err = requireBankOrCentralBank(ctx, bank)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// accountBanks returns the distinct servicing banks of the accounts, in the order of the accounts
+func accountBanks(ctx contractapi.TransactionContextInterface, accounts ...string) ([]string, error) {
+	seen := make(map[string]bool)
+	banks := []string{}
+	for _, account := range accounts {
+		bank, err := accountBank(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		if bank != "" && !seen[bank] {
+			seen[bank] = true
+			banks = append(banks, bank)
+		}
+	}
+
+	return banks, nil
+}
+
+// readRecord reads a record stored by putRecord, it returns nil when the key does not exist
+func readRecord(ctx contractapi.TransactionContextInterface, key string) ([]byte, error) {
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from world state: %v", key, err)
+	}
+	if value != nil {
+		return value, nil
+	}
+
+	locatorKey, err := recordLocatorKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	banksJSON, err := ctx.GetStub().GetState(locatorKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from world state: %v", locatorKey, err)
+	}
+	if banksJSON == nil {
+		return nil, nil
+	}
+
+	var banks []string
+	err = json.Unmarshal(banksJSON, &banks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the location of %s: %v", key, err)
+	}
+
+	for _, bank := range banks {
+		value, err = readPrivate(ctx, balancesCollection(bank), key)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			return value, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s is not available on this peer", key)
+}
+
+// putRecord stores a record naming accounts, such as a lock, under a composite key. Records naming accounts with
+// a servicing bank are kept in the collection of each of their banks, world state only tells which collections
+// hold the record, which the private data hashes on the ledger show anyway
+func putRecord(ctx contractapi.TransactionContextInterface, key string, value []byte, accounts ...string) error {
+	banks, err := accountBanks(ctx, accounts...)
+	if err != nil {
+		return err
+	}
+
+	if len(banks) == 0 {
+		err = ctx.GetStub().PutState(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", key, err)
+		}
+
+		return nil
+	}
+
+	for _, bank := range banks {
+		err = putPrivate(ctx, balancesCollection(bank), key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	locatorKey, err := recordLocatorKey(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	banksJSON, err := json.Marshal(banks)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(locatorKey, banksJSON)
+	if err != nil {
+		return fmt.Errorf("failed to locate %s: %v", key, err)
+	}
+
+	// Records written before one of the accounts was registered leave world state
+	legacy, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read %s from world state: %v", key, err)
+	}
+	if legacy != nil {
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s from world state: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// recordLocatorKey returns the world state key telling which collections hold the record stored under key
+func recordLocatorKey(ctx contractapi.TransactionContextInterface, key string) (string, error) {
+	objectType, attributes, err := ctx.GetStub().SplitCompositeKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to split composite key %s: %v", key, err)
+	}
+
+	return compositeKey(ctx, recordLocatorPrefix, append([]string{objectType}, attributes...)...)
+}
+
+// readAccountState reads state of an account from the collection of its servicing bank, or from world state for
+// accounts without one. It returns nil when the key does not exist
+func readAccountState(ctx contractapi.TransactionContextInterface, account string, key string) ([]byte, error) {
+	bank, err := accountBank(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	if bank != "" {
+		value, err := readPrivate(ctx, balancesCollection(bank), key)
+		if err != nil || value != nil {
+			return value, err
+		}
+		// State of accounts registered before it was kept in private data stays in world state until it is next written
+	}
+
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from world state: %v", key, err)
+	}
+
+	return value, nil
+}
+
+// putAccountState stores state of an account where readAccountState finds it
+func putAccountState(ctx contractapi.TransactionContextInterface, account string, key string, value []byte) error {
+	bank, err := accountBank(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	if bank == "" {
+		err = ctx.GetStub().PutState(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", key, err)
+		}
+
+		return nil
+	}
+
+	err = putPrivate(ctx, balancesCollection(bank), key, value)
+	if err != nil {
+		return err
+	}
+
+	legacy, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read %s from world state: %v", key, err)
+	}
+	if legacy != nil {
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s from world state: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// delAccountState deletes state of an account stored by putAccountState
+func delAccountState(ctx contractapi.TransactionContextInterface, account string, key string) error {
+	bank, err := accountBank(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	if bank != "" {
+		err = ctx.GetStub().DelPrivateData(balancesCollection(bank), key)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s from collection %s: %v", key, balancesCollection(bank), err)
+		}
+	}
+
+	legacy, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read %s from world state: %v", key, err)
+	}
+	if legacy != nil {
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s from world state: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// readStateByPartialKey returns what putRecord or putAccountState stored for the accounts under a partial composite
+// key, from world state and from the collections of the servicing banks of the accounts, sorted by key
+func readStateByPartialKey(ctx contractapi.TransactionContextInterface, objectType string, attributes []string, accounts ...string) ([]*queryresult.KV, error) {
+	banks, err := accountBanks(ctx, accounts...)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string][]byte)
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from world state: %v", objectType, err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		states[queryResponse.Key] = queryResponse.Value
+	}
+
+	for _, bank := range banks {
+		collection := balancesCollection(bank)
+		privateIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, objectType, attributes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from collection %s: %v", objectType, collection, err)
+		}
+		defer privateIterator.Close()
+
+		for privateIterator.HasNext() {
+			queryResponse, err := privateIterator.Next()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := unsalt(collection, queryResponse.Key, queryResponse.Value)
+			if err != nil {
+				return nil, err
+			}
+			states[queryResponse.Key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(states))
+	for key := range states {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	results := make([]*queryresult.KV, len(keys))
+	for i, key := range keys {
+		results[i] = &queryresult.KV{Key: key, Value: states[key]}
+	}
+
+	return results, nil
+}
+
+// readPrivate reads a salted value from a private data collection, it returns nil when the key does not exist
+func readPrivate(ctx contractapi.TransactionContextInterface, collection string, key string) ([]byte, error) {
+	valueBytes, err := ctx.GetStub().GetPrivateData(collection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from collection %s: %v", key, collection, err)
+	}
+	if valueBytes == nil {
+		return nil, nil
+	}
+
+	return unsalt(collection, key, valueBytes)
+}
+
+// unsalt returns the value wrapped by a salted value read from a private data collection
+func unsalt(collection string, key string, valueBytes []byte) ([]byte, error) {
+	value := new(saltedValue)
+	err := json.Unmarshal(valueBytes, value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s of collection %s: %v", key, collection, err)
+	}
+
+	return []byte(value.Value), nil
+}
+
+// putPrivate stores a value in a private data collection together with a fresh salt. The salt is derived from
+// the seeds of the given bank collections, or from the seed of the collection itself when none are given
+func putPrivate(ctx contractapi.TransactionContextInterface, collection string, key string, value []byte, seedCollections ...string) error {
+	if len(seedCollections) == 0 {
+		seedCollections = []string{collection}
+	}
+
+	salt, err := privateSalt(ctx, seedCollections, key)
+	if err != nil {
+		return err
+	}
+
+	valueJSON, err := json.Marshal(saltedValue{string(value), salt})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(collection, key, valueJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update %s of collection %s: %v", key, collection, err)
+	}
+
+	return nil
+}
+
+// privateSalt derives the salt of a private value from the seeds of bank collections, the key and the transaction.
+// Every endorsing member peer derives the same salt, while other organizations can't derive it without the seeds.
+// Without a seed the salt would only depend on public data, so it fails until every bank has set its seed
+func privateSalt(ctx contractapi.TransactionContextInterface, seedCollections []string, key string) (string, error) {
+	seedKey, err := configKey(ctx, saltSeedField)
+	if err != nil {
+		return "", err
+	}
+
+	var mac hash.Hash
+	for _, collection := range seedCollections {
+		seed, err := ctx.GetStub().GetPrivateData(collection, seedKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to read salt seed of collection %s: %v", collection, err)
+		}
+		if seed == nil {
+			return "", fmt.Errorf("salt seed of collection %s is not set, its bank must call SetSaltSeed() first", collection)
+		}
+
+		if mac == nil {
+			mac = hmac.New(sha256.New, seed)
+		} else {
+			mac.Write(seed)
+		}
+	}
+
+	mac.Write([]byte(ctx.GetStub().GetTxID()))
+	mac.Write([]byte(key))
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// sumBankHoldings adds up the balances of the registered accounts per servicing bank,
+// it also returns the set of registered accounts
+func sumBankHoldings(ctx contractapi.TransactionContextInterface) (map[string]*big.Int, map[string]bool, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountPrefix, []string{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read accounts from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	holdings := make(map[string]*big.Int)
+	registered := make(map[string]bool)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		account := new(Account)
+		err = json.Unmarshal(queryResponse.Value, account)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode account %s: %v", queryResponse.Key, err)
+		}
+
+		balance, _, err := readBalance(ctx, account.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if _, ok := holdings[account.Bank]; !ok {
+			holdings[account.Bank] = new(big.Int)
+		}
+		holdings[account.Bank].Add(holdings[account.Bank], balance)
+		registered[account.ID] = true
+	}
+
+	for bank, total := range holdings {
+		escrows, err := sumEscrows(ctx, bank)
+		if err != nil {
+			return nil, nil, err
+		}
+		total.Add(total, escrows)
+	}
+
+	return holdings, registered, nil
+}
+
+// sumEscrows adds up the balances of the escrows kept in the collection of a bank
+func sumEscrows(ctx contractapi.TransactionContextInterface, bank string) (*big.Int, error) {
+	collection := balancesCollection(bank)
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, balancePrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balances from collection %s: %v", collection, err)
+	}
+	defer resultsIterator.Close()
+
+	sum := new(big.Int)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key %s: %v", queryResponse.Key, err)
+		}
+		if escrowBank(attributes[0]) != bank {
+			continue
+		}
+
+		value, err := unsalt(collection, queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		balance, _, err := decodeAmount(queryResponse.Key, value)
+		if err != nil {
+			return nil, err
+		}
+		sum.Add(sum, balance)
+	}
+
+	return sum, nil
+}
+
+// sumPublicBalances adds up the balances kept in world state, leaving out registered accounts,
+// which sumBankHoldings counted already
+func sumPublicBalances(ctx contractapi.TransactionContextInterface, registered map[string]bool) (*big.Int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(balancePrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balances from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	sum := new(big.Int)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key %s: %v", queryResponse.Key, err)
+		}
+		if registered[attributes[0]] {
+			continue
+		}
+
+		balance, ok := new(big.Int).SetString(string(queryResponse.Value), 10)
+		if !ok {
+			return nil, fmt.Errorf("value %q stored under %s is not an integer amount", queryResponse.Value, queryResponse.Key)
+		}
+		sum.Add(sum, balance)
+	}
+
+	return sum, nil
+}
@@ -0,0 +1,119 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPrivateBalances(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer)
+
+	ledger.stub.TransientMap = map[string][]byte{saltSeedTransient: []byte("too short")}
+	mustFail(t, contract.SetSaltSeed(ledger.as(commercial, "Org1MSP")))
+	ledger.stub.TransientMap = map[string][]byte{saltSeedTransient: []byte(strings.Repeat("s", minSaltSeedLength))}
+	mustSucceed(t, contract.SetSaltSeed(ledger.as(commercial, "Org1MSP")))
+	ledger.stub.TransientMap = nil
+
+	ctx := ledger.as(centralBank, "Org2MSP")
+	payment := ctx.GetStub().GetTxID()
+	mustSucceed(t, contract.TransferWithRemittance(ctx, customer, "300", Remittance{Memo: "payroll"}))
+
+	// The balance of the registered customer is kept salted in the collection of its bank only
+	customerKey, err := balanceKey(ctx, customer)
+	mustSucceed(t, err)
+	if ledger.stub.State[customerKey] != nil {
+		t.Fatalf("expected no balance of the customer in world state")
+	}
+	stored := new(saltedValue)
+	mustSucceed(t, json.Unmarshal(ledger.stub.PvtState[balancesCollection("Org1MSP")][customerKey], stored))
+	if stored.Value != "30000" || stored.Salt == "" {
+		t.Fatalf("unexpected private balance %+v", stored)
+	}
+
+	// The transfer itself is recorded in the collection too, world state doesn't tell about it
+	record, err := contract.GetTransfer(ledger.as(customer, "Org1MSP"), payment)
+	mustSucceed(t, err)
+	if record.Value != "300.00" || record.Remittance.Memo != "payroll" {
+		t.Fatalf("unexpected transfer %+v", record)
+	}
+	transferKey, err := compositeKey(ctx, transferPrefix, payment)
+	mustSucceed(t, err)
+	locatorKey, err := compositeKey(ctx, transferLocatorPrefix, payment)
+	mustSucceed(t, err)
+	if ledger.stub.State[transferKey] != nil || ledger.stub.State[locatorKey] != nil {
+		t.Fatalf("expected no transfer record in world state")
+	}
+	if ledger.stub.PvtState[balancesCollection("Org1MSP")][locatorKey] == nil {
+		t.Fatalf("expected the transfer to be located in the collection of the bank")
+	}
+
+	// A balance held before the account was registered moves to the collection when it is next written
+	ledger.registerAccounts(contract, TierFull, centralBank)
+	balance, err := contract.BalanceOf(ledger.as(centralBank, "Org2MSP"), centralBank)
+	mustSucceed(t, err)
+	if balance != "700.00" {
+		t.Fatalf("expected balance 700.00, got %s", balance)
+	}
+
+	attestation, err := contract.AttestSupply(ledger.as(centralBank, "Org2MSP"))
+	mustSucceed(t, err)
+	if !attestation.Balanced || len(attestation.Banks) != 1 || attestation.Banks[0].Total != "1000.00" || attestation.PublicBalances != "0.00" {
+		t.Fatalf("unexpected attestation %+v", attestation)
+	}
+	if name := ledger.lastEvent(); name != "SupplyAttested" {
+		t.Fatalf("expected SupplyAttested event, got %q", name)
+	}
+
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "100"))
+	centralBankKey, err := balanceKey(ctx, centralBank)
+	mustSucceed(t, err)
+	if ledger.stub.State[centralBankKey] != nil {
+		t.Fatalf("expected the legacy balance to be removed from world state")
+	}
+
+	_, err = contract.AttestSupply(ledger.as(customer, "Org1MSP"))
+	mustFail(t, err)
+	attestation, err = contract.GetSupplyAttestation(ledger.as(customer, "Org1MSP"))
+	mustSucceed(t, err)
+	if attestation.TotalSupply != "1000.00" {
+		t.Fatalf("expected attested supply 1000.00, got %s", attestation.TotalSupply)
+	}
+
+	for account, expected := range map[string]string{centralBank: "600.00", customer: "400.00"} {
+		balance, err := contract.BalanceOf(ledger.as(centralBank, "Org2MSP"), account)
+		mustSucceed(t, err)
+		if balance != expected {
+			t.Fatalf("expected balance %s, got %s", expected, balance)
+		}
+	}
+
+	// Clients of other banks can't read the holdings of the customer
+	other := clientID("CN=user1,OU=client,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org3.example.com")
+	_, err = contract.BalanceOf(ledger.as(other, "Org3MSP"), customer)
+	mustFail(t, err)
+	_, err = contract.Allowance(ledger.as(other, "Org3MSP"), customer, centralBank)
+	mustFail(t, err)
+	balance, err = contract.BalanceOf(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if balance != "400.00" {
+		t.Fatalf("expected balance 400.00, got %s", balance)
+	}
+}
+
+func TestSaltSeedRequired(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull)
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleBank, MemberTypeMSP, "Org1MSP"))
+	mustSucceed(t, contract.RegisterAccount(ledger.as(commercial, "Org1MSP"), customer, TierFull))
+
+	// Salts derived without the seed of the bank could be derived by anyone, so nothing is written without it
+	mustFail(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "100"))
+	ledger.setSaltSeed(contract, commercial, "Org1MSP")
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "100"))
+
+	balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if balance != "100.00" {
+		t.Fatalf("expected balance 100.00, got %s", balance)
+	}
+}
@@ -0,0 +1,688 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the kinds of supply proposals, a policy proposal changes the approval policy itself
+const (
+	ProposalMint   = "mint"
+	ProposalBurn   = "burn"
+	ProposalPolicy = "policy"
+)
+
+// Define the statuses of a supply proposal
+const (
+	ProposalPending   = "pending"
+	ProposalExecuted  = "executed"
+	ProposalCancelled = "cancelled"
+	ProposalExpired   = "expired"
+)
+
+// Define objectType names for prefix
+const (
+	proposalPrefix        = "proposal"
+	pendingProposalPrefix = "pendingProposal"
+)
+
+// Define key names for options
+const approvalPolicyField = "approvalPolicy"
+
+// ApprovalPolicy requires Threshold of the ApproverMSPs to approve a change of the money supply.
+// While a policy is set Mint, Burn and IssueToBank are refused and the supply changes through proposals only.
+// The policy can then be tightened directly, loosening or removing it needs its own approvals through ProposeApprovalPolicy
+type ApprovalPolicy struct {
+	ApproverMSPs []string `json:"approverMSPs"`
+	Threshold    int      `json:"threshold"`
+	ProposalTTL  int      `json:"proposalTTL"`
+}
+
+// ProposalApproval records who approved a supply proposal on behalf of which organization
+type ProposalApproval struct {
+	Approver   string    `json:"approver"`
+	MSP        string    `json:"msp"`
+	ApprovedAt time.Time `json:"approvedAt"`
+}
+
+// SupplyProposal is a pending mint, burn or approval policy change waiting for the approvals
+// the policy in force at its creation requires
+type SupplyProposal struct {
+	ID           string             `json:"id"`
+	Kind         string             `json:"kind"`
+	Account      string             `json:"account,omitempty"`
+	Bank         string             `json:"bank,omitempty"`
+	Amount       string             `json:"amount,omitempty"`
+	Policy       *ApprovalPolicy    `json:"policy,omitempty"`
+	Proposer     string             `json:"proposer"`
+	ProposerMSP  string             `json:"proposerMSP"`
+	ApproverMSPs []string           `json:"approverMSPs"`
+	Threshold    int                `json:"threshold"`
+	Approvals    []ProposalApproval `json:"approvals"`
+	Status       string             `json:"status"`
+	Reason       string             `json:"reason,omitempty"`
+	CreatedAt    time.Time          `json:"createdAt"`
+	ExpiresAt    time.Time          `json:"expiresAt"`
+}
+
+// SetApprovalPolicy sets the organizations that approve supply proposals and how many of them must approve
+// param {[]String} approverMSPs The MSP IDs whose APPROVER role holders can approve, empty to remove the policy
+// param {int} threshold The number of distinct organizations that must approve, 0 to remove the policy
+// param {int} proposalTTL The number of seconds a proposal can collect approvals
+// This function triggers an ApprovalPolicySet event
+func (s *Erc20Contract) SetApprovalPolicy(ctx contractapi.TransactionContextInterface, approverMSPs []string, threshold int, proposalTTL int) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set the approval policy: %v", err)
+	}
+
+	policy, err := newApprovalPolicy(approverMSPs, threshold, proposalTTL)
+	if err != nil {
+		return err
+	}
+
+	current, err := readApprovalPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if current.Threshold > 0 && loosensPolicy(current, policy) {
+		return fmt.Errorf("loosening or removing the approval policy needs %d of %d approvals, use ProposeApprovalPolicy", current.Threshold, len(current.ApproverMSPs))
+	}
+
+	policyJSON, err := putApprovalPolicy(ctx, policy)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent("ApprovalPolicySet", policyJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("approval policy set to %d of %v", threshold, approverMSPs)
+
+	return nil
+}
+
+// GetApprovalPolicy returns the approval policy for supply proposals
+func (s *Erc20Contract) GetApprovalPolicy(ctx contractapi.TransactionContextInterface) (*ApprovalPolicy, error) {
+	return readApprovalPolicy(ctx)
+}
+
+// ProposeApprovalPolicy proposes to replace the approval policy once enough organizations approved under the current one.
+// Loosening or removing an active policy can only be done this way
+// param {[]String} approverMSPs The MSP IDs whose APPROVER role holders can approve, empty to remove the policy
+// param {int} threshold The number of distinct organizations that must approve, 0 to remove the policy
+// param {int} proposalTTL The number of seconds a proposal can collect approvals
+// returns {String} The ID of the proposal
+// This function triggers a ProposalCreated event
+func (s *Erc20Contract) ProposeApprovalPolicy(ctx contractapi.TransactionContextInterface, approverMSPs []string, threshold int, proposalTTL int) (string, error) {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return "", fmt.Errorf("client is not authorized to propose an approval policy: %v", err)
+	}
+
+	policy, err := newApprovalPolicy(approverMSPs, threshold, proposalTTL)
+	if err != nil {
+		return "", err
+	}
+
+	return createProposal(ctx, ProposalPolicy, "", "", policy)
+}
+
+// ProposeMint proposes to create new tokens once enough organizations approved
+// param {String} amount The decimal amount to mint, e.g. "125.50"
+// param {String} bankMSP The bank whose reserve receives the tokens as with IssueToBank, empty to mint to the proposer as with Mint
+// returns {String} The ID of the proposal
+// This function triggers a ProposalCreated event
+func (s *Erc20Contract) ProposeMint(ctx contractapi.TransactionContextInterface, amount string, bankMSP string) (string, error) {
+
+	err := requireRole(ctx, RoleMinter)
+	if err != nil {
+		return "", fmt.Errorf("client is not authorized to propose minting: %v", err)
+	}
+
+	if bankMSP != "" {
+		isBank, err := roleGranted(ctx, RoleBank, MemberTypeMSP, bankMSP)
+		if err != nil {
+			return "", err
+		}
+		if !isBank {
+			return "", fmt.Errorf("%s is not a licensed bank, %s role required", bankMSP, RoleBank)
+		}
+	}
+
+	return createProposal(ctx, ProposalMint, amount, bankMSP, nil)
+}
+
+// ProposeBurn proposes to redeem tokens of the proposer's account once enough organizations approved
+// param {String} amount The decimal amount to burn, e.g. "125.50"
+// returns {String} The ID of the proposal
+// This function triggers a ProposalCreated event
+func (s *Erc20Contract) ProposeBurn(ctx contractapi.TransactionContextInterface, amount string) (string, error) {
+
+	err := requireRole(ctx, RoleBurner)
+	if err != nil {
+		return "", fmt.Errorf("client is not authorized to propose burning: %v", err)
+	}
+
+	return createProposal(ctx, ProposalBurn, amount, "", nil)
+}
+
+// ApproveProposal approves a pending proposal on behalf of the caller's organization.
+// The proposal is executed in the same transaction when it reaches its threshold
+// This function triggers a ProposalApproved event, or a ProposalExecuted event when the proposal is executed
+func (s *Erc20Contract) ApproveProposal(ctx contractapi.TransactionContextInterface, proposalID string) error {
+
+	err := requireRole(ctx, RoleApprover)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to approve proposals: %v", err)
+	}
+
+	proposal, err := readPendingProposal(ctx, proposalID)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	if clientID == proposal.Proposer {
+		return fmt.Errorf("proposal %s can't be approved by its proposer", proposalID)
+	}
+	if !containsString(proposal.ApproverMSPs, clientMSPID) {
+		return fmt.Errorf("%s is not an approver of proposal %s", clientMSPID, proposalID)
+	}
+	for _, approval := range proposal.Approvals {
+		if approval.MSP == clientMSPID {
+			return fmt.Errorf("proposal %s was already approved by %s", proposalID, clientMSPID)
+		}
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !now.Before(proposal.ExpiresAt) {
+		return fmt.Errorf("proposal %s expired at %s", proposalID, proposal.ExpiresAt)
+	}
+
+	proposal.Approvals = append(proposal.Approvals, ProposalApproval{clientID, clientMSPID, now})
+
+	eventName := "ProposalApproved"
+	if len(proposal.Approvals) >= proposal.Threshold {
+		err = executeProposal(ctx, proposal)
+		if err != nil {
+			return err
+		}
+		proposal.Status = ProposalExecuted
+		eventName = "ProposalExecuted"
+	}
+
+	err = putProposal(ctx, proposal)
+	if err != nil {
+		return err
+	}
+
+	err = emitProposalEvent(ctx, eventName, proposal)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("proposal %s approved by %s, %d of %d approvals", proposalID, clientMSPID, len(proposal.Approvals), proposal.Threshold)
+
+	return nil
+}
+
+// CancelProposal withdraws a pending supply proposal, only its proposer and administrators can cancel it
+// This function triggers a ProposalCancelled event
+func (s *Erc20Contract) CancelProposal(ctx contractapi.TransactionContextInterface, proposalID string, reason string) error {
+
+	proposal, err := readPendingProposal(ctx, proposalID)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != proposal.Proposer {
+		err = requireRole(ctx, RoleAdmin)
+		if err != nil {
+			return fmt.Errorf("client is not authorized to cancel proposal %s: %v", proposalID, err)
+		}
+	}
+
+	proposal.Status = ProposalCancelled
+	proposal.Reason = reason
+
+	err = putProposal(ctx, proposal)
+	if err != nil {
+		return err
+	}
+
+	err = emitProposalEvent(ctx, "ProposalCancelled", proposal)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("proposal %s cancelled by %s: %s", proposalID, clientID, reason)
+
+	return nil
+}
+
+// ExpireProposal closes a pending supply proposal that did not reach its threshold in time, any client can call it
+// This function triggers a ProposalExpired event
+func (s *Erc20Contract) ExpireProposal(ctx contractapi.TransactionContextInterface, proposalID string) error {
+
+	proposal, err := readPendingProposal(ctx, proposalID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now.Before(proposal.ExpiresAt) {
+		return fmt.Errorf("proposal %s does not expire before %s", proposalID, proposal.ExpiresAt)
+	}
+
+	proposal.Status = ProposalExpired
+
+	err = putProposal(ctx, proposal)
+	if err != nil {
+		return err
+	}
+
+	err = emitProposalEvent(ctx, "ProposalExpired", proposal)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("proposal %s expired", proposalID)
+
+	return nil
+}
+
+// GetProposal returns a supply proposal
+func (s *Erc20Contract) GetProposal(ctx contractapi.TransactionContextInterface, proposalID string) (*SupplyProposal, error) {
+	return readProposal(ctx, proposalID)
+}
+
+// ListPendingProposals returns the supply proposals that are neither executed, cancelled nor marked expired
+func (s *Erc20Contract) ListPendingProposals(ctx contractapi.TransactionContextInterface) ([]SupplyProposal, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pendingProposalPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending proposals from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	proposals := []SupplyProposal{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key %s: %v", queryResponse.Key, err)
+		}
+
+		proposal, err := readProposal(ctx, attributes[0])
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, *proposal)
+	}
+
+	return proposals, nil
+}
+
+// Helper Functions
+
+// checkDirectSupplyChange fails while an approval policy requires supply changes to go through proposals
+// Dependant functions include Mint, Burn, IssueToBank, MintDenomination and BurnDenomination
+func checkDirectSupplyChange(ctx contractapi.TransactionContextInterface) error {
+	policy, err := readApprovalPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if policy.Threshold > 0 {
+		return fmt.Errorf("supply changes need %d of %d approvals, use ProposeMint or ProposeBurn", policy.Threshold, len(policy.ApproverMSPs))
+	}
+
+	return nil
+}
+
+// createProposal stores a pending proposal of the calling client under the current approval policy,
+// policy is the proposed approval policy of a ProposalPolicy proposal
+func createProposal(ctx contractapi.TransactionContextInterface, kind string, amount string, bankMSP string, policy *ApprovalPolicy) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	current, err := readApprovalPolicy(ctx)
+	if err != nil {
+		return "", err
+	}
+	if current.Threshold == 0 {
+		return "", fmt.Errorf("no approval policy is set, supply and policy changes don't need proposals")
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	id := ctx.GetStub().GetTxID()
+	proposal := &SupplyProposal{
+		ID:           id,
+		Kind:         kind,
+		Policy:       policy,
+		Proposer:     clientID,
+		ProposerMSP:  clientMSPID,
+		ApproverMSPs: current.ApproverMSPs,
+		Threshold:    current.Threshold,
+		Approvals:    []ProposalApproval{},
+		Status:       ProposalPending,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(time.Duration(current.ProposalTTL) * time.Second),
+	}
+
+	if kind != ProposalPolicy {
+		err = checkNotPaused(ctx, PauseMinting)
+		if err != nil {
+			return "", err
+		}
+
+		decimals, err := readDecimals(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		value, err := parseAmount(amount, decimals)
+		if err != nil {
+			return "", err
+		}
+		if value.Sign() <= 0 {
+			return "", fmt.Errorf("%s amount must be positive", kind)
+		}
+
+		proposal.Account = clientID
+		if bankMSP != "" {
+			proposal.Account = reserveAccount(bankMSP)
+		}
+		proposal.Bank = bankMSP
+		proposal.Amount = formatAmount(value, decimals)
+	}
+
+	err = putProposal(ctx, proposal)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitProposalEvent(ctx, "ProposalCreated", proposal)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("client %s created %s proposal %s", clientID, kind, id)
+
+	return id, nil
+}
+
+// executeProposal applies the supply or approval policy change of an approved proposal
+func executeProposal(ctx contractapi.TransactionContextInterface, proposal *SupplyProposal) error {
+	if proposal.Kind == ProposalPolicy {
+		_, err := putApprovalPolicy(ctx, proposal.Policy)
+		return err
+	}
+
+	err := checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return err
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(proposal.Amount, decimals)
+	if err != nil {
+		return err
+	}
+
+	switch proposal.Kind {
+	case ProposalMint:
+		err = mintHelper(ctx, proposal.Account, value)
+		if err != nil {
+			return err
+		}
+		if proposal.Bank != "" {
+			return addBankTotal(ctx, proposal.Bank, issuedField, value)
+		}
+		return nil
+	case ProposalBurn:
+		return burnHelper(ctx, proposal.Account, value)
+	default:
+		return fmt.Errorf("unknown proposal kind %s", proposal.Kind)
+	}
+}
+
+// readPendingProposal returns a supply proposal that can still be approved, cancelled or expired
+func readPendingProposal(ctx contractapi.TransactionContextInterface, proposalID string) (*SupplyProposal, error) {
+	proposal, err := readProposal(ctx, proposalID)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != ProposalPending {
+		return nil, fmt.Errorf("proposal %s is %s", proposalID, proposal.Status)
+	}
+
+	return proposal, nil
+}
+
+// newApprovalPolicy validates an approval policy, no approver MSPs and a threshold of 0 remove the policy
+func newApprovalPolicy(approverMSPs []string, threshold int, proposalTTL int) (*ApprovalPolicy, error) {
+	if threshold == 0 && len(approverMSPs) == 0 {
+		return &ApprovalPolicy{[]string{}, 0, 0}, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, msp := range approverMSPs {
+		if msp == "" || seen[msp] {
+			return nil, fmt.Errorf("approver MSP IDs must be unique and not empty")
+		}
+		seen[msp] = true
+	}
+	if threshold < 1 || threshold > len(approverMSPs) {
+		return nil, fmt.Errorf("threshold must be between 1 and the number of approver MSPs")
+	}
+	if proposalTTL <= 0 {
+		return nil, fmt.Errorf("proposal TTL must be positive")
+	}
+
+	return &ApprovalPolicy{approverMSPs, threshold, proposalTTL}, nil
+}
+
+// loosensPolicy tells if a new approval policy needs fewer approvals, accepts approvals of other organizations
+// or gives proposals more time than the current one
+func loosensPolicy(current *ApprovalPolicy, policy *ApprovalPolicy) bool {
+	if policy.Threshold < current.Threshold || policy.ProposalTTL > current.ProposalTTL {
+		return true
+	}
+	for _, msp := range policy.ApproverMSPs {
+		if !containsString(current.ApproverMSPs, msp) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readApprovalPolicy(ctx contractapi.TransactionContextInterface) (*ApprovalPolicy, error) {
+	key, err := configKey(ctx, approvalPolicyField)
+	if err != nil {
+		return nil, err
+	}
+
+	policyBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approval policy from world state: %v", err)
+	}
+
+	policy := &ApprovalPolicy{ApproverMSPs: []string{}}
+	if policyBytes == nil {
+		return policy, nil
+	}
+
+	err = json.Unmarshal(policyBytes, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode approval policy: %v", err)
+	}
+
+	return policy, nil
+}
+
+// putApprovalPolicy stores the approval policy and returns its JSON encoding
+func putApprovalPolicy(ctx contractapi.TransactionContextInterface, policy *ApprovalPolicy) ([]byte, error) {
+	key, err := configKey(ctx, approvalPolicyField)
+	if err != nil {
+		return nil, err
+	}
+
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, policyJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set approval policy: %v", err)
+	}
+
+	return policyJSON, nil
+}
+
+func readProposal(ctx contractapi.TransactionContextInterface, proposalID string) (*SupplyProposal, error) {
+	key, err := compositeKey(ctx, proposalPrefix, proposalID)
+	if err != nil {
+		return nil, err
+	}
+
+	proposalBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proposal %s from world state: %v", proposalID, err)
+	}
+	if proposalBytes == nil {
+		return nil, fmt.Errorf("proposal %s does not exist", proposalID)
+	}
+
+	proposal := new(SupplyProposal)
+	err = json.Unmarshal(proposalBytes, proposal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode proposal %s: %v", proposalID, err)
+	}
+
+	return proposal, nil
+}
+
+// putProposal stores a supply proposal and keeps the index of pending proposals up to date
+func putProposal(ctx contractapi.TransactionContextInterface, proposal *SupplyProposal) error {
+	key, err := compositeKey(ctx, proposalPrefix, proposal.ID)
+	if err != nil {
+		return err
+	}
+
+	proposalJSON, err := json.Marshal(proposal)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, proposalJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update proposal %s: %v", proposal.ID, err)
+	}
+
+	pendingKey, err := compositeKey(ctx, pendingProposalPrefix, proposal.ID)
+	if err != nil {
+		return err
+	}
+
+	if proposal.Status == ProposalPending {
+		// Only the key is needed for the index, value can't be empty so store a null byte
+		err = ctx.GetStub().PutState(pendingKey, []byte{0x00})
+	} else {
+		err = ctx.GetStub().DelState(pendingKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update pending proposals: %v", err)
+	}
+
+	return nil
+}
+
+// emitProposalEvent emits a proposal event carrying the proposal with all approvals so far
+func emitProposalEvent(ctx contractapi.TransactionContextInterface, name string, proposal *SupplyProposal) error {
+	eventJSON, err := json.Marshal(proposal)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSupplyProposals(t *testing.T) {
+	approver := clientID("CN=admin,OU=admin,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org3.example.com")
+	ledger, contract := newInitializedLedger(t)
+	mustSucceed(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "100", Check{}))
+
+	mustFail(t, contract.SetApprovalPolicy(ledger.as(centralBank, "Org2MSP"), []string{"Org1MSP", "Org3MSP"}, 3, 3600))
+	mustSucceed(t, contract.SetApprovalPolicy(ledger.as(centralBank, "Org2MSP"), []string{"Org1MSP", "Org3MSP"}, 2, 3600))
+
+	// The policy can be tightened directly, but not loosened or removed
+	mustSucceed(t, contract.SetApprovalPolicy(ledger.as(centralBank, "Org2MSP"), []string{"Org1MSP", "Org3MSP"}, 2, 3000))
+	mustFail(t, contract.SetApprovalPolicy(ledger.as(centralBank, "Org2MSP"), []string{"Org1MSP", "Org3MSP"}, 2, 3600))
+	mustFail(t, contract.SetApprovalPolicy(ledger.as(centralBank, "Org2MSP"), []string{"Org1MSP", "Org3MSP"}, 1, 3000))
+	mustFail(t, contract.SetApprovalPolicy(ledger.as(centralBank, "Org2MSP"), []string{"Org1MSP", "Org2MSP", "Org3MSP"}, 2, 3000))
+	mustFail(t, contract.SetApprovalPolicy(ledger.as(centralBank, "Org2MSP"), []string{}, 0, 0))
+
+	// A single minter can't change the supply anymore
+	mustFail(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "100", Check{}))
+	mustFail(t, contract.Burn(ledger.as(centralBank, "Org2MSP"), "100"))
+
+	_, err := contract.ProposeMint(ledger.as(commercial, "Org1MSP"), "500", "")
+	mustFail(t, err)
+	minted, err := contract.ProposeMint(ledger.as(centralBank, "Org2MSP"), "500", "")
+	mustSucceed(t, err)
+	if name := ledger.lastEvent(); name != "ProposalCreated" {
+		t.Fatalf("expected ProposalCreated event, got %q", name)
+	}
+
+	mustFail(t, contract.ApproveProposal(ledger.as(commercial, "Org1MSP"), minted))
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleApprover, MemberTypeMSP, "Org1MSP"))
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleApprover, MemberTypeMSP, "Org3MSP"))
+
+	mustSucceed(t, contract.ApproveProposal(ledger.as(commercial, "Org1MSP"), minted))
+	if name := ledger.lastEvent(); name != "ProposalApproved" {
+		t.Fatalf("expected ProposalApproved event, got %q", name)
+	}
+
+	// Every organization approves once
+	mustFail(t, contract.ApproveProposal(ledger.as(customer, "Org1MSP"), minted))
+
+	mustSucceed(t, contract.ApproveProposal(ledger.as(approver, "Org3MSP"), minted))
+	if name := ledger.lastEvent(); name != "ProposalExecuted" {
+		t.Fatalf("expected ProposalExecuted event, got %q", name)
+	}
+	mustFail(t, contract.ApproveProposal(ledger.as(approver, "Org3MSP"), minted))
+
+	balance, err := contract.BalanceOf(ledger.as(centralBank, "Org2MSP"), centralBank)
+	mustSucceed(t, err)
+	if balance != "600.00" {
+		t.Fatalf("expected balance 600.00, got %s", balance)
+	}
+
+	proposal, err := contract.GetProposal(ledger.as(centralBank, "Org2MSP"), minted)
+	mustSucceed(t, err)
+	if proposal.Status != ProposalExecuted || len(proposal.Approvals) != 2 {
+		t.Fatalf("unexpected proposal %+v", proposal)
+	}
+
+	// Proposals that don't collect their approvals in time expire
+	burned, err := contract.ProposeBurn(ledger.as(centralBank, "Org2MSP"), "50")
+	mustSucceed(t, err)
+	mustFail(t, contract.ExpireProposal(ledger.as(customer, "Org1MSP"), burned))
+	ledger.advance(time.Hour)
+	mustFail(t, contract.ApproveProposal(ledger.as(commercial, "Org1MSP"), burned))
+	mustSucceed(t, contract.ExpireProposal(ledger.as(customer, "Org1MSP"), burned))
+	if name := ledger.lastEvent(); name != "ProposalExpired" {
+		t.Fatalf("expected ProposalExpired event, got %q", name)
+	}
+
+	cancelled, err := contract.ProposeBurn(ledger.as(centralBank, "Org2MSP"), "50")
+	mustSucceed(t, err)
+	mustFail(t, contract.CancelProposal(ledger.as(commercial, "Org1MSP"), cancelled, "typo"))
+	mustSucceed(t, contract.CancelProposal(ledger.as(centralBank, "Org2MSP"), cancelled, "typo"))
+	if name := ledger.lastEvent(); name != "ProposalCancelled" {
+		t.Fatalf("expected ProposalCancelled event, got %q", name)
+	}
+
+	pending, err := contract.ListPendingProposals(ledger.as(centralBank, "Org2MSP"))
+	mustSucceed(t, err)
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending proposals, got %d", len(pending))
+	}
+
+	totalSupply, err := contract.TotalSupply(ledger.as(centralBank, "Org2MSP"))
+	mustSucceed(t, err)
+	if totalSupply != "600.00" {
+		t.Fatalf("expected total supply 600.00, got %s", totalSupply)
+	}
+
+	// Removing the policy needs the approvals of the policy itself
+	_, err = contract.ProposeApprovalPolicy(ledger.as(commercial, "Org1MSP"), []string{}, 0, 0)
+	mustFail(t, err)
+	removed, err := contract.ProposeApprovalPolicy(ledger.as(centralBank, "Org2MSP"), []string{}, 0, 0)
+	mustSucceed(t, err)
+	mustSucceed(t, contract.ApproveProposal(ledger.as(commercial, "Org1MSP"), removed))
+	mustFail(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "100", Check{}))
+	mustSucceed(t, contract.ApproveProposal(ledger.as(approver, "Org3MSP"), removed))
+
+	policy, err := contract.GetApprovalPolicy(ledger.as(centralBank, "Org2MSP"))
+	mustSucceed(t, err)
+	if policy.Threshold != 0 {
+		t.Fatalf("expected the approval policy to be removed, got %+v", policy)
+	}
+	mustSucceed(t, contract.Mint(ledger.as(centralBank, "Org2MSP"), "100", Check{}))
+}
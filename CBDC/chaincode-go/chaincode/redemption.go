@@ -0,0 +1,491 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the statuses of a redemption request
+const (
+	RedemptionPending   = "pending"
+	RedemptionConfirmed = "confirmed"
+	RedemptionRejected  = "rejected"
+	RedemptionReclaimed = "reclaimed"
+)
+
+// Define objectType names for prefix
+const (
+	redemptionPrefix        = "redemption"
+	pendingRedemptionPrefix = "pendingRedemption"
+)
+
+// defaultRedemptionTimeout gives the servicing bank three days to process a redemption request
+const defaultRedemptionTimeout = 3 * 24 * 60 * 60
+
+// Define key names for options
+const redemptionTimeoutField = "redemptionTimeout"
+
+// RedemptionRequest is a request of a customer to convert CBR back to a deposit at its servicing bank
+type RedemptionRequest struct {
+	ID             string    `json:"id"`
+	Account        string    `json:"account"`
+	Bank           string    `json:"bank"`
+	Amount         string    `json:"amount"`
+	Fee            string    `json:"fee,omitempty"`
+	BankAccountRef string    `json:"bankAccountRef"`
+	Status         string    `json:"status"`
+	Reason         string    `json:"reason,omitempty"`
+	Escrow         string    `json:"escrow,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+// RequestRedemption moves tokens of the client account into escrow until its servicing bank
+// credits the deposit account bankAccountRef and burns them, or rejects the request
+// param {String} amount The decimal amount to redeem, e.g. "125.50"
+// param {String} bankAccountRef The deposit account at the servicing bank, e.g. an IBAN
+// returns {String} The ID of the redemption request
+// This function triggers a RedemptionRequested event
+func (s *Erc20Contract) RequestRedemption(ctx contractapi.TransactionContextInterface, amount string, bankAccountRef string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if bankAccountRef == "" {
+		return "", fmt.Errorf("bank account reference must not be empty")
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	account, err := readAccount(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	if account == nil {
+		return "", fmt.Errorf("client account %s is not registered with a bank", clientID)
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return "", err
+	}
+	if value.Sign() <= 0 {
+		return "", fmt.Errorf("redemption amount must be positive")
+	}
+
+	timeout, err := readConfigInt(ctx, redemptionTimeoutField, defaultRedemptionTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	id := ctx.GetStub().GetTxID()
+	escrow, err := escrowAccount(ctx, redemptionPrefix, id, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	request := &RedemptionRequest{
+		ID:             id,
+		Account:        clientID,
+		Bank:           account.Bank,
+		Amount:         formatAmount(value, decimals),
+		BankAccountRef: bankAccountRef,
+		Status:         RedemptionPending,
+		Escrow:         escrow,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(time.Duration(timeout) * time.Second),
+	}
+
+	// The fee is charged when the request is made and is not returned if the request is rejected
+	_, fee, err := transferWithFees(ctx, FeeRedemption, clientID, []payout{{escrow, value}})
+	if err != nil {
+		return "", fmt.Errorf("failed to escrow redemption: %v", err)
+	}
+	if fee.Sign() > 0 {
+		request.Fee = formatAmount(fee, decimals)
+	}
+
+	err = putRedemption(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitRedemptionEvent(ctx, "RedemptionRequested", request)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("client %s requested redemption %s of %s at %s", clientID, id, request.Amount, request.Bank)
+
+	return id, nil
+}
+
+// ConfirmRedemption burns the escrowed tokens of a pending request once the servicing bank
+// has credited the deposit account of the customer
+// This function triggers a RedemptionConfirmed event
+func (s *Erc20Contract) ConfirmRedemption(ctx contractapi.TransactionContextInterface, requestID string) error {
+
+	request, err := requireBankRedemption(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !now.Before(request.ExpiresAt) {
+		return fmt.Errorf("redemption request %s expired at %s, the customer can reclaim it", requestID, request.ExpiresAt)
+	}
+
+	err = checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return err
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(request.Amount, decimals)
+	if err != nil {
+		return err
+	}
+
+	err = burnHelper(ctx, redemptionEscrow(request), value)
+	if err != nil {
+		return fmt.Errorf("failed to burn redemption: %v", err)
+	}
+
+	err = addBankTotal(ctx, request.Bank, redeemedField, value)
+	if err != nil {
+		return err
+	}
+
+	request.Status = RedemptionConfirmed
+
+	err = putRedemption(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	err = emitRedemptionEvent(ctx, "RedemptionConfirmed", request)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("redemption %s of %s confirmed by %s", requestID, request.Amount, request.Bank)
+
+	return nil
+}
+
+// RejectRedemption releases the escrowed tokens of a pending request back to the customer
+// This function triggers a RedemptionRejected event
+func (s *Erc20Contract) RejectRedemption(ctx contractapi.TransactionContextInterface, requestID string, reason string) error {
+
+	request, err := requireBankRedemption(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
+	err = releaseRedemption(ctx, request, RedemptionRejected, reason)
+	if err != nil {
+		return err
+	}
+
+	err = emitRedemptionEvent(ctx, "RedemptionRejected", request)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("redemption %s rejected by %s: %s", requestID, request.Bank, reason)
+
+	return nil
+}
+
+// ReclaimRedemption returns the escrowed tokens of a pending request the servicing bank
+// did not process before it expired
+// This function triggers a RedemptionReclaimed event
+func (s *Erc20Contract) ReclaimRedemption(ctx contractapi.TransactionContextInterface, requestID string) error {
+
+	request, err := readRedemption(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if request.Account != clientID {
+		return fmt.Errorf("redemption request %s was not made by the client", requestID)
+	}
+	if request.Status != RedemptionPending {
+		return fmt.Errorf("redemption request %s is %s", requestID, request.Status)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now.Before(request.ExpiresAt) {
+		return fmt.Errorf("redemption request %s can't be reclaimed before %s", requestID, request.ExpiresAt)
+	}
+
+	err = releaseRedemption(ctx, request, RedemptionReclaimed, "")
+	if err != nil {
+		return err
+	}
+
+	err = emitRedemptionEvent(ctx, "RedemptionReclaimed", request)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("redemption %s reclaimed by %s", requestID, clientID)
+
+	return nil
+}
+
+// GetRedemption returns a redemption request, only the customer, its bank and the central bank roles can read it
+func (s *Erc20Contract) GetRedemption(ctx contractapi.TransactionContextInterface, requestID string) (*RedemptionRequest, error) {
+
+	request, err := readRedemption(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+	if request.Account == clientID {
+		return request, nil
+	}
+
+	err = requireBankOrCentralBank(ctx, request.Bank)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to read redemption request %s: %v", requestID, err)
+	}
+
+	return request, nil
+}
+
+// ListPendingRedemptions returns the pending redemption requests a bank has to process
+func (s *Erc20Contract) ListPendingRedemptions(ctx contractapi.TransactionContextInterface, bankMSP string) ([]RedemptionRequest, error) {
+
+	err := requireBankOrCentralBank(ctx, bankMSP)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to list redemptions of bank %s: %v", bankMSP, err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pendingRedemptionPrefix, []string{bankMSP})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending redemptions from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	requests := []RedemptionRequest{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key %s: %v", queryResponse.Key, err)
+		}
+
+		request, err := readRedemption(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *request)
+	}
+
+	return requests, nil
+}
+
+// SetRedemptionTimeout sets the number of seconds a bank has to process a redemption request
+func (s *Erc20Contract) SetRedemptionTimeout(ctx contractapi.TransactionContextInterface, seconds int) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set the redemption timeout: %v", err)
+	}
+
+	if seconds <= 0 {
+		return fmt.Errorf("redemption timeout must be positive")
+	}
+
+	err = putConfigInt(ctx, redemptionTimeoutField, seconds)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("redemption timeout set to %d seconds", seconds)
+
+	return nil
+}
+
+// Helper Functions
+
+// redemptionEscrow returns the account holding the tokens of a redemption request until it is resolved
+func redemptionEscrow(request *RedemptionRequest) string {
+	if request.Escrow == "" {
+		return internalAccount(redemptionPrefix, request.ID)
+	}
+
+	return request.Escrow
+}
+
+// requireBankRedemption returns a pending redemption request serviced by the calling bank
+func requireBankRedemption(ctx contractapi.TransactionContextInterface, requestID string) (*RedemptionRequest, error) {
+	err := requireRole(ctx, RoleBank)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to process redemptions: %v", err)
+	}
+
+	request, err := readRedemption(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	bankMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if request.Bank != bankMSP {
+		return nil, fmt.Errorf("redemption request %s is serviced by %s, not by %s", requestID, request.Bank, bankMSP)
+	}
+	if request.Status != RedemptionPending {
+		return nil, fmt.Errorf("redemption request %s is %s", requestID, request.Status)
+	}
+
+	return request, nil
+}
+
+// releaseRedemption returns the escrowed tokens to the customer and closes the request with the given status
+func releaseRedemption(ctx contractapi.TransactionContextInterface, request *RedemptionRequest, status string, reason string) error {
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(request.Amount, decimals)
+	if err != nil {
+		return err
+	}
+
+	err = returnEscrow(ctx, "", redemptionEscrow(request), request.Account, value)
+	if err != nil {
+		return fmt.Errorf("failed to release redemption: %v", err)
+	}
+
+	request.Status = status
+	request.Reason = reason
+
+	return putRedemption(ctx, request)
+}
+
+// returnEscrow returns escrowed funds of a denomination to the account they were escrowed from, symbol is empty
+// for the primary denomination. The funds are the originator's own, so like a hold the return is not bound by
+// freezes and tier limits, but it waits while transfers are paused
+func returnEscrow(ctx contractapi.TransactionContextInterface, symbol string, escrow string, originator string, value *big.Int) error {
+	err := checkNotPaused(ctx, PauseTransfers)
+	if err != nil {
+		return err
+	}
+
+	return moveHeldFunds(newDenominationSheet(ctx, symbol), escrow, originator, value)
+}
+
+func readRedemption(ctx contractapi.TransactionContextInterface, requestID string) (*RedemptionRequest, error) {
+	key, err := compositeKey(ctx, redemptionPrefix, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	requestBytes, err := readRecord(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redemption request %s: %v", requestID, err)
+	}
+	if requestBytes == nil {
+		return nil, fmt.Errorf("redemption request %s does not exist", requestID)
+	}
+
+	request := new(RedemptionRequest)
+	err = json.Unmarshal(requestBytes, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode redemption request %s: %v", requestID, err)
+	}
+
+	return request, nil
+}
+
+// putRedemption stores a redemption request and keeps the index of pending requests per bank up to date
+func putRedemption(ctx contractapi.TransactionContextInterface, request *RedemptionRequest) error {
+	key, err := compositeKey(ctx, redemptionPrefix, request.ID)
+	if err != nil {
+		return err
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putRecord(ctx, key, requestJSON, request.Account)
+	if err != nil {
+		return fmt.Errorf("failed to update redemption request %s: %v", request.ID, err)
+	}
+
+	pendingKey, err := compositeKey(ctx, pendingRedemptionPrefix, request.Bank, request.ID)
+	if err != nil {
+		return err
+	}
+
+	if request.Status == RedemptionPending {
+		// Only the key is needed for the index, value can't be empty so store a null byte
+		err = ctx.GetStub().PutState(pendingKey, []byte{0x00})
+	} else {
+		err = ctx.GetStub().DelState(pendingKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update pending redemptions of %s: %v", request.Bank, err)
+	}
+
+	return nil
+}
+
+// emitRedemptionEvent emits a redemption event carrying the request
+func emitRedemptionEvent(ctx contractapi.TransactionContextInterface, name string, request *RedemptionRequest) error {
+	return emitPaymentEvent(ctx, name, request.ID, request, request.Account)
+}
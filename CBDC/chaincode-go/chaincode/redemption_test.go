@@ -0,0 +1,84 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRedemptionWorkflow(t *testing.T) {
+	ledger, contract := newInitializedLedger(t)
+	ledger.registerAccounts(contract, TierFull, customer)
+	mustSucceed(t, contract.IssueToBank(ledger.as(centralBank, "Org2MSP"), "Org1MSP", "1000"))
+	mustSucceed(t, contract.DistributeToCustomer(ledger.as(commercial, "Org1MSP"), customer, "500"))
+
+	// Escrow accounts can't be paid into directly
+	mustFail(t, contract.Transfer(ledger.as(customer, "Org1MSP"), internalAccount(redemptionPrefix, "tx1"), "1"))
+
+	confirmed, err := contract.RequestRedemption(ledger.as(customer, "Org1MSP"), "100", "BY20OLMP31350000001000000933")
+	mustSucceed(t, err)
+	rejected, err := contract.RequestRedemption(ledger.as(customer, "Org1MSP"), "50", "BY20OLMP31350000001000000933")
+	mustSucceed(t, err)
+	expired, err := contract.RequestRedemption(ledger.as(customer, "Org1MSP"), "25", "BY20OLMP31350000001000000933")
+	mustSucceed(t, err)
+
+	pending, err := contract.ListPendingRedemptions(ledger.as(commercial, "Org1MSP"), "Org1MSP")
+	mustSucceed(t, err)
+	if len(pending) != 3 {
+		t.Fatalf("expected 3 pending redemptions, got %d", len(pending))
+	}
+	_, err = contract.ListPendingRedemptions(ledger.as(commercial, "Org3MSP"), "Org1MSP")
+	mustFail(t, err)
+
+	// The deposit account and the amount are kept in the collection of the bank
+	requestKey, err := compositeKey(ledger.as(customer, "Org1MSP"), redemptionPrefix, confirmed)
+	mustSucceed(t, err)
+	if ledger.stub.State[requestKey] != nil || ledger.stub.PvtState[balancesCollection("Org1MSP")][requestKey] == nil {
+		t.Fatalf("expected the redemption request in the collection of the bank only")
+	}
+
+	mustFail(t, contract.ConfirmRedemption(ledger.as(centralBank, "Org2MSP"), confirmed))
+	mustSucceed(t, contract.ConfirmRedemption(ledger.as(commercial, "Org1MSP"), confirmed))
+	mustFail(t, contract.ConfirmRedemption(ledger.as(commercial, "Org1MSP"), confirmed))
+
+	// Rejected escrow goes back to the customer even while the account is frozen, but not while transfers are paused
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleRegulator, MemberTypeMSP, "Org2MSP"))
+	mustSucceed(t, contract.FreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, FreezeIn, "fraud", "case 17/2023"))
+	mustSucceed(t, contract.Pause(ledger.as(centralBank, "Org2MSP"), PauseTransfers, "incident"))
+	mustFail(t, contract.RejectRedemption(ledger.as(commercial, "Org1MSP"), rejected, "account closed"))
+	mustSucceed(t, contract.Unpause(ledger.as(centralBank, "Org2MSP"), PauseTransfers, "resolved"))
+	mustSucceed(t, contract.RejectRedemption(ledger.as(commercial, "Org1MSP"), rejected, "account closed"))
+	mustSucceed(t, contract.UnfreezeAccount(ledger.as(centralBank, "Org2MSP"), customer, "case 17/2023"))
+
+	// The customer can reclaim a request only after it expired
+	mustFail(t, contract.ReclaimRedemption(ledger.as(customer, "Org1MSP"), expired))
+	ledger.advance(defaultRedemptionTimeout * time.Second)
+	mustFail(t, contract.ConfirmRedemption(ledger.as(commercial, "Org1MSP"), expired))
+	mustSucceed(t, contract.ReclaimRedemption(ledger.as(customer, "Org1MSP"), expired))
+	if name := ledger.lastEvent(); name != "RedemptionReclaimed" {
+		t.Fatalf("expected RedemptionReclaimed event, got %q", name)
+	}
+
+	request, err := contract.GetRedemption(ledger.as(customer, "Org1MSP"), rejected)
+	mustSucceed(t, err)
+	if request.Status != RedemptionRejected || request.Reason != "account closed" {
+		t.Fatalf("unexpected redemption request %+v", request)
+	}
+
+	balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if balance != "400.00" {
+		t.Fatalf("expected balance 400.00, got %s", balance)
+	}
+
+	position, err := contract.GetBankPosition(ledger.as(centralBank, "Org2MSP"), "Org1MSP")
+	mustSucceed(t, err)
+	if position.Redeemed != "100.00" || position.InCirculation != "900.00" {
+		t.Fatalf("unexpected bank position %+v", position)
+	}
+
+	pending, err = contract.ListPendingRedemptions(ledger.as(commercial, "Org1MSP"), "Org1MSP")
+	mustSucceed(t, err)
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending redemptions, got %d", len(pending))
+	}
+}
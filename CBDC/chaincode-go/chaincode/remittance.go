@@ -0,0 +1,485 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the maximum lengths of remittance fields, as for ISO 20022 unstructured remittance and end-to-end IDs
+const (
+	maxMemoLength      = 140
+	maxReferenceLength = 35
+)
+
+// Define objectType names for prefix
+const (
+	transferPrefix    = "transfer"
+	transferRefPrefix = "transferRef"
+	purposeCodePrefix = "purposeCode"
+)
+
+// Remittance holds the structured remittance data of a payment, all fields are optional
+type Remittance struct {
+	Memo        string `json:"memo,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	PurposeCode string `json:"purposeCode,omitempty"`
+}
+
+// TransferRecord is stored for every payment under the ID of its transaction. A transaction making several
+// payments, such as a batch, records each of them under the transaction ID followed by its line, see lineTxID
+type TransferRecord struct {
+	TxID       string     `json:"txID"`
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Value      string     `json:"value"`
+	Remittance Remittance `json:"remittance"`
+	Timestamp  time.Time  `json:"timestamp"`
+}
+
+// PurposeCode is an entry of the configurable list of payment purpose codes
+type PurposeCode struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// SetPurposeCode adds a purpose code to the list accepted on transfers, or updates its description
+func (s *Erc20Contract) SetPurposeCode(ctx contractapi.TransactionContextInterface, code string, description string) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to manage purpose codes: %v", err)
+	}
+
+	if code == "" {
+		return fmt.Errorf("purpose code must not be empty")
+	}
+
+	key, err := compositeKey(ctx, purposeCodePrefix, code)
+	if err != nil {
+		return err
+	}
+
+	codeJSON, err := json.Marshal(PurposeCode{code, description})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, codeJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set purpose code %s: %v", code, err)
+	}
+
+	log.Printf("purpose code %s set to %q", code, description)
+
+	return nil
+}
+
+// RemovePurposeCode removes a purpose code from the list accepted on transfers
+func (s *Erc20Contract) RemovePurposeCode(ctx contractapi.TransactionContextInterface, code string) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to manage purpose codes: %v", err)
+	}
+
+	known, err := purposeCodeExists(ctx, code)
+	if err != nil {
+		return err
+	}
+	if !known {
+		return fmt.Errorf("unknown purpose code %s", code)
+	}
+
+	key, err := compositeKey(ctx, purposeCodePrefix, code)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to remove purpose code %s: %v", code, err)
+	}
+
+	log.Printf("purpose code %s removed", code)
+
+	return nil
+}
+
+// ListPurposeCodes returns the purpose codes accepted on transfers
+func (s *Erc20Contract) ListPurposeCodes(ctx contractapi.TransactionContextInterface) ([]PurposeCode, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(purposeCodePrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read purpose codes from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	codes := []PurposeCode{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var code PurposeCode
+		err = json.Unmarshal(queryResponse.Value, &code)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode purpose code %s: %v", queryResponse.Key, err)
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// GetTransfer returns the payment recorded by the given transaction
+// Only the payer, the payee, and clients with the AUDITOR or REGULATOR role can read it
+func (s *Erc20Contract) GetTransfer(ctx contractapi.TransactionContextInterface, txID string) (*TransferRecord, error) {
+
+	record, err := readTransfer(ctx, txID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("transfer %s does not exist", txID)
+	}
+
+	visible, err := transferVisible(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, fmt.Errorf("client is not authorized to read transfer %s", txID)
+	}
+
+	return record, nil
+}
+
+// GetTransfersByReference returns the payments carrying the given end-to-end reference
+// Payments the client is not a party of are left out, unless it has the AUDITOR or REGULATOR role
+func (s *Erc20Contract) GetTransfersByReference(ctx contractapi.TransactionContextInterface, reference string) ([]TransferRecord, error) {
+
+	if reference == "" {
+		return nil, fmt.Errorf("reference must not be empty")
+	}
+
+	txIDs, err := transfersByReference(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []TransferRecord{}
+	for _, txID := range txIDs {
+		record, err := readTransfer(ctx, txID)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			continue
+		}
+
+		visible, err := transferVisible(ctx, record)
+		if err != nil {
+			return nil, err
+		}
+		if visible {
+			records = append(records, *record)
+		}
+	}
+
+	return records, nil
+}
+
+// Helper Functions
+
+// validateRemittance checks the field lengths and that the purpose code is on the configured list
+func validateRemittance(ctx contractapi.TransactionContextInterface, remittance Remittance) error {
+	if utf8.RuneCountInString(remittance.Memo) > maxMemoLength {
+		return fmt.Errorf("memo must not be longer than %d characters", maxMemoLength)
+	}
+	if utf8.RuneCountInString(remittance.Reference) > maxReferenceLength {
+		return fmt.Errorf("reference must not be longer than %d characters", maxReferenceLength)
+	}
+
+	if remittance.PurposeCode == "" {
+		return nil
+	}
+
+	known, err := purposeCodeExists(ctx, remittance.PurposeCode)
+	if err != nil {
+		return err
+	}
+	if !known {
+		return fmt.Errorf("unknown purpose code %s", remittance.PurposeCode)
+	}
+
+	return nil
+}
+
+// recordTransfer stores a payment under the ID of the current transaction and indexes it by its reference.
+// Payments of registered accounts are kept in the private data collection of their banks
+func recordTransfer(ctx contractapi.TransactionContextInterface, from string, to string, value *big.Int, remittance Remittance) error {
+	return recordTransferAs(ctx, ctx.GetStub().GetTxID(), from, to, value, remittance)
+}
+
+// recordTransferAs stores a payment under the given transfer ID, for transactions making several payments
+func recordTransferAs(ctx contractapi.TransactionContextInterface, txID string, from string, to string, value *big.Int, remittance Remittance) error {
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	record := TransferRecord{txID, from, to, formatAmount(value, decimals), remittance, now}
+
+	key, err := compositeKey(ctx, transferPrefix, txID)
+	if err != nil {
+		return err
+	}
+
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	collection, banks, err := transferCollection(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	if collection != "" {
+		return recordPrivateTransfer(ctx, txID, collection, banks, key, recordJSON, remittance.Reference)
+	}
+
+	err = ctx.GetStub().PutState(key, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to record transfer %s: %v", txID, err)
+	}
+
+	if remittance.Reference == "" {
+		return nil
+	}
+
+	refKey, err := compositeKey(ctx, transferRefPrefix, remittance.Reference, txID)
+	if err != nil {
+		return err
+	}
+
+	// Only the key is needed for the index, value can't be empty so store a null byte
+	err = ctx.GetStub().PutState(refKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to index transfer %s by reference: %v", txID, err)
+	}
+
+	return nil
+}
+
+// recordPrivateTransfer stores a payment in the collection of the banks of its parties. Nothing about it goes to
+// world state: the collection of each bank tells where the payment is recorded and indexes it by its reference
+func recordPrivateTransfer(ctx contractapi.TransactionContextInterface, txID string, collection string, banks []string, key string, recordJSON []byte, reference string) error {
+	seedCollections := make([]string, len(banks))
+	for i, bank := range banks {
+		seedCollections[i] = balancesCollection(bank)
+	}
+
+	err := putPrivate(ctx, collection, key, recordJSON, seedCollections...)
+	if err != nil {
+		return fmt.Errorf("failed to record transfer %s: %v", txID, err)
+	}
+
+	locatorKey, err := compositeKey(ctx, transferLocatorPrefix, txID)
+	if err != nil {
+		return err
+	}
+
+	refKey := ""
+	if reference != "" {
+		refKey, err = compositeKey(ctx, transferRefPrefix, reference, txID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, bankCollection := range seedCollections {
+		err = putPrivate(ctx, bankCollection, locatorKey, []byte(collection))
+		if err != nil {
+			return fmt.Errorf("failed to locate transfer %s: %v", txID, err)
+		}
+
+		if refKey == "" {
+			continue
+		}
+		err = putPrivate(ctx, bankCollection, refKey, []byte(collection))
+		if err != nil {
+			return fmt.Errorf("failed to index transfer %s by reference: %v", txID, err)
+		}
+	}
+
+	return nil
+}
+
+// lineTxID returns the ID a payment made by a line of a transaction is recorded under, lines count from 1
+func lineTxID(txID string, line int) string {
+	return txID + ":" + strconv.Itoa(line)
+}
+
+// readTransfer returns the payment recorded by a transaction, or nil when there is none or it is recorded in
+// private data the client can't locate
+func readTransfer(ctx contractapi.TransactionContextInterface, txID string) (*TransferRecord, error) {
+	key, err := compositeKey(ctx, transferPrefix, txID)
+	if err != nil {
+		return nil, err
+	}
+
+	recordBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transfer %s from world state: %v", txID, err)
+	}
+	if recordBytes == nil {
+		recordBytes, err = readPrivateTransfer(ctx, txID, key)
+		if err != nil || recordBytes == nil {
+			return nil, err
+		}
+	}
+
+	record := new(TransferRecord)
+	err = json.Unmarshal(recordBytes, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode transfer %s: %v", txID, err)
+	}
+
+	return record, nil
+}
+
+// transfersByReference returns the IDs of the payments indexed by a reference in world state and in the
+// collections of the banks visible to the client
+func transfersByReference(ctx contractapi.TransactionContextInterface, reference string) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(transferRefPrefix, []string{reference})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transfers with reference %s from world state: %v", reference, err)
+	}
+	defer resultsIterator.Close()
+
+	iterators := []shim.StateQueryIteratorInterface{resultsIterator}
+
+	banks, err := visibleBanks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, bank := range banks {
+		privateIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(balancesCollection(bank), transferRefPrefix, []string{reference})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read transfers with reference %s from collection %s: %v", reference, balancesCollection(bank), err)
+		}
+		defer privateIterator.Close()
+
+		iterators = append(iterators, privateIterator)
+	}
+
+	seen := make(map[string]bool)
+	txIDs := []string{}
+	for _, iterator := range iterators {
+		for iterator.HasNext() {
+			queryResponse, err := iterator.Next()
+			if err != nil {
+				return nil, err
+			}
+
+			_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to split composite key %s: %v", queryResponse.Key, err)
+			}
+
+			if !seen[attributes[1]] {
+				seen[attributes[1]] = true
+				txIDs = append(txIDs, attributes[1])
+			}
+		}
+	}
+
+	return txIDs, nil
+}
+
+// readPrivateTransfer reads a payment from the collection it is recorded in, found through the collections of the
+// banks visible to the client. It returns nil when none of them knows the payment
+func readPrivateTransfer(ctx contractapi.TransactionContextInterface, txID string, key string) ([]byte, error) {
+	locatorKey, err := compositeKey(ctx, transferLocatorPrefix, txID)
+	if err != nil {
+		return nil, err
+	}
+
+	banks, err := visibleBanks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bank := range banks {
+		collection, err := readPrivate(ctx, balancesCollection(bank), locatorKey)
+		if err != nil {
+			return nil, err
+		}
+		if collection == nil {
+			continue
+		}
+
+		recordBytes, err := readPrivate(ctx, string(collection), key)
+		if err != nil {
+			return nil, err
+		}
+		if recordBytes == nil {
+			return nil, fmt.Errorf("transfer %s is not available on this peer", txID)
+		}
+
+		return recordBytes, nil
+	}
+
+	return nil, nil
+}
+
+// transferVisible reports whether the client is a party of the payment or may oversee all payments
+func transferVisible(ctx contractapi.TransactionContextInterface, record *TransferRecord) (bool, error) {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get client id: %v", err)
+	}
+	if record.From == clientID || record.To == clientID {
+		return true, nil
+	}
+
+	return callerHasAnyRole(ctx, RoleAuditor, RoleRegulator)
+}
+
+func purposeCodeExists(ctx contractapi.TransactionContextInterface, code string) (bool, error) {
+	key, err := compositeKey(ctx, purposeCodePrefix, code)
+	if err != nil {
+		return false, err
+	}
+
+	codeBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read purpose code %s from world state: %v", code, err)
+	}
+
+	return codeBytes != nil, nil
+}
+
+// remittanceOrNil leaves the remittance out of events of payments without remittance data
+func remittanceOrNil(remittance Remittance) *Remittance {
+	if remittance == (Remittance{}) {
+		return nil
+	}
+
+	return &remittance
+}
@@ -0,0 +1,51 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTransferWithRemittance(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierCorporate, commercial)
+	mustSucceed(t, contract.SetPurposeCode(ledger.as(centralBank, "Org2MSP"), "GDDS", "Purchase or sale of goods"))
+
+	invoice := Remittance{"Invoice 42 for tea leaves", "INV-42", "GDDS"}
+	mustFail(t, contract.TransferWithRemittance(ledger.as(centralBank, "Org2MSP"), commercial, "10", Remittance{Reference: "INV-42", PurposeCode: "SALA"}))
+
+	ctx := ledger.as(centralBank, "Org2MSP")
+	mustSucceed(t, contract.TransferWithRemittance(ctx, commercial, "10", invoice))
+	txID := ctx.GetStub().GetTxID()
+
+	// The payment to a registered account is recorded in private data, the event only tells the transaction
+	transferEvent := <-ledger.stub.ChaincodeEventsChannel
+	var emitted privateEvent
+	mustSucceed(t, json.Unmarshal(transferEvent.Payload, &emitted))
+	if emitted != (privateEvent{TxID: txID}) {
+		t.Fatalf("unexpected Transfer event %s", transferEvent.Payload)
+	}
+
+	// A partial payment of the same invoice is found by the same reference
+	mustSucceed(t, contract.TransferWithRemittance(ledger.as(centralBank, "Org2MSP"), commercial, "5.50", invoice))
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), commercial, "1"))
+
+	records, err := contract.GetTransfersByReference(ledger.as(commercial, "Org1MSP"), "INV-42")
+	mustSucceed(t, err)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 transfers with reference INV-42, got %d", len(records))
+	}
+
+	record, err := contract.GetTransfer(ledger.as(commercial, "Org1MSP"), txID)
+	mustSucceed(t, err)
+	if record.Value != "10.00" || record.Remittance != invoice {
+		t.Fatalf("unexpected transfer record %+v", record)
+	}
+
+	// Other clients can't read the payments of others
+	_, err = contract.GetTransfer(ledger.as(customer, "Org1MSP"), txID)
+	mustFail(t, err)
+	records, err = contract.GetTransfersByReference(ledger.as(customer, "Org1MSP"), "INV-42")
+	mustSucceed(t, err)
+	if len(records) != 0 {
+		t.Fatalf("expected no visible transfers, got %d", len(records))
+	}
+}
@@ -0,0 +1,375 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define role names known to the role registry
+const (
+	RoleAdmin      = "ADMIN"
+	RoleMinter     = "MINTER"
+	RoleBurner     = "BURNER"
+	RoleRegulator  = "REGULATOR"
+	RoleAuditor    = "AUDITOR"
+	RoleBank       = "BANK"
+	RolePolicy     = "POLICY"
+	RoleApprover   = "APPROVER"
+	RoleArbitrator = "ARBITRATOR"
+)
+
+// Define the kinds of members a role can be granted to
+const (
+	MemberTypeMSP    = "msp"
+	MemberTypeClient = "client"
+)
+
+// Define objectType names for prefix
+const rolePrefix = "role"
+
+// bootstrapAdminMSP is treated as ADMIN only while no ADMIN grant exists in world state,
+// so that the first administrator can initialize the contract and hand out roles
+const bootstrapAdminMSP = "Org2MSP"
+
+var knownRoles = []string{RoleAdmin, RoleMinter, RoleBurner, RoleRegulator, RoleAuditor, RoleBank, RolePolicy, RoleApprover, RoleArbitrator}
+
+// RoleMember describes a single role grant stored in world state
+type RoleMember struct {
+	Role       string `json:"role"`
+	MemberType string `json:"memberType"`
+	Member     string `json:"member"`
+	GrantedBy  string `json:"grantedBy"`
+}
+
+// roleEvent provides an organized struct for emitting role events
+type roleEvent struct {
+	Role       string `json:"role"`
+	MemberType string `json:"memberType"`
+	Member     string `json:"member"`
+	Sender     string `json:"sender"`
+}
+
+// GrantRole grants a role to an MSP ID (memberType "msp") or to a single client ID (memberType "client")
+// This function triggers a RoleGranted event
+func (s *Erc20Contract) GrantRole(ctx contractapi.TransactionContextInterface, role string, memberType string, member string) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	err = validateRoleMember(role, memberType, member)
+	if err != nil {
+		return err
+	}
+
+	granted, err := roleGranted(ctx, role, memberType, member)
+	if err != nil {
+		return err
+	}
+	if granted {
+		return fmt.Errorf("role %s is already granted to %s %s", role, memberType, member)
+	}
+
+	// Get ID of submitting client identity
+	sender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	err = putRoleMember(ctx, RoleMember{role, memberType, member, sender})
+	if err != nil {
+		return err
+	}
+
+	// Emit the RoleGranted event
+	err = emitRoleEvent(ctx, "RoleGranted", roleEvent{role, memberType, member, sender})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("role %s granted to %s %s", role, memberType, member)
+
+	return nil
+}
+
+// RevokeRole removes a role previously granted to an MSP ID or client ID
+// The last ADMIN grant cannot be revoked, otherwise nobody could manage roles anymore
+// This function triggers a RoleRevoked event
+func (s *Erc20Contract) RevokeRole(ctx contractapi.TransactionContextInterface, role string, memberType string, member string) error {
+
+	err := requireRole(ctx, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	err = validateRoleMember(role, memberType, member)
+	if err != nil {
+		return err
+	}
+
+	granted, err := roleGranted(ctx, role, memberType, member)
+	if err != nil {
+		return err
+	}
+	if !granted {
+		return fmt.Errorf("role %s is not granted to %s %s", role, memberType, member)
+	}
+
+	if role == RoleAdmin {
+		admins, err := listRoleMembers(ctx, RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if len(admins) <= 1 {
+			return fmt.Errorf("cannot revoke the last %s grant", RoleAdmin)
+		}
+	}
+
+	roleKey, err := ctx.GetStub().CreateCompositeKey(rolePrefix, []string{role, memberType, member})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", rolePrefix, err)
+	}
+
+	err = ctx.GetStub().DelState(roleKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete role grant %s: %v", roleKey, err)
+	}
+
+	// Get ID of submitting client identity
+	sender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// Emit the RoleRevoked event
+	err = emitRoleEvent(ctx, "RoleRevoked", roleEvent{role, memberType, member, sender})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("role %s revoked from %s %s", role, memberType, member)
+
+	return nil
+}
+
+// HasRole returns true when the role is granted directly to the given MSP ID or client ID
+func (s *Erc20Contract) HasRole(ctx contractapi.TransactionContextInterface, role string, memberType string, member string) (bool, error) {
+
+	err := validateRoleMember(role, memberType, member)
+	if err != nil {
+		return false, err
+	}
+
+	return roleGranted(ctx, role, memberType, member)
+}
+
+// ListRoleMembers returns all MSP IDs and client IDs the role is granted to
+func (s *Erc20Contract) ListRoleMembers(ctx contractapi.TransactionContextInterface, role string) ([]RoleMember, error) {
+
+	if !isKnownRole(role) {
+		return nil, fmt.Errorf("unknown role %s, expected one of %s", role, strings.Join(knownRoles, ", "))
+	}
+
+	return listRoleMembers(ctx, role)
+}
+
+// Helper Functions
+
+// requireRole is the single authorization guard used by every privileged function.
+// It succeeds when the submitting client, or its MSP, holds at least one of the given roles
+func requireRole(ctx contractapi.TransactionContextInterface, roles ...string) error {
+	authorized, err := callerHasAnyRole(ctx, roles...)
+	if err != nil {
+		return err
+	}
+	if !authorized {
+		return fmt.Errorf("client is not authorized, %s role required", strings.Join(roles, " or "))
+	}
+
+	return nil
+}
+
+// callerHasAnyRole checks the role registry for the submitting client ID and its MSP ID
+func callerHasAnyRole(ctx contractapi.TransactionContextInterface, roles ...string) (bool, error) {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	for _, role := range roles {
+		granted, err := roleGranted(ctx, role, MemberTypeMSP, clientMSPID)
+		if err != nil {
+			return false, err
+		}
+		if granted {
+			return true, nil
+		}
+
+		granted, err = roleGranted(ctx, role, MemberTypeClient, clientID)
+		if err != nil {
+			return false, err
+		}
+		if granted {
+			return true, nil
+		}
+
+		if role == RoleAdmin && clientMSPID == bootstrapAdminMSP {
+			admins, err := listRoleMembers(ctx, RoleAdmin)
+			if err != nil {
+				return false, err
+			}
+			if len(admins) == 0 {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// bootstrapRoles grants ADMIN, MINTER and BURNER to the initializing MSP when no ADMIN grant exists yet
+func bootstrapRoles(ctx contractapi.TransactionContextInterface) error {
+	admins, err := listRoleMembers(ctx, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if len(admins) > 0 {
+		return nil
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	for _, role := range []string{RoleAdmin, RoleMinter, RoleBurner} {
+		err = putRoleMember(ctx, RoleMember{role, MemberTypeMSP, clientMSPID, clientID})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("roles %s, %s and %s granted to %s", RoleAdmin, RoleMinter, RoleBurner, clientMSPID)
+
+	return nil
+}
+
+// roleGranted checks if a role grant exists in world state
+func roleGranted(ctx contractapi.TransactionContextInterface, role string, memberType string, member string) (bool, error) {
+	roleKey, err := ctx.GetStub().CreateCompositeKey(rolePrefix, []string{role, memberType, member})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", rolePrefix, err)
+	}
+
+	roleBytes, err := ctx.GetStub().GetState(roleKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read role grant %s from world state: %v", roleKey, err)
+	}
+
+	return roleBytes != nil, nil
+}
+
+// putRoleMember stores a role grant in world state
+func putRoleMember(ctx contractapi.TransactionContextInterface, member RoleMember) error {
+	roleKey, err := ctx.GetStub().CreateCompositeKey(rolePrefix, []string{member.Role, member.MemberType, member.Member})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", rolePrefix, err)
+	}
+
+	memberJSON, err := json.Marshal(member)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(roleKey, memberJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", roleKey, err)
+	}
+
+	return nil
+}
+
+// listRoleMembers returns all grants of a role stored in world state
+func listRoleMembers(ctx contractapi.TransactionContextInterface, role string) ([]RoleMember, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(rolePrefix, []string{role})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read members of role %s from world state: %v", role, err)
+	}
+	defer resultsIterator.Close()
+
+	members := []RoleMember{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var member RoleMember
+		err = json.Unmarshal(queryResponse.Value, &member)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode role grant %s: %v", queryResponse.Key, err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// validateRoleMember checks the arguments of the role management functions
+func validateRoleMember(role string, memberType string, member string) error {
+	if !isKnownRole(role) {
+		return fmt.Errorf("unknown role %s, expected one of %s", role, strings.Join(knownRoles, ", "))
+	}
+	if memberType != MemberTypeMSP && memberType != MemberTypeClient {
+		return fmt.Errorf("unknown member type %s, expected %s or %s", memberType, MemberTypeMSP, MemberTypeClient)
+	}
+	if member == "" {
+		return fmt.Errorf("role member must not be empty")
+	}
+
+	return nil
+}
+
+// isKnownRole accepts the roles in knownRoles and the MINTER and BURNER roles of a single denomination
+func isKnownRole(role string) bool {
+	if isDenominationRole(role) {
+		return true
+	}
+
+	for _, known := range knownRoles {
+		if role == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// emitRoleEvent emits a RoleGranted or RoleRevoked event
+func emitRoleEvent(ctx contractapi.TransactionContextInterface, name string, e roleEvent) error {
+	eventJSON, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
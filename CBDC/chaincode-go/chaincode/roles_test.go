@@ -0,0 +1,51 @@
+package chaincode
+
+import "testing"
+
+func TestInitializeBootstrapsRoles(t *testing.T) {
+	ledger := newTestLedger(t)
+	contract := new(Erc20Contract)
+
+	_, err := contract.Initialize(ledger.as(commercial, "Org1MSP"), "Belarusian ruble", "CBR", "2")
+	mustFail(t, err)
+
+	_, err = contract.Initialize(ledger.as(centralBank, "Org2MSP"), "Belarusian ruble", "CBR", "2")
+	mustSucceed(t, err)
+
+	for _, role := range []string{RoleAdmin, RoleMinter, RoleBurner} {
+		granted, err := contract.HasRole(ledger.as(customer, "Org1MSP"), role, MemberTypeMSP, "Org2MSP")
+		mustSucceed(t, err)
+		if !granted {
+			t.Fatalf("expected %s to be granted to Org2MSP", role)
+		}
+	}
+}
+
+func TestGrantAndRevokeRole(t *testing.T) {
+	ledger, contract := newInitializedLedger(t)
+
+	mustFail(t, contract.GrantRole(ledger.as(commercial, "Org1MSP"), RoleMinter, MemberTypeMSP, "Org1MSP"))
+	mustFail(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), "OWNER", MemberTypeMSP, "Org1MSP"))
+
+	mustSucceed(t, contract.GrantRole(ledger.as(centralBank, "Org2MSP"), RoleMinter, MemberTypeClient, commercial))
+	if name := ledger.lastEvent(); name != "RoleGranted" {
+		t.Fatalf("expected RoleGranted event, got %q", name)
+	}
+
+	members, err := contract.ListRoleMembers(ledger.as(customer, "Org1MSP"), RoleMinter)
+	mustSucceed(t, err)
+	if len(members) != 2 {
+		t.Fatalf("expected 2 minters, got %d", len(members))
+	}
+
+	mustSucceed(t, requireRole(ledger.as(commercial, "Org1MSP"), RoleMinter))
+	mustFail(t, requireRole(ledger.as(customer, "Org1MSP"), RoleMinter))
+
+	mustSucceed(t, contract.RevokeRole(ledger.as(centralBank, "Org2MSP"), RoleMinter, MemberTypeClient, commercial))
+	if name := ledger.lastEvent(); name != "RoleRevoked" {
+		t.Fatalf("expected RoleRevoked event, got %q", name)
+	}
+	mustFail(t, requireRole(ledger.as(commercial, "Org1MSP"), RoleMinter))
+
+	mustFail(t, contract.RevokeRole(ledger.as(centralBank, "Org2MSP"), RoleAdmin, MemberTypeMSP, "Org2MSP"))
+}
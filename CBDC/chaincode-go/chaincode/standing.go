@@ -0,0 +1,654 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the schedules of a standing order
+const (
+	ScheduleOnce    = "once"
+	ScheduleDaily   = "daily"
+	ScheduleWeekly  = "weekly"
+	ScheduleMonthly = "monthly"
+)
+
+// Define the statuses of a standing order
+const (
+	OrderActive    = "active"
+	OrderCompleted = "completed"
+	OrderCancelled = "cancelled"
+)
+
+// Define the results of a scheduled payment
+const (
+	OrderRunPaid    = "paid"
+	OrderRunSkipped = "skipped"
+)
+
+// Define objectType names for prefix
+const (
+	standingOrderPrefix = "standingOrder"
+	dueOrderPrefix      = "dueOrder"
+	orderRunPrefix      = "orderRun"
+)
+
+// dateLayout is the layout of the calendar dates orders are scheduled on, dates are in UTC
+const dateLayout = "2006-01-02"
+
+var knownSchedules = []string{ScheduleOnce, ScheduleDaily, ScheduleWeekly, ScheduleMonthly}
+
+// StandingOrder is a payment repeated on a schedule until its end date, or a single future-dated payment
+type StandingOrder struct {
+	ID         string     `json:"id"`
+	Payer      string     `json:"payer"`
+	Recipient  string     `json:"recipient"`
+	Amount     string     `json:"amount"`
+	Schedule   string     `json:"schedule"`
+	StartDate  string     `json:"startDate"`
+	EndDate    string     `json:"endDate,omitempty"`
+	NextDate   string     `json:"nextDate,omitempty"`
+	Occurrence int        `json:"occurrence"`
+	Remittance Remittance `json:"remittance"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// OrderRun records the outcome of a standing order on one scheduled date. A paid run is recorded as a transfer
+// under TxID, which is the transaction ID followed by the position of the run in the transaction
+type OrderRun struct {
+	Order      string    `json:"order"`
+	Date       string    `json:"date"`
+	Status     string    `json:"status"`
+	Reason     string    `json:"reason,omitempty"`
+	TxID       string    `json:"txID"`
+	ExecutedAt time.Time `json:"executedAt"`
+}
+
+// orderRunsEvent provides an organized struct for emitting the outcome of ExecuteDueOrders
+type orderRunsEvent struct {
+	Paid     int        `json:"paid"`
+	Skipped  int        `json:"skipped"`
+	Deferred int        `json:"deferred"`
+	Runs     []OrderRun `json:"runs"`
+}
+
+// CreateStandingOrder schedules payments from the client account to recipient
+// param {String} amount The decimal amount of every payment, e.g. "125.50"
+// param {String} schedule One of "once", "daily", "weekly" or "monthly", optionally followed by the date of the first payment,
+// e.g. "monthly:2023-06-01". Without a date the first payment is due today. Monthly payments due on a day a month doesn't have
+// are due on its last day
+// param {String} endDate The date of the last possible payment, e.g. "2024-05-31", empty to repeat until cancelled
+// param {Remittance} remittance The memo, end-to-end reference and purpose code every payment carries, all optional
+// returns {String} The ID of the standing order
+// This function triggers a StandingOrderCreated event
+func (s *Erc20Contract) CreateStandingOrder(ctx contractapi.TransactionContextInterface, recipient string, amount string, schedule string, endDate string, remittance Remittance) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = checkClientRecipient(recipient)
+	if err != nil {
+		return "", err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID == recipient {
+		return "", fmt.Errorf("cannot create a standing order to the client account itself")
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := parseAmount(amount, decimals)
+	if err != nil {
+		return "", err
+	}
+	if value.Sign() <= 0 {
+		return "", fmt.Errorf("standing order amount must be positive")
+	}
+
+	err = validateRemittance(ctx, remittance)
+	if err != nil {
+		return "", err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	today := now.Format(dateLayout)
+
+	frequency, startDate := schedule, today
+	if i := strings.Index(schedule, ":"); i >= 0 {
+		frequency, startDate = schedule[:i], schedule[i+1:]
+	}
+	if !containsString(knownSchedules, frequency) {
+		return "", fmt.Errorf("unknown schedule %s, expected one of %s", frequency, strings.Join(knownSchedules, ", "))
+	}
+
+	_, err = time.Parse(dateLayout, startDate)
+	if err != nil {
+		return "", fmt.Errorf("invalid start date %s, expected YYYY-MM-DD", startDate)
+	}
+	if startDate < today {
+		return "", fmt.Errorf("start date %s is in the past", startDate)
+	}
+
+	if frequency == ScheduleOnce {
+		endDate = startDate
+	}
+	if endDate != "" {
+		_, err = time.Parse(dateLayout, endDate)
+		if err != nil {
+			return "", fmt.Errorf("invalid end date %s, expected YYYY-MM-DD", endDate)
+		}
+		if endDate < startDate {
+			return "", fmt.Errorf("end date %s is before the start date %s", endDate, startDate)
+		}
+	}
+
+	id := ctx.GetStub().GetTxID()
+	order := &StandingOrder{
+		ID:         id,
+		Payer:      clientID,
+		Recipient:  recipient,
+		Amount:     formatAmount(value, decimals),
+		Schedule:   frequency,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		NextDate:   startDate,
+		Remittance: remittance,
+		Status:     OrderActive,
+		CreatedAt:  now,
+	}
+
+	err = putStandingOrder(ctx, order, "")
+	if err != nil {
+		return "", err
+	}
+
+	err = emitStandingOrderEvent(ctx, "StandingOrderCreated", order)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("client %s created standing order %s of %s to %s %s from %s", clientID, id, order.Amount, recipient, frequency, startDate)
+
+	return id, nil
+}
+
+// CancelStandingOrder stops all future payments of a standing order of the client account
+// This function triggers a StandingOrderCancelled event
+func (s *Erc20Contract) CancelStandingOrder(ctx contractapi.TransactionContextInterface, orderID string) error {
+
+	order, err := readStandingOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if order.Payer != clientID {
+		return fmt.Errorf("standing order %s was not created by the client", orderID)
+	}
+	if order.Status != OrderActive {
+		return fmt.Errorf("standing order %s is %s", orderID, order.Status)
+	}
+
+	previousDate := order.NextDate
+	order.Status = OrderCancelled
+	order.NextDate = ""
+
+	err = putStandingOrder(ctx, order, previousDate)
+	if err != nil {
+		return err
+	}
+
+	err = emitStandingOrderEvent(ctx, "StandingOrderCancelled", order)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("standing order %s cancelled by %s", orderID, clientID)
+
+	return nil
+}
+
+// ExecuteDueOrders pays up to limit standing orders due by the transaction date, any bank can call it.
+// A payment that fails, e.g. for insufficient funds, is skipped and recorded, and the order moves on to its next date.
+// Every scheduled date is processed once, an order that missed several dates catches up one date per call.
+// Orders sharing an account with an order paid earlier in the call are deferred to the next call, as the second
+// payment wouldn't see the balances written by the first, see balanceSheet
+// This function triggers a StandingOrdersExecuted event
+func (s *Erc20Contract) ExecuteDueOrders(ctx contractapi.TransactionContextInterface, limit int) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to execute standing orders: %v", err)
+	}
+
+	// Skipping every due order while transfers are paused would lose their payments
+	err = checkNotPaused(ctx, PauseTransfers)
+	if err != nil {
+		return err
+	}
+
+	maxBatchSize, err := readConfigInt(ctx, maxBatchSizeField, defaultMaxBatchSize)
+	if err != nil {
+		return err
+	}
+	if limit <= 0 || limit > maxBatchSize {
+		return fmt.Errorf("limit must be between 1 and the maximum batch size of %d", maxBatchSize)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	today := now.Format(dateLayout)
+
+	due, err := readDueOrders(ctx, today)
+	if err != nil {
+		return err
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	summary := orderRunsEvent{Runs: []OrderRun{}}
+	parties := []string{}
+	touched := make(map[string]bool)
+	for _, orderID := range due {
+		if len(summary.Runs) == limit {
+			break
+		}
+
+		order, err := readStandingOrder(ctx, orderID)
+		if err != nil {
+			return err
+		}
+
+		value, err := parseAmount(order.Amount, decimals)
+		if err != nil {
+			return err
+		}
+
+		footprint, err := orderFootprint(ctx, order, value)
+		if err != nil {
+			return err
+		}
+		if overlaps(touched, footprint) {
+			summary.Deferred++
+			continue
+		}
+		for _, key := range footprint {
+			touched[key] = true
+		}
+
+		err = checkNotRun(ctx, order.ID, order.NextDate)
+		if err != nil {
+			return err
+		}
+
+		run := OrderRun{order.ID, order.NextDate, OrderRunPaid, "", lineTxID(ctx.GetStub().GetTxID(), len(summary.Runs)+1), now}
+		_, _, err = transferWithFees(ctx, FeeTransfer, order.Payer, []payout{{order.Recipient, value}})
+		if err != nil {
+			run.Status = OrderRunSkipped
+			run.Reason = err.Error()
+			summary.Skipped++
+		} else {
+			err = recordTransferAs(ctx, run.TxID, order.Payer, order.Recipient, value, order.Remittance)
+			if err != nil {
+				return err
+			}
+			summary.Paid++
+		}
+
+		err = putOrderRun(ctx, order, &run)
+		if err != nil {
+			return err
+		}
+
+		previousDate := order.NextDate
+		order.Occurrence++
+		order.NextDate = scheduledDate(order, order.Occurrence)
+		if order.Schedule == ScheduleOnce || (order.EndDate != "" && order.NextDate > order.EndDate) {
+			order.Status = OrderCompleted
+			order.NextDate = ""
+		}
+
+		err = putStandingOrder(ctx, order, previousDate)
+		if err != nil {
+			return err
+		}
+
+		summary.Runs = append(summary.Runs, run)
+		parties = append(parties, order.Payer, order.Recipient)
+	}
+
+	// The reasons of skipped runs can name accounts and amounts
+	err = emitPaymentEvent(ctx, "StandingOrdersExecuted", "", summary, parties...)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("standing orders due by %s: %d paid, %d skipped, %d deferred", today, summary.Paid, summary.Skipped, summary.Deferred)
+
+	return nil
+}
+
+// GetStandingOrder returns a standing order, only its payer, its recipient and the servicing bank of the payer can read it
+func (s *Erc20Contract) GetStandingOrder(ctx contractapi.TransactionContextInterface, orderID string) (*StandingOrder, error) {
+
+	order, err := readStandingOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireOrderAccess(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GetStandingOrderRuns returns the outcome of every scheduled date of a standing order processed so far
+func (s *Erc20Contract) GetStandingOrderRuns(ctx contractapi.TransactionContextInterface, orderID string) ([]OrderRun, error) {
+
+	order, err := readStandingOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireOrderAccess(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := readStateByPartialKey(ctx, orderRunPrefix, []string{orderID}, order.Payer, order.Recipient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runs of standing order %s: %v", orderID, err)
+	}
+
+	runs := []OrderRun{}
+	for _, queryResponse := range results {
+		var run OrderRun
+		err = json.Unmarshal(queryResponse.Value, &run)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode run of standing order %s: %v", orderID, err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// Helper Functions
+
+// scheduledDate returns the date of the n-th payment of a standing order, counting from 0
+func scheduledDate(order *StandingOrder, n int) string {
+	start, _ := time.Parse(dateLayout, order.StartDate)
+
+	switch order.Schedule {
+	case ScheduleDaily:
+		return start.AddDate(0, 0, n).Format(dateLayout)
+	case ScheduleWeekly:
+		return start.AddDate(0, 0, 7*n).Format(dateLayout)
+	case ScheduleMonthly:
+		// Count from the start date rather than the previous payment, so a payment on the 31st returns after a short month
+		month := time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+		day := start.Day()
+		if last := month.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+		return month.AddDate(0, 0, day-1).Format(dateLayout)
+	default:
+		return order.StartDate
+	}
+}
+
+// orderFootprint returns the state a payment of a standing order can change besides its own records:
+// the accounts of payer and recipient, the fee collectors, the reserves their waterfalls use and the programs
+// of the payer's earmarked funds
+func orderFootprint(ctx contractapi.TransactionContextInterface, order *StandingOrder, value *big.Int) ([]string, error) {
+	footprint := []string{order.Payer, order.Recipient}
+
+	_, fees, err := assessFees(ctx, FeeTransfer, order.Payer, []*big.Int{value})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range fees {
+		footprint = append(footprint, p.to)
+	}
+
+	for _, account := range []string{order.Payer, order.Recipient} {
+		waterfall, err := readWaterfall(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		if waterfall != nil {
+			footprint = append(footprint, reserveAccount(waterfall.Bank))
+		}
+	}
+
+	earmarks, err := readEarmarks(ctx, order.Payer)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range earmarks {
+		footprint = append(footprint, internalAccount(programPrefix, e.program))
+	}
+
+	return footprint, nil
+}
+
+func overlaps(touched map[string]bool, keys []string) bool {
+	for _, key := range keys {
+		if touched[key] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requireOrderAccess checks the caller is the payer or recipient of a standing order, or a bank or central bank role
+// allowed to see the accounts of the payer
+func requireOrderAccess(ctx contractapi.TransactionContextInterface, order *StandingOrder) error {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID == order.Payer || clientID == order.Recipient {
+		return nil
+	}
+
+	payer, err := readAccount(ctx, order.Payer)
+	if err != nil {
+		return err
+	}
+	if payer != nil {
+		err = requireBankOrCentralBank(ctx, payer.Bank)
+	} else {
+		err = requireRole(ctx, RoleAdmin, RoleAuditor, RoleRegulator)
+	}
+	if err != nil {
+		return fmt.Errorf("client is not authorized to read standing order %s: %v", order.ID, err)
+	}
+
+	return nil
+}
+
+// readDueOrders returns the IDs of the active standing orders due by date, earliest first
+func readDueOrders(ctx contractapi.TransactionContextInterface, date string) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(dueOrderPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read due standing orders from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	due := []string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key %s: %v", queryResponse.Key, err)
+		}
+
+		// The index is ordered by date, so the orders after a later date are not due either
+		if attributes[0] > date {
+			break
+		}
+		due = append(due, attributes[1])
+	}
+
+	return due, nil
+}
+
+func readStandingOrder(ctx contractapi.TransactionContextInterface, orderID string) (*StandingOrder, error) {
+	key, err := compositeKey(ctx, standingOrderPrefix, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	orderBytes, err := readRecord(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read standing order %s: %v", orderID, err)
+	}
+	if orderBytes == nil {
+		return nil, fmt.Errorf("standing order %s does not exist", orderID)
+	}
+
+	order := new(StandingOrder)
+	err = json.Unmarshal(orderBytes, order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode standing order %s: %v", orderID, err)
+	}
+
+	return order, nil
+}
+
+// putStandingOrder stores a standing order and moves it in the index of due orders from previousDate to its next date
+func putStandingOrder(ctx contractapi.TransactionContextInterface, order *StandingOrder, previousDate string) error {
+	key, err := compositeKey(ctx, standingOrderPrefix, order.ID)
+	if err != nil {
+		return err
+	}
+
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putRecord(ctx, key, orderJSON, order.Payer, order.Recipient)
+	if err != nil {
+		return fmt.Errorf("failed to update standing order %s: %v", order.ID, err)
+	}
+
+	if previousDate != "" {
+		previousKey, err := compositeKey(ctx, dueOrderPrefix, previousDate, order.ID)
+		if err != nil {
+			return err
+		}
+
+		err = ctx.GetStub().DelState(previousKey)
+		if err != nil {
+			return fmt.Errorf("failed to update due standing orders: %v", err)
+		}
+	}
+
+	if order.Status == OrderActive {
+		dueKey, err := compositeKey(ctx, dueOrderPrefix, order.NextDate, order.ID)
+		if err != nil {
+			return err
+		}
+
+		// Only the key is needed for the index, value can't be empty so store a null byte
+		err = ctx.GetStub().PutState(dueKey, []byte{0x00})
+		if err != nil {
+			return fmt.Errorf("failed to update due standing orders: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// checkNotRun makes sure a scheduled date of a standing order is processed only once
+func checkNotRun(ctx contractapi.TransactionContextInterface, orderID string, date string) error {
+	key, err := compositeKey(ctx, orderRunPrefix, orderID, date)
+	if err != nil {
+		return err
+	}
+
+	existing, err := readRecord(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to read run of standing order %s: %v", orderID, err)
+	}
+	if existing != nil {
+		return fmt.Errorf("standing order %s was already processed for %s", orderID, date)
+	}
+
+	return nil
+}
+
+// putOrderRun records the outcome of a scheduled date of a standing order
+func putOrderRun(ctx contractapi.TransactionContextInterface, order *StandingOrder, run *OrderRun) error {
+	key, err := compositeKey(ctx, orderRunPrefix, run.Order, run.Date)
+	if err != nil {
+		return err
+	}
+
+	runJSON, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putRecord(ctx, key, runJSON, order.Payer, order.Recipient)
+	if err != nil {
+		return fmt.Errorf("failed to record run of standing order %s: %v", run.Order, err)
+	}
+
+	return nil
+}
+
+// emitStandingOrderEvent emits a standing order event carrying the order
+func emitStandingOrderEvent(ctx contractapi.TransactionContextInterface, name string, order *StandingOrder) error {
+	return emitPaymentEvent(ctx, name, order.ID, order, order.Payer, order.Recipient)
+}
@@ -0,0 +1,122 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStandingOrders(t *testing.T) {
+	landlord := commercial
+	grocer := clientID("CN=user2,OU=client,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org1.example.com")
+	ledger, contract := newFundedLedger(t, TierFull, customer, landlord, grocer)
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "150"))
+
+	_, err := contract.CreateStandingOrder(ledger.as(customer, "Org1MSP"), landlord, "100", "yearly", "", Remittance{})
+	mustFail(t, err)
+	_, err = contract.CreateStandingOrder(ledger.as(customer, "Org1MSP"), landlord, "100", "monthly:2023-05-01", "", Remittance{})
+	mustFail(t, err)
+
+	rent, err := contract.CreateStandingOrder(ledger.as(customer, "Org1MSP"), landlord, "100", "monthly:2023-05-31", "2023-07-31", Remittance{Memo: "rent", Reference: "LEASE-7"})
+	mustSucceed(t, err)
+	if name := ledger.lastEvent(); name != "StandingOrderCreated" {
+		t.Fatalf("expected StandingOrderCreated event, got %q", name)
+	}
+	first, err := contract.CreateStandingOrder(ledger.as(customer, "Org1MSP"), grocer, "10", ScheduleOnce, "", Remittance{})
+	mustSucceed(t, err)
+	second, err := contract.CreateStandingOrder(ledger.as(customer, "Org1MSP"), grocer, "20", ScheduleOnce, "", Remittance{})
+	mustSucceed(t, err)
+
+	mustFail(t, contract.ExecuteDueOrders(ledger.as(centralBank, "Org2MSP"), 10))
+
+	// Both payments of the customer are due, the second one waits for the next call
+	mustSucceed(t, contract.ExecuteDueOrders(ledger.as(commercial, "Org1MSP"), 10))
+	if name := ledger.lastEvent(); name != "StandingOrdersExecuted" {
+		t.Fatalf("expected StandingOrdersExecuted event, got %q", name)
+	}
+	mustSucceed(t, contract.ExecuteDueOrders(ledger.as(commercial, "Org1MSP"), 10))
+	for _, orderID := range []string{first, second} {
+		order, err := contract.GetStandingOrder(ledger.as(customer, "Org1MSP"), orderID)
+		mustSucceed(t, err)
+		if order.Status != OrderCompleted {
+			t.Fatalf("expected standing order %s to be completed, got %s", orderID, order.Status)
+		}
+	}
+
+	// The rent is paid on the 31st, a repeated call on the same day pays nothing
+	ledger.advance(29 * 24 * time.Hour)
+	mustSucceed(t, contract.ExecuteDueOrders(ledger.as(commercial, "Org1MSP"), 10))
+	mustSucceed(t, contract.ExecuteDueOrders(ledger.as(commercial, "Org1MSP"), 10))
+
+	// June has no 31st, the customer can't pay
+	ledger.advance(30 * 24 * time.Hour)
+	mustSucceed(t, contract.ExecuteDueOrders(ledger.as(commercial, "Org1MSP"), 10))
+
+	ledger.advance(31 * 24 * time.Hour)
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "100"))
+	mustSucceed(t, contract.ExecuteDueOrders(ledger.as(commercial, "Org1MSP"), 10))
+
+	runs, err := contract.GetStandingOrderRuns(ledger.as(landlord, "Org1MSP"), rent)
+	mustSucceed(t, err)
+	expected := []string{"2023-05-31 paid", "2023-06-30 skipped", "2023-07-31 paid"}
+	if len(runs) != len(expected) {
+		t.Fatalf("expected %d runs, got %+v", len(expected), runs)
+	}
+	for i, run := range runs {
+		if run.Date+" "+run.Status != expected[i] {
+			t.Fatalf("expected run %s, got %+v", expected[i], run)
+		}
+	}
+
+	// Orders and runs of registered accounts are kept in the collection of their bank
+	ctx := ledger.as(customer, "Org1MSP")
+	for _, attributes := range [][]string{{standingOrderPrefix, rent}, {orderRunPrefix, rent, "2023-06-30"}} {
+		key, err := compositeKey(ctx, attributes[0], attributes[1:]...)
+		mustSucceed(t, err)
+		if ledger.stub.State[key] != nil || ledger.stub.PvtState[balancesCollection("Org1MSP")][key] == nil {
+			t.Fatalf("expected %v in the collection of the bank only", attributes)
+		}
+	}
+
+	// Paid runs are recorded as transfers carrying the remittance of the order
+	transfers, err := contract.GetTransfersByReference(ledger.as(landlord, "Org1MSP"), "LEASE-7")
+	mustSucceed(t, err)
+	if len(transfers) != 2 || transfers[0].TxID != runs[0].TxID || transfers[0].Remittance.Memo != "rent" {
+		t.Fatalf("unexpected transfers %+v", transfers)
+	}
+	mustSucceed(t, contract.RefundPayment(ledger.as(landlord, "Org1MSP"), runs[2].TxID, "10"))
+
+	order, err := contract.GetStandingOrder(ledger.as(customer, "Org1MSP"), rent)
+	mustSucceed(t, err)
+	if order.Status != OrderCompleted {
+		t.Fatalf("expected the rent to be completed, got %s", order.Status)
+	}
+	mustFail(t, contract.CancelStandingOrder(ledger.as(customer, "Org1MSP"), rent))
+
+	for account, expected := range map[string]string{customer: "30.00", landlord: "190.00", grocer: "30.00"} {
+		balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), account)
+		mustSucceed(t, err)
+		if balance != expected {
+			t.Fatalf("expected balance %s, got %s", expected, balance)
+		}
+	}
+}
+
+func TestCancelStandingOrder(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial)
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "100"))
+
+	orderID, err := contract.CreateStandingOrder(ledger.as(customer, "Org1MSP"), commercial, "10", ScheduleWeekly, "", Remittance{})
+	mustSucceed(t, err)
+	mustFail(t, contract.CancelStandingOrder(ledger.as(commercial, "Org1MSP"), orderID))
+	mustSucceed(t, contract.CancelStandingOrder(ledger.as(customer, "Org1MSP"), orderID))
+	if name := ledger.lastEvent(); name != "StandingOrderCancelled" {
+		t.Fatalf("expected StandingOrderCancelled event, got %q", name)
+	}
+
+	mustSucceed(t, contract.ExecuteDueOrders(ledger.as(commercial, "Org1MSP"), 10))
+	balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if balance != "100.00" {
+		t.Fatalf("expected balance 100.00, got %s", balance)
+	}
+}
@@ -0,0 +1,373 @@
+package chaincode
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+// Every kind of Erc20Contract state lives under its own composite key prefix
+const (
+	metadataPrefix  = "metadata"
+	balancePrefix   = "balance"
+	allowancePrefix = "allowance"
+	supplyPrefix    = "supply"
+	configPrefix    = "config"
+)
+
+// Define key names for options
+const (
+	nameField        = "name"
+	symbolField      = "symbol"
+	decimalsField    = "decimals"
+	totalSupplyField = "totalSupply"
+)
+
+// Helper Functions
+
+// metadataKey returns the world state key of a token option such as its name or symbol
+func metadataKey(ctx contractapi.TransactionContextInterface, field string) (string, error) {
+	return compositeKey(ctx, metadataPrefix, field)
+}
+
+// balanceKey returns the world state key holding the balance of an account
+func balanceKey(ctx contractapi.TransactionContextInterface, account string) (string, error) {
+	return compositeKey(ctx, balancePrefix, account)
+}
+
+// allowanceKey returns the world state key holding the amount a spender may withdraw from the owner
+func allowanceKey(ctx contractapi.TransactionContextInterface, owner string, spender string) (string, error) {
+	return compositeKey(ctx, allowancePrefix, owner, spender)
+}
+
+// totalSupplyKey returns the world state key holding the total token supply
+func totalSupplyKey(ctx contractapi.TransactionContextInterface) (string, error) {
+	return compositeKey(ctx, supplyPrefix, totalSupplyField)
+}
+
+// configKey returns the world state key of a contract setting such as the maximum batch size
+func configKey(ctx contractapi.TransactionContextInterface, field string) (string, error) {
+	return compositeKey(ctx, configPrefix, field)
+}
+
+// internalAccount returns the ID of an account held by the contract itself, such as the reserve of a bank.
+// Client IDs are base64 encoded and never contain "::", so internal accounts can't collide with them
+func internalAccount(kind string, id string) string {
+	return kind + "::" + id
+}
+
+// isInternalAccount reports whether account was returned by internalAccount
+func isInternalAccount(account string) bool {
+	return strings.Contains(account, "::")
+}
+
+// txTime returns the timestamp of the transaction, which is the same on every endorsing peer
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC(), nil
+}
+
+func compositeKey(ctx contractapi.TransactionContextInterface, prefix string, attributes ...string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(prefix, attributes)
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key for prefix %s: %v", prefix, err)
+	}
+
+	return key, nil
+}
+
+// putMetadata stores the token options set by Initialize or carried over by MigrateState
+func putMetadata(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals string) error {
+	options := []struct {
+		field string
+		value string
+	}{
+		{nameField, name},
+		{symbolField, symbol},
+		{decimalsField, decimals},
+	}
+
+	for _, option := range options {
+		key, err := metadataKey(ctx, option.field)
+		if err != nil {
+			return err
+		}
+
+		err = ctx.GetStub().PutState(key, []byte(option.value))
+		if err != nil {
+			return fmt.Errorf("failed to set token %s: %v", option.field, err)
+		}
+	}
+
+	return nil
+}
+
+// Amounts are stored in world state as base-10 integers in the token's smallest unit,
+// e.g. kopecks for a token with 2 decimals
+
+// readBalance returns the balance of an account, exists is false when the account has never held tokens
+func readBalance(ctx contractapi.TransactionContextInterface, account string) (*big.Int, bool, error) {
+	key, err := balanceKey(ctx, account)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return readAccountAmount(ctx, account, key)
+}
+
+// writeBalance stores the balance of an account
+// Every balance change goes through here, so interest accrued on the previous balance is checkpointed first
+func writeBalance(ctx contractapi.TransactionContextInterface, account string, balance *big.Int) error {
+	err := checkpointAccrual(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	return storeBalance(ctx, account, balance)
+}
+
+// storeBalance stores the balance of an account without checkpointing its accrual
+func storeBalance(ctx contractapi.TransactionContextInterface, account string, balance *big.Int) error {
+	key, err := balanceKey(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	return putAccountAmount(ctx, account, key, balance)
+}
+
+// readTotalSupply returns the total token supply, which is 0 until tokens are minted
+func readTotalSupply(ctx contractapi.TransactionContextInterface) (*big.Int, error) {
+	key, err := totalSupplyKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	totalSupply, _, err := readAmount(ctx, key)
+
+	return totalSupply, err
+}
+
+// writeTotalSupply stores the total token supply
+func writeTotalSupply(ctx contractapi.TransactionContextInterface, totalSupply *big.Int) error {
+	key, err := totalSupplyKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putAmount(ctx, key, totalSupply)
+}
+
+// readAllowance returns the amount the spender may still withdraw from the owner, 0 when none was approved
+func readAllowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (*big.Int, error) {
+	key, err := allowanceKey(ctx, owner, spender)
+	if err != nil {
+		return nil, err
+	}
+
+	allowance, _, err := readAccountAmount(ctx, owner, key)
+
+	return allowance, err
+}
+
+// writeAllowance stores the amount the spender may withdraw from the owner
+func writeAllowance(ctx contractapi.TransactionContextInterface, owner string, spender string, allowance *big.Int) error {
+	key, err := allowanceKey(ctx, owner, spender)
+	if err != nil {
+		return err
+	}
+
+	return putAccountAmount(ctx, owner, key, allowance)
+}
+
+// readAmount reads an integer amount stored under key, a missing key reads as 0 with exists set to false
+func readAmount(ctx contractapi.TransactionContextInterface, key string) (*big.Int, bool, error) {
+	amountBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s from world state: %v", key, err)
+	}
+
+	return decodeAmount(key, amountBytes)
+}
+
+// putAmount stores an integer amount under key
+func putAmount(ctx contractapi.TransactionContextInterface, key string, amount *big.Int) error {
+	err := ctx.GetStub().PutState(key, []byte(amount.String()))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// readAccountAmount reads an integer amount belonging to an account, which is kept in the private data
+// collection of its servicing bank when it has one
+func readAccountAmount(ctx contractapi.TransactionContextInterface, account string, key string) (*big.Int, bool, error) {
+	amountBytes, err := readAccountState(ctx, account, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return decodeAmount(key, amountBytes)
+}
+
+// putAccountAmount stores an integer amount belonging to an account where readAccountAmount finds it
+func putAccountAmount(ctx contractapi.TransactionContextInterface, account string, key string, amount *big.Int) error {
+	return putAccountState(ctx, account, key, []byte(amount.String()))
+}
+
+// decodeAmount parses an amount read from key, nil reads as 0 with exists set to false
+func decodeAmount(key string, amountBytes []byte) (*big.Int, bool, error) {
+	if amountBytes == nil {
+		return new(big.Int), false, nil
+	}
+
+	amount, ok := new(big.Int).SetString(string(amountBytes), 10)
+	if !ok {
+		return nil, false, fmt.Errorf("value %q stored under %s is not an integer amount", amountBytes, key)
+	}
+
+	return amount, true, nil
+}
+
+// readConfigInt returns an integer contract setting, or defaultValue when it was never set
+func readConfigInt(ctx contractapi.TransactionContextInterface, field string, defaultValue int) (int, error) {
+	key, err := configKey(ctx, field)
+	if err != nil {
+		return 0, err
+	}
+
+	valueBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read setting %s from world state: %v", field, err)
+	}
+	if valueBytes == nil {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(string(valueBytes))
+	if err != nil {
+		return 0, fmt.Errorf("setting %s is not an integer: %v", field, err)
+	}
+
+	return value, nil
+}
+
+// putConfigInt stores an integer contract setting
+func putConfigInt(ctx contractapi.TransactionContextInterface, field string, value int) error {
+	key, err := configKey(ctx, field)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, []byte(strconv.Itoa(value)))
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %v", field, err)
+	}
+
+	return nil
+}
+
+// balanceSheet caches the balances touched by a transaction. World state reads don't see writes of the
+// same transaction, so every balance is read once, changed in memory and written once by write.
+// symbol is empty for the primary denomination
+type balanceSheet struct {
+	ctx      contractapi.TransactionContextInterface
+	symbol   string
+	balances map[string]*big.Int
+	exists   map[string]bool
+	accounts []string
+	deferred []func() error
+}
+
+func newBalanceSheet(ctx contractapi.TransactionContextInterface) *balanceSheet {
+	return newDenominationSheet(ctx, "")
+}
+
+// newDenominationSheet returns a balance sheet of a denomination registered by RegisterDenomination
+func newDenominationSheet(ctx contractapi.TransactionContextInterface, symbol string) *balanceSheet {
+	return &balanceSheet{ctx: ctx, symbol: symbol, balances: make(map[string]*big.Int), exists: make(map[string]bool)}
+}
+
+// balance returns the current balance of an account including the changes made on the sheet,
+// exists is false when the account had no balance in world state
+func (b *balanceSheet) balance(account string) (*big.Int, bool, error) {
+	if balance, ok := b.balances[account]; ok {
+		return new(big.Int).Set(balance), b.exists[account], nil
+	}
+
+	var balance *big.Int
+	var exists bool
+	var err error
+	if b.symbol == "" {
+		balance, exists, err = readBalance(b.ctx, account)
+	} else {
+		balance, exists, err = readDenominationBalance(b.ctx, b.symbol, account)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read account %s from world state: %v", account, err)
+	}
+
+	b.balances[account] = balance
+	b.exists[account] = exists
+	b.accounts = append(b.accounts, account)
+
+	return new(big.Int).Set(balance), exists, nil
+}
+
+// add changes the balance of an account by delta, which is negative for a debit
+func (b *balanceSheet) add(account string, delta *big.Int) error {
+	_, _, err := b.balance(account)
+	if err != nil {
+		return err
+	}
+
+	b.balances[account].Add(b.balances[account], delta)
+
+	return nil
+}
+
+// onWrite registers a state change that belongs to the balance changes on the sheet,
+// it is stored by write so that nothing is written before every check passed
+func (b *balanceSheet) onWrite(change func() error) {
+	b.deferred = append(b.deferred, change)
+}
+
+// write checks no balance went negative and stores every balance read by the sheet and the changes registered with onWrite
+func (b *balanceSheet) write() error {
+	for _, account := range b.accounts {
+		if b.balances[account].Sign() < 0 {
+			return fmt.Errorf("client account %s has insufficient funds", account)
+		}
+	}
+
+	for _, account := range b.accounts {
+		var err error
+		if b.symbol == "" {
+			err = writeBalance(b.ctx, account, b.balances[account])
+		} else {
+			err = writeDenominationBalance(b.ctx, b.symbol, account, b.balances[account])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, change := range b.deferred {
+		err := change()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
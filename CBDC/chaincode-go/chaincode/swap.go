@@ -0,0 +1,386 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the statuses of a payment-versus-payment swap
+const (
+	SwapProposed  = "proposed"
+	SwapSettled   = "settled"
+	SwapCancelled = "cancelled"
+	SwapExpired   = "expired"
+)
+
+// Define objectType names for prefix
+const swapPrefix = "swap"
+
+// Swap exchanges amounts of two denominations between two parties. The proposer's leg is held in escrow
+// until the counterparty accepts and both legs settle in the same transaction, or until it is cancelled or expires
+type Swap struct {
+	ID           string    `json:"id"`
+	Proposer     string    `json:"proposer"`
+	Counterparty string    `json:"counterparty"`
+	GiveSymbol   string    `json:"giveSymbol"`
+	GiveAmount   string    `json:"giveAmount"`
+	GetSymbol    string    `json:"getSymbol"`
+	GetAmount    string    `json:"getAmount"`
+	Expiry       time.Time `json:"expiry"`
+	Status       string    `json:"status"`
+	Escrow       string    `json:"escrow,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ClosedAt     time.Time `json:"closedAt,omitempty"`
+}
+
+// ProposeSwap offers the counterparty giveAmount of giveSymbol in exchange for getAmount of getSymbol.
+// The given amount moves from the client account into escrow until the swap is accepted, cancelled or expires
+// param {String} giveAmount The decimal amount the client pays, e.g. "125.50"
+// param {String} getAmount The decimal amount the counterparty pays, e.g. "125.50"
+// param {int64} expiry The Unix time in seconds from which the swap can no longer be accepted
+// returns {String} The ID of the swap
+// This function triggers a SwapProposed event
+func (s *Erc20Contract) ProposeSwap(ctx contractapi.TransactionContextInterface, counterparty string, giveSymbol string, giveAmount string, getSymbol string, getAmount string, expiry int64) (string, error) {
+
+	if giveSymbol == getSymbol {
+		return "", fmt.Errorf("a swap exchanges two different denominations")
+	}
+
+	give, err := readDenomination(ctx, giveSymbol)
+	if err != nil {
+		return "", err
+	}
+
+	get, err := readDenomination(ctx, getSymbol)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkClientRecipient(counterparty)
+	if err != nil {
+		return "", err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID == counterparty {
+		return "", fmt.Errorf("cannot propose a swap to the client account itself")
+	}
+
+	giveValue, err := parseAmount(giveAmount, give.Decimals)
+	if err != nil {
+		return "", err
+	}
+
+	getValue, err := parseAmount(getAmount, get.Decimals)
+	if err != nil {
+		return "", err
+	}
+	if giveValue.Sign() <= 0 || getValue.Sign() <= 0 {
+		return "", fmt.Errorf("swap amounts must be positive")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Unix(expiry, 0).UTC()
+	if !expiresAt.After(now) {
+		return "", fmt.Errorf("expiry must be in the future")
+	}
+
+	id := ctx.GetStub().GetTxID()
+	escrow, err := escrowAccount(ctx, swapPrefix, id, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	swap := &Swap{
+		ID:           id,
+		Proposer:     clientID,
+		Counterparty: counterparty,
+		GiveSymbol:   giveSymbol,
+		GiveAmount:   formatAmount(giveValue, give.Decimals),
+		GetSymbol:    getSymbol,
+		GetAmount:    formatAmount(getValue, get.Decimals),
+		Expiry:       expiresAt,
+		Status:       SwapProposed,
+		Escrow:       escrow,
+		CreatedAt:    now,
+	}
+
+	err = transferSymbol(ctx, give, clientID, escrow, giveValue)
+	if err != nil {
+		return "", fmt.Errorf("failed to escrow swap leg: %v", err)
+	}
+
+	err = putSwap(ctx, swap)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitSwapEvent(ctx, "SwapProposed", swap)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("client %s proposed swap %s of %s %s for %s %s", clientID, id, swap.GiveAmount, giveSymbol, swap.GetAmount, getSymbol)
+
+	return id, nil
+}
+
+// AcceptSwap settles a proposed swap, only its counterparty can accept it before it expires.
+// The counterparty pays its leg to the proposer and receives the escrowed leg, either both legs settle or neither does
+// This function triggers a SwapSettled event
+func (s *Erc20Contract) AcceptSwap(ctx contractapi.TransactionContextInterface, swapID string) error {
+
+	swap, err := readOpenSwap(ctx, swapID)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != swap.Counterparty {
+		return fmt.Errorf("only the counterparty can accept swap %s", swapID)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !now.Before(swap.Expiry) {
+		return fmt.Errorf("swap %s expired at %s", swapID, swap.Expiry)
+	}
+
+	get, err := readDenomination(ctx, swap.GetSymbol)
+	if err != nil {
+		return err
+	}
+
+	getValue, err := parseAmount(swap.GetAmount, get.Decimals)
+	if err != nil {
+		return err
+	}
+
+	err = transferSymbol(ctx, get, swap.Counterparty, swap.Proposer, getValue)
+	if err != nil {
+		return fmt.Errorf("failed to settle swap %s: %v", swapID, err)
+	}
+
+	err = releaseSwap(ctx, swap, swap.Counterparty, SwapSettled, now)
+	if err != nil {
+		return err
+	}
+
+	err = emitSwapEvent(ctx, "SwapSettled", swap)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("swap %s settled between %s and %s", swapID, swap.Proposer, swap.Counterparty)
+
+	return nil
+}
+
+// CancelSwap returns the escrowed leg of a swap that was not accepted yet to its proposer,
+// only the proposer can cancel it
+// This function triggers a SwapCancelled event
+func (s *Erc20Contract) CancelSwap(ctx contractapi.TransactionContextInterface, swapID string) error {
+
+	swap, err := readOpenSwap(ctx, swapID)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != swap.Proposer {
+		return fmt.Errorf("only the proposer can cancel swap %s", swapID)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = releaseSwap(ctx, swap, swap.Proposer, SwapCancelled, now)
+	if err != nil {
+		return err
+	}
+
+	err = emitSwapEvent(ctx, "SwapCancelled", swap)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("swap %s cancelled by %s", swapID, clientID)
+
+	return nil
+}
+
+// ExpireSwap returns the escrowed leg of a swap that was not accepted before its expiry to the proposer,
+// any client can trigger it
+// This function triggers a SwapExpired event
+func (s *Erc20Contract) ExpireSwap(ctx contractapi.TransactionContextInterface, swapID string) error {
+
+	swap, err := readOpenSwap(ctx, swapID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now.Before(swap.Expiry) {
+		return fmt.Errorf("swap %s doesn't expire before %s", swapID, swap.Expiry)
+	}
+
+	err = releaseSwap(ctx, swap, swap.Proposer, SwapExpired, now)
+	if err != nil {
+		return err
+	}
+
+	err = emitSwapEvent(ctx, "SwapExpired", swap)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("swap %s expired, %s %s returned to %s", swapID, swap.GiveAmount, swap.GiveSymbol, swap.Proposer)
+
+	return nil
+}
+
+// GetSwap returns a payment-versus-payment swap.
+// Only its parties, their banks and the central bank roles can read a swap of registered accounts
+func (s *Erc20Contract) GetSwap(ctx contractapi.TransactionContextInterface, swapID string) (*Swap, error) {
+	swap, err := readSwap(ctx, swapID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireRecordReader(ctx, swap.Proposer, swap.Counterparty)
+	if err != nil {
+		return nil, fmt.Errorf("client is not authorized to read swap %s: %v", swapID, err)
+	}
+
+	return swap, nil
+}
+
+// Helper Functions
+
+// swapEscrow returns the account holding the proposer's leg of a swap until it is settled, cancelled or expires
+func swapEscrow(swap *Swap) string {
+	if swap.Escrow == "" {
+		return internalAccount(swapPrefix, swap.ID)
+	}
+
+	return swap.Escrow
+}
+
+// readOpenSwap returns a swap that is still waiting for the counterparty
+func readOpenSwap(ctx contractapi.TransactionContextInterface, swapID string) (*Swap, error) {
+	swap, err := readSwap(ctx, swapID)
+	if err != nil {
+		return nil, err
+	}
+	if swap.Status != SwapProposed {
+		return nil, fmt.Errorf("swap %s is %s", swapID, swap.Status)
+	}
+
+	return swap, nil
+}
+
+// releaseSwap transfers the escrowed leg of a swap to an account and stores the swap with its final status.
+// A leg going back to the proposer is returned with returnEscrow
+func releaseSwap(ctx contractapi.TransactionContextInterface, swap *Swap, to string, status string, now time.Time) error {
+	give, err := readDenomination(ctx, swap.GiveSymbol)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(swap.GiveAmount, give.Decimals)
+	if err != nil {
+		return err
+	}
+
+	if to == swap.Proposer {
+		symbol := give.Symbol
+		if give.Primary {
+			symbol = ""
+		}
+		err = returnEscrow(ctx, symbol, swapEscrow(swap), to, value)
+	} else {
+		err = transferSymbol(ctx, give, swapEscrow(swap), to, value)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release swap %s: %v", swap.ID, err)
+	}
+
+	swap.Status = status
+	swap.ClosedAt = now
+
+	return putSwap(ctx, swap)
+}
+
+func readSwap(ctx contractapi.TransactionContextInterface, swapID string) (*Swap, error) {
+	key, err := compositeKey(ctx, swapPrefix, swapID)
+	if err != nil {
+		return nil, err
+	}
+
+	swapBytes, err := readRecord(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read swap %s: %v", swapID, err)
+	}
+	if swapBytes == nil {
+		return nil, fmt.Errorf("swap %s does not exist", swapID)
+	}
+
+	swap := new(Swap)
+	err = json.Unmarshal(swapBytes, swap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode swap %s: %v", swapID, err)
+	}
+
+	return swap, nil
+}
+
+func putSwap(ctx contractapi.TransactionContextInterface, swap *Swap) error {
+	key, err := compositeKey(ctx, swapPrefix, swap.ID)
+	if err != nil {
+		return err
+	}
+
+	swapJSON, err := json.Marshal(swap)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putRecord(ctx, key, swapJSON, swap.Proposer, swap.Counterparty)
+	if err != nil {
+		return fmt.Errorf("failed to update swap %s: %v", swap.ID, err)
+	}
+
+	return nil
+}
+
+// emitSwapEvent emits a swap event carrying the swap
+func emitSwapEvent(ctx contractapi.TransactionContextInterface, name string, swap *Swap) error {
+	return emitPaymentEvent(ctx, name, swap.ID, swap, swap.Proposer, swap.Counterparty)
+}
@@ -0,0 +1,97 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSwap(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierFull, customer, commercial)
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "300"))
+	mustSucceed(t, contract.RegisterDenomination(ledger.as(centralBank, "Org2MSP"), "WST", "Wholesale settlement token", "4"))
+	mustSucceed(t, contract.MintDenomination(ledger.as(centralBank, "Org2MSP"), "WST", "200"))
+	mustSucceed(t, contract.TransferDenomination(ledger.as(centralBank, "Org2MSP"), "WST", commercial, "200"))
+
+	expiry := ledger.now.Add(time.Hour).Unix()
+	_, err := contract.ProposeSwap(ledger.as(customer, "Org1MSP"), commercial, "CBR", "100", "CBR", "50", expiry)
+	mustFail(t, err)
+	_, err = contract.ProposeSwap(ledger.as(customer, "Org1MSP"), commercial, "CBR", "100", "XYZ", "50", expiry)
+	mustFail(t, err)
+	_, err = contract.ProposeSwap(ledger.as(customer, "Org1MSP"), commercial, "CBR", "100", "WST", "50", ledger.now.Unix())
+	mustFail(t, err)
+	_, err = contract.ProposeSwap(ledger.as(customer, "Org1MSP"), commercial, "CBR", "1000", "WST", "50", expiry)
+	mustFail(t, err)
+
+	settled, err := contract.ProposeSwap(ledger.as(customer, "Org1MSP"), commercial, "CBR", "100", "WST", "50", expiry)
+	mustSucceed(t, err)
+	if name := ledger.lastEvent(); name != "SwapProposed" {
+		t.Fatalf("expected SwapProposed event, got %q", name)
+	}
+
+	// Only the counterparty can accept, and only the proposer can cancel
+	mustFail(t, contract.AcceptSwap(ledger.as(customer, "Org1MSP"), settled))
+	mustFail(t, contract.CancelSwap(ledger.as(commercial, "Org1MSP"), settled))
+	mustFail(t, contract.ExpireSwap(ledger.as(commercial, "Org1MSP"), settled))
+	mustSucceed(t, contract.AcceptSwap(ledger.as(commercial, "Org1MSP"), settled))
+	if name := ledger.lastEvent(); name != "SwapSettled" {
+		t.Fatalf("expected SwapSettled event, got %q", name)
+	}
+	mustFail(t, contract.CancelSwap(ledger.as(customer, "Org1MSP"), settled))
+
+	// A counterparty that can't pay its leg leaves the swap open
+	unpaid, err := contract.ProposeSwap(ledger.as(customer, "Org1MSP"), commercial, "CBR", "50", "WST", "500", expiry)
+	mustSucceed(t, err)
+	mustFail(t, contract.AcceptSwap(ledger.as(commercial, "Org1MSP"), unpaid))
+	mustSucceed(t, contract.Pause(ledger.as(centralBank, "Org2MSP"), PauseAll, "incident"))
+	mustFail(t, contract.CancelSwap(ledger.as(customer, "Org1MSP"), unpaid))
+	mustSucceed(t, contract.Unpause(ledger.as(centralBank, "Org2MSP"), PauseAll, "resolved"))
+	mustSucceed(t, contract.CancelSwap(ledger.as(customer, "Org1MSP"), unpaid))
+	if name := ledger.lastEvent(); name != "SwapCancelled" {
+		t.Fatalf("expected SwapCancelled event, got %q", name)
+	}
+
+	// After the expiry the swap can't be accepted anymore and anyone can return the escrowed leg
+	expired, err := contract.ProposeSwap(ledger.as(commercial, "Org1MSP"), customer, "WST", "10", "CBR", "20", expiry)
+	mustSucceed(t, err)
+	ledger.advance(time.Hour)
+	mustFail(t, contract.AcceptSwap(ledger.as(customer, "Org1MSP"), expired))
+	mustSucceed(t, contract.ExpireSwap(ledger.as(centralBank, "Org2MSP"), expired))
+
+	swap, err := contract.GetSwap(ledger.as(customer, "Org1MSP"), expired)
+	mustSucceed(t, err)
+	if swap.Status != SwapExpired {
+		t.Fatalf("expected swap to be expired, got %s", swap.Status)
+	}
+	cancelled, err := contract.GetSwap(ledger.as(customer, "Org1MSP"), unpaid)
+	mustSucceed(t, err)
+
+	// Swaps of registered accounts are kept in the collection of their bank
+	swapKey, err := compositeKey(ledger.as(customer, "Org1MSP"), swapPrefix, expired)
+	mustSucceed(t, err)
+	if ledger.stub.State[swapKey] != nil || ledger.stub.PvtState[balancesCollection("Org1MSP")][swapKey] == nil {
+		t.Fatalf("expected the swap in the collection of the bank only")
+	}
+	other := clientID("CN=user1,OU=client,O=Hyperledger,ST=North Carolina,C=US::CN=ca.org3.example.com")
+	_, err = contract.GetSwap(ledger.as(other, "Org3MSP"), expired)
+	mustFail(t, err)
+
+	expected := []struct {
+		symbol  string
+		account string
+		balance string
+	}{
+		{"CBR", customer, "200.00"},
+		{"CBR", commercial, "100.00"},
+		{"WST", customer, "50.0000"},
+		{"WST", commercial, "150.0000"},
+		{"CBR", swapEscrow(cancelled), "0.00"},
+		{"WST", swapEscrow(swap), "0.0000"},
+	}
+	for _, e := range expected {
+		balance, err := contract.BalanceOfDenomination(ledger.as(centralBank, "Org2MSP"), e.symbol, e.account)
+		mustSucceed(t, err)
+		if balance != e.balance {
+			t.Fatalf("expected %s balance %s, got %s", e.symbol, e.balance, balance)
+		}
+	}
+}
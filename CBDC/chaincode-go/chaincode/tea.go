@@ -9,11 +9,8 @@ import (
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-// Define key names for options
-var MINTER = "Org2MSP"
-
 // Define objectType names for prefix
-const allowancePrefix = "allowance"
+const teaAllowancePrefix = "teaAllowance"
 
 // TeaContract provides functions for managing a car
 type TeaContract struct {
@@ -27,20 +24,20 @@ type Tea struct {
 	Owner  string `json:"owner"`
 }
 
-// QueryResult structure used for handling result of query
-type QueryResult struct {
+// TeaQueryResult structure used for handling result of query
+type TeaQueryResult struct {
 	Key    string `json:"key"`
 	Record *Tea
 }
-type QueryHistory struct {
+type TeaQueryHistory struct {
 	TxID string `json:"txID"`
 	TimeStamp time.Time `json:"timestamp"`
 	IsDelete bool `json:"isDelete"`
 	Record *Tea
 }
 
-// event provides an organized struct for emitting events
-type event struct {
+// teaEvent provides an organized struct for emitting events
+type teaEvent struct {
 	From  string `json:"from"`
 	To    string `json:"to"`
 	Record	*Tea    `json:"value"`
@@ -48,15 +45,18 @@ type event struct {
 
 func (s *TeaContract) Mint(ctx contractapi.TransactionContextInterface, name string, price float32, amount float32, recipient string)(string, error){
 
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check minter authorization against the role registry
+	err := requireRole(ctx, RoleMinter)
 	if err != nil {
-		return "", fmt.Errorf("Не удается получить MSPID")
+		return "", fmt.Errorf("Клиент не авторизован для выпуска токенов: %v", err)
 	}
-	if clientMSPID != MINTER {
-		return "", fmt.Errorf("Клиент не авторизован для выпуска токенов!")
+
+	err = checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return "", fmt.Errorf("Выпуск токенов приостановлен: %v", err)
 	}
-	
+
+
 	// Get ID of submitting client identity
 	minter, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
@@ -114,15 +114,13 @@ func (s *TeaContract) QueryToken(ctx contractapi.TransactionContextInterface, to
 }
 
 // QueryAllCars returns all cars found in world state
-func (s *TeaContract) QueryAllTokens(ctx contractapi.TransactionContextInterface) ([]QueryResult, error) {
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+func (s *TeaContract) QueryAllTokens(ctx contractapi.TransactionContextInterface) ([]TeaQueryResult, error) {
+	err := requireRole(ctx, RoleMinter, RoleAuditor, RoleRegulator)
 	if err != nil {
-		return nil, fmt.Errorf("Не удается получить MSPID")
+		return nil, fmt.Errorf("Клиент не авторизован для просмотра токенов: %v", err)
 	}
-	if clientMSPID != MINTER {
-		return nil, fmt.Errorf("Клиент не авторизован для просмотра токенов!")
-	}
-	
+
+
 	startKey := ""
 	endKey := ""
 
@@ -133,7 +131,7 @@ func (s *TeaContract) QueryAllTokens(ctx contractapi.TransactionContextInterface
 	}
 	defer resultsIterator.Close()
 
-	results := []QueryResult{}
+	results := []TeaQueryResult{}
 
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
@@ -145,7 +143,7 @@ func (s *TeaContract) QueryAllTokens(ctx contractapi.TransactionContextInterface
 		tea := new(Tea)
 		_ = json.Unmarshal(queryResponse.Value, tea)
 
-		queryResult := QueryResult{Key: queryResponse.Key, Record: tea}
+		queryResult := TeaQueryResult{Key: queryResponse.Key, Record: tea}
 		results = append(results, queryResult)
 	}
 
@@ -153,15 +151,13 @@ func (s *TeaContract) QueryAllTokens(ctx contractapi.TransactionContextInterface
 }
 
 // QueryAllCars returns all cars found in world state
-func (s *TeaContract) QueryTokensByClientID(ctx contractapi.TransactionContextInterface, clientID string) ([]QueryResult, error) {
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+func (s *TeaContract) QueryTokensByClientID(ctx contractapi.TransactionContextInterface, clientID string) ([]TeaQueryResult, error) {
+	err := requireRole(ctx, RoleMinter, RoleAuditor, RoleRegulator)
 	if err != nil {
-		return nil, fmt.Errorf("Не удается получить MSPID")
-	}
-	if clientMSPID != MINTER {
-		return nil, fmt.Errorf("Клиент не авторизован для просмотра токенов!")
+		return nil, fmt.Errorf("Клиент не авторизован для просмотра токенов: %v", err)
 	}
-	
+
+
 	startKey := ""
 	endKey := ""
 
@@ -172,7 +168,7 @@ func (s *TeaContract) QueryTokensByClientID(ctx contractapi.TransactionContextIn
 	}
 	defer resultsIterator.Close()
 
-	results := []QueryResult{}
+	results := []TeaQueryResult{}
 
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
@@ -185,7 +181,7 @@ func (s *TeaContract) QueryTokensByClientID(ctx contractapi.TransactionContextIn
 		_ = json.Unmarshal(queryResponse.Value, token)
 
 		if token.Owner == clientID{
-			queryResult := QueryResult{Key: queryResponse.Key, Record: token}
+			queryResult := TeaQueryResult{Key: queryResponse.Key, Record: token}
 			results = append(results, queryResult)
 		}
 	}
@@ -193,7 +189,7 @@ func (s *TeaContract) QueryTokensByClientID(ctx contractapi.TransactionContextIn
 	return results, nil
 }
 
-func (s *TeaContract) QueryClientTokens(ctx contractapi.TransactionContextInterface) ([]QueryResult, error) {
+func (s *TeaContract) QueryClientTokens(ctx contractapi.TransactionContextInterface) ([]TeaQueryResult, error) {
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return nil, fmt.Errorf("Не удается получить ID")
@@ -209,7 +205,7 @@ func (s *TeaContract) QueryClientTokens(ctx contractapi.TransactionContextInterf
 	}
 	defer resultsIterator.Close()
 
-	results := []QueryResult{}
+	results := []TeaQueryResult{}
 
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
@@ -222,7 +218,7 @@ func (s *TeaContract) QueryClientTokens(ctx contractapi.TransactionContextInterf
 		_ = json.Unmarshal(queryResponse.Value, token)
 
 		if token.Owner == clientID{
-			queryResult := QueryResult{Key: queryResponse.Key, Record: token}
+			queryResult := TeaQueryResult{Key: queryResponse.Key, Record: token}
 			results = append(results, queryResult)
 		}
 	}
@@ -231,6 +227,11 @@ func (s *TeaContract) QueryClientTokens(ctx contractapi.TransactionContextInterf
 }
 
 func (s *TeaContract) Transfer(ctx contractapi.TransactionContextInterface, tokenId string, recipientId string) string {
+	err := checkNotPaused(ctx, PauseTransfers)
+	if err != nil {
+		return "Передача токенов приостановлена: " + err.Error()
+	}
+
 	// Get ID of submitting client identity
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
@@ -254,19 +255,27 @@ func (s *TeaContract) Transfer(ctx contractapi.TransactionContextInterface, toke
 	tokenAsBytes, _ := json.Marshal(token)
 	ctx.GetStub().PutState(tokenId, tokenAsBytes)
 
+	// The offer of the previous owner can't be accepted anymore
+	err = closeTokenOffer(ctx, tokenId)
+	if err != nil {
+		return "Не удалось закрыть предложение токена: " + err.Error()
+	}
+
 	return "Токен был успешно передан"
 }
 
 func (s *TeaContract) Burn(ctx contractapi.TransactionContextInterface, tokenId string) (string){
 	
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to burn new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check burner authorization against the role registry
+	isBurner, err := callerHasAnyRole(ctx, RoleBurner)
 	if err != nil {
-		return "Не удается получить MSPID"
+		return "Не удается проверить роль клиента"
+	}
+
+	err = checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return "Выпуск и погашение токенов приостановлены: " + err.Error()
 	}
-	// if clientMSPID != MINTER {
-	// 	return "Клиент не может сжигать токены"
-	// }
 
 	// Get ID of submitting client identity
 	clientID, err := ctx.GetClientIdentity().GetID()
@@ -279,21 +288,31 @@ func (s *TeaContract) Burn(ctx contractapi.TransactionContextInterface, tokenId
 		return "Не удалось найти указанный токен"
 	}
 
-	if token.Owner != clientID  || clientMSPID != MINTER{
+	if token.Owner != clientID || !isBurner {
 		return "Вы не можете удалить токен"
 	}
 
 	ctx.GetStub().DelState(tokenId)
 
+	err = closeTokenOffer(ctx, tokenId)
+	if err != nil {
+		return "Не удалось закрыть предложение токена: " + err.Error()
+	}
+
 	return "Токен был успешно удалён"
 
 }
 
 func (s *TeaContract) Sub(ctx contractapi.TransactionContextInterface, tokenId string, amount float32) string {
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to burn new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check burner authorization against the role registry
+	isBurner, err := callerHasAnyRole(ctx, RoleBurner)
 	if err != nil {
-		return "Не удается получить MSPID"
+		return "Не удается проверить роль клиента"
+	}
+
+	err = checkNotPaused(ctx, PauseMinting)
+	if err != nil {
+		return "Выпуск и погашение токенов приостановлены: " + err.Error()
 	}
 
 	// Get ID of submitting client identity
@@ -307,7 +326,7 @@ func (s *TeaContract) Sub(ctx contractapi.TransactionContextInterface, tokenId s
 		return "Не удалось найти указанный токен"
 	}
 
-	if token.Owner != clientID  || clientMSPID != MINTER{
+	if token.Owner != clientID || !isBurner {
 		return "Вы не можете удалить токен"
 	}
 
@@ -319,9 +338,14 @@ func (s *TeaContract) Sub(ctx contractapi.TransactionContextInterface, tokenId s
 
 	if token.Amount == 0{
 		ctx.GetStub().DelState(tokenId)
+
+		err = closeTokenOffer(ctx, tokenId)
+		if err != nil {
+			return "Не удалось закрыть предложение токена: " + err.Error()
+		}
 	}
 
-	return fmt.Sprintf("Количество токена было уменьшено на %s единиц", amount)
+	return fmt.Sprintf("Количество токена было уменьшено на %v единиц", amount)
 }
 
 func (s *TeaContract) ClientAccountID(ctx contractapi.TransactionContextInterface) (string, error) {
@@ -335,14 +359,14 @@ func (s *TeaContract) ClientAccountID(ctx contractapi.TransactionContextInterfac
 }
 
 // GetHistoryForKey returns all transactions for a given key (token)
-func (s *TeaContract) GetHistoryForKey(ctx contractapi.TransactionContextInterface, key string) ([]QueryHistory, error) {
+func (s *TeaContract) GetHistoryForKey(ctx contractapi.TransactionContextInterface, key string) ([]TeaQueryHistory, error) {
 	iterator, err := ctx.GetStub().GetHistoryForKey(key)
 	if err != nil {
 		return nil, fmt.Errorf("Не удалось получить историю транзакций токена %s: %v", key, err)
 	}
 	defer iterator.Close()
 
-	var result []QueryHistory
+	var result []TeaQueryHistory
 	for iterator.HasNext() {
 		response, err := iterator.Next()
 		if err != nil {
@@ -356,7 +380,7 @@ func (s *TeaContract) GetHistoryForKey(ctx contractapi.TransactionContextInterfa
 		value := new(Tea)
 	_ = json.Unmarshal(valueBytes, &value)
 
-		tea := QueryHistory{
+		tea := TeaQueryHistory{
 			TxID: txID,
 			TimeStamp: timestamp,
 			IsDelete: isDelete,
@@ -375,6 +399,11 @@ func (s *TeaContract) GetHistoryForKey(ctx contractapi.TransactionContextInterfa
 
 // ??????????????????????????????????????????? 
 func (s *TeaContract) Approve(ctx contractapi.TransactionContextInterface, spender string, tokenId string) error {
+	err := checkNotPaused(ctx, PauseApprovals)
+	if err != nil {
+		return err
+	}
+
 	// Get ID of submitting client identity
 	owner, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
@@ -382,9 +411,9 @@ func (s *TeaContract) Approve(ctx contractapi.TransactionContextInterface, spend
 	}
 
 	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(teaAllowancePrefix, []string{owner, spender})
 	if err != nil {
-		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", teaAllowancePrefix, err)
 	}
 
 	// Update the state of the smart contract by adding the allowanceKey and value
@@ -397,7 +426,7 @@ func (s *TeaContract) Approve(ctx contractapi.TransactionContextInterface, spend
 		return fmt.Errorf("Не удалось найти указанный токен")
 	}
 	// Emit the Approval event
-	approvalEvent := event{owner, spender, token}
+	approvalEvent := teaEvent{owner, spender, token}
 	approvalEventJSON, err := json.Marshal(approvalEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -415,9 +444,9 @@ func (s *TeaContract) Approve(ctx contractapi.TransactionContextInterface, spend
 // Allowance returns the amount still available for the spender to withdraw from the owner
 func (s *TeaContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (int, error) {
 	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(teaAllowancePrefix, []string{owner, spender})
 	if err != nil {
-		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", teaAllowancePrefix, err)
 	}
 
 	// Read the allowance amount from the world state
@@ -443,6 +472,11 @@ func (s *TeaContract) Allowance(ctx contractapi.TransactionContextInterface, own
 // TransferFrom transfers the value amount from the "from" address to the "to" address
 // This function triggers a Transfer event
 func (s *TeaContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, tokenId string) error {
+	err := checkNotPaused(ctx, PauseTransfers)
+	if err != nil {
+		return err
+	}
+
 	// Get ID of submitting client identity
 	spender, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
@@ -450,9 +484,9 @@ func (s *TeaContract) TransferFrom(ctx contractapi.TransactionContextInterface,
 	}
 
 	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{from, spender})
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(teaAllowancePrefix, []string{from, spender})
 	if err != nil {
-		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", teaAllowancePrefix, err)
 	}
 
 	// Retrieve the allowance of the spender
@@ -484,7 +518,7 @@ func (s *TeaContract) TransferFrom(ctx contractapi.TransactionContextInterface,
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{from, to, token}
+	transferEvent := teaEvent{from, to, token}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
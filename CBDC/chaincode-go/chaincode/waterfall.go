@@ -0,0 +1,316 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const waterfallPrefix = "waterfall"
+
+// Waterfall links a retail account to a deposit account at its servicing bank.
+// Incoming funds above the holding cap are routed to the reserve of the bank, which credits the linked
+// deposit account. With the reverse waterfall enabled, an outgoing payment the balance can't cover is topped up
+// from the bank reserve, up to the amount routed to the bank before
+type Waterfall struct {
+	Account          string `json:"account"`
+	Bank             string `json:"bank"`
+	HoldingCap       string `json:"holdingCap"`
+	LinkedAccountRef string `json:"linkedAccountRef"`
+	ReverseWaterfall bool   `json:"reverseWaterfall"`
+	Swept            string `json:"swept"`
+}
+
+// transferLeg provides an organized struct for emitting the movements a payment caused on top of itself,
+// such as a waterfall to the linked deposit account
+type transferLeg struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+}
+
+// SetWaterfall sets the holding cap and linked deposit account of a customer of the calling bank
+// param {String} holdingCap The maximum balance of the account, e.g. "3000.00"
+// param {String} linkedAccountRef The linked deposit account at the bank, e.g. an IBAN
+// param {bool} reverseWaterfall Whether outgoing payments are topped up from the linked account
+// This function triggers a WaterfallSet event
+func (s *Erc20Contract) SetWaterfall(ctx contractapi.TransactionContextInterface, account string, holdingCap string, linkedAccountRef string, reverseWaterfall bool) error {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract ia already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set waterfalls: %v", err)
+	}
+
+	registered, err := requireServicedAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	if linkedAccountRef == "" {
+		return fmt.Errorf("linked account reference must not be empty")
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return err
+	}
+
+	holdingCapAmount, err := parseAmount(holdingCap, decimals)
+	if err != nil {
+		return err
+	}
+
+	waterfall, err := readWaterfall(ctx, account)
+	if err != nil {
+		return err
+	}
+	if waterfall == nil {
+		waterfall = &Waterfall{Account: account, Swept: formatAmount(new(big.Int), decimals)}
+	}
+
+	waterfall.Bank = registered.Bank
+	waterfall.HoldingCap = formatAmount(holdingCapAmount, decimals)
+	waterfall.LinkedAccountRef = linkedAccountRef
+	waterfall.ReverseWaterfall = reverseWaterfall
+
+	err = putWaterfall(ctx, waterfall)
+	if err != nil {
+		return err
+	}
+
+	err = emitPaymentEvent(ctx, "WaterfallSet", account, waterfall, account)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("waterfall of %s set to holding cap %s linked to %s", account, waterfall.HoldingCap, linkedAccountRef)
+
+	return nil
+}
+
+// RemoveWaterfall removes the holding cap and linked deposit account of a customer of the calling bank
+func (s *Erc20Contract) RemoveWaterfall(ctx contractapi.TransactionContextInterface, account string) error {
+
+	err := requireRole(ctx, RoleBank)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to remove waterfalls: %v", err)
+	}
+
+	_, err = requireServicedAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	waterfall, err := readWaterfall(ctx, account)
+	if err != nil {
+		return err
+	}
+	if waterfall == nil {
+		return fmt.Errorf("account %s has no waterfall", account)
+	}
+
+	key, err := compositeKey(ctx, waterfallPrefix, account)
+	if err != nil {
+		return err
+	}
+
+	err = delAccountState(ctx, account, key)
+	if err != nil {
+		return fmt.Errorf("failed to remove waterfall of %s: %v", account, err)
+	}
+
+	log.Printf("waterfall of %s removed", account)
+
+	return nil
+}
+
+// GetWaterfall returns the holding cap and linked deposit account of an account
+// Only the account itself, its bank and the central bank roles can read it
+func (s *Erc20Contract) GetWaterfall(ctx contractapi.TransactionContextInterface, account string) (*Waterfall, error) {
+
+	waterfall, err := readWaterfall(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if waterfall == nil {
+		return nil, fmt.Errorf("account %s has no waterfall", account)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != account {
+		err = requireBankOrCentralBank(ctx, waterfall.Bank)
+		if err != nil {
+			return nil, fmt.Errorf("client is not authorized to read the waterfall of %s: %v", account, err)
+		}
+	}
+
+	return waterfall, nil
+}
+
+// Helper Functions
+
+// sweepWaterfall routes the part of a credit that lifts the account above its holding cap to the reserve
+// of its bank. It returns the waterfall leg, or nil when nothing was routed
+func sweepWaterfall(ctx contractapi.TransactionContextInterface, sheet *balanceSheet, account string, credit *big.Int) (*transferLeg, error) {
+	waterfall, err := readWaterfall(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if waterfall == nil {
+		return nil, nil
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	holdingCap, err := parseAmount(waterfall.HoldingCap, decimals)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, _, err := sheet.balance(account)
+	if err != nil {
+		return nil, err
+	}
+	if balance.Cmp(holdingCap) <= 0 {
+		return nil, nil
+	}
+
+	// Only the incoming funds are routed, a balance already above a lowered cap is left as it is
+	overflow := new(big.Int).Sub(balance, holdingCap)
+	if overflow.Cmp(credit) > 0 {
+		overflow.Set(credit)
+	}
+
+	reserve := reserveAccount(waterfall.Bank)
+
+	err = sheet.add(account, new(big.Int).Neg(overflow))
+	if err != nil {
+		return nil, err
+	}
+	err = sheet.add(reserve, overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	swept, err := parseAmount(waterfall.Swept, decimals)
+	if err != nil {
+		return nil, err
+	}
+	waterfall.Swept = formatAmount(swept.Add(swept, overflow), decimals)
+
+	sheet.onWrite(func() error {
+		return putWaterfall(ctx, waterfall)
+	})
+
+	log.Printf("routed %s above the holding cap of %s to %s", formatAmount(overflow, decimals), account, waterfall.LinkedAccountRef)
+
+	return &transferLeg{account, reserve, formatAmount(overflow, decimals)}, nil
+}
+
+// reverseWaterfall tops up the balance of an account short of shortfall from the reserve of its bank.
+// It returns the top-up leg, or nil when the account has no reverse waterfall or not enough was routed to the bank before
+func reverseWaterfall(ctx contractapi.TransactionContextInterface, sheet *balanceSheet, account string, shortfall *big.Int) (*transferLeg, error) {
+	waterfall, err := readWaterfall(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if waterfall == nil || !waterfall.ReverseWaterfall {
+		return nil, nil
+	}
+
+	decimals, err := readDecimals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	swept, err := parseAmount(waterfall.Swept, decimals)
+	if err != nil {
+		return nil, err
+	}
+	if swept.Cmp(shortfall) < 0 {
+		return nil, nil
+	}
+
+	reserve := reserveAccount(waterfall.Bank)
+
+	err = sheet.add(reserve, new(big.Int).Neg(shortfall))
+	if err != nil {
+		return nil, err
+	}
+	err = sheet.add(account, shortfall)
+	if err != nil {
+		return nil, err
+	}
+
+	waterfall.Swept = formatAmount(swept.Sub(swept, shortfall), decimals)
+
+	sheet.onWrite(func() error {
+		return putWaterfall(ctx, waterfall)
+	})
+
+	log.Printf("topped up %s of %s from %s", formatAmount(shortfall, decimals), account, waterfall.LinkedAccountRef)
+
+	return &transferLeg{reserve, account, formatAmount(shortfall, decimals)}, nil
+}
+
+// readWaterfall returns the waterfall of an account, or nil when it has none
+func readWaterfall(ctx contractapi.TransactionContextInterface, account string) (*Waterfall, error) {
+	key, err := compositeKey(ctx, waterfallPrefix, account)
+	if err != nil {
+		return nil, err
+	}
+
+	waterfallBytes, err := readAccountState(ctx, account, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read waterfall of %s: %v", account, err)
+	}
+	if waterfallBytes == nil {
+		return nil, nil
+	}
+
+	waterfall := new(Waterfall)
+	err = json.Unmarshal(waterfallBytes, waterfall)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode waterfall of %s: %v", account, err)
+	}
+
+	return waterfall, nil
+}
+
+func putWaterfall(ctx contractapi.TransactionContextInterface, waterfall *Waterfall) error {
+	key, err := compositeKey(ctx, waterfallPrefix, waterfall.Account)
+	if err != nil {
+		return err
+	}
+
+	waterfallJSON, err := json.Marshal(waterfall)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putAccountState(ctx, waterfall.Account, key, waterfallJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update waterfall of %s: %v", waterfall.Account, err)
+	}
+
+	return nil
+}
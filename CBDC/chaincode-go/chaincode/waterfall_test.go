@@ -0,0 +1,64 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWaterfall(t *testing.T) {
+	ledger, contract := newFundedLedger(t, TierBasic, customer, commercial)
+
+	mustFail(t, contract.SetWaterfall(ledger.as(centralBank, "Org2MSP"), customer, "100", "BY20OLMP31350000001000000933", true))
+	mustSucceed(t, contract.SetWaterfall(ledger.as(commercial, "Org1MSP"), customer, "100", "BY20OLMP31350000001000000933", true))
+
+	// Incoming funds above the holding cap go to the bank
+	mustSucceed(t, contract.Transfer(ledger.as(centralBank, "Org2MSP"), customer, "150"))
+
+	// Legs of payments of registered accounts stay out of the public event
+	transferEvent := <-ledger.stub.ChaincodeEventsChannel
+	var emitted event
+	mustSucceed(t, json.Unmarshal(transferEvent.Payload, &emitted))
+	if len(emitted.Legs) != 0 || emitted.Value != "" {
+		t.Fatalf("expected no legs in the Transfer event, got %s", transferEvent.Payload)
+	}
+
+	for account, expected := range map[string]string{customer: "100.00", reserveAccount("Org1MSP"): "50.00"} {
+		balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), account)
+		mustSucceed(t, err)
+		if balance != expected {
+			t.Fatalf("expected balance %s, got %s", expected, balance)
+		}
+	}
+
+	// A short outgoing payment is topped up from the bank
+	mustSucceed(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "120"))
+
+	for account, expected := range map[string]string{customer: "0.00", commercial: "120.00", reserveAccount("Org1MSP"): "30.00"} {
+		balance, err := contract.BalanceOf(ledger.as(customer, "Org1MSP"), account)
+		mustSucceed(t, err)
+		if balance != expected {
+			t.Fatalf("expected balance %s, got %s", expected, balance)
+		}
+	}
+
+	waterfall, err := contract.GetWaterfall(ledger.as(customer, "Org1MSP"), customer)
+	mustSucceed(t, err)
+	if waterfall.Swept != "30.00" {
+		t.Fatalf("expected 30.00 swept, got %s", waterfall.Swept)
+	}
+
+	// The top up is limited to what was routed to the bank before
+	mustFail(t, contract.Transfer(ledger.as(customer, "Org1MSP"), commercial, "40"))
+
+	// The linked deposit account is kept in the collection of the bank
+	ctx := ledger.as(commercial, "Org1MSP")
+	key, err := compositeKey(ctx, waterfallPrefix, customer)
+	mustSucceed(t, err)
+	if ledger.stub.State[key] != nil || ledger.stub.PvtState[balancesCollection("Org1MSP")][key] == nil {
+		t.Fatalf("expected the waterfall in the collection of the bank only")
+	}
+	mustSucceed(t, contract.RemoveWaterfall(ctx, customer))
+	if ledger.stub.PvtState[balancesCollection("Org1MSP")][key] != nil {
+		t.Fatalf("expected the waterfall to be removed from the collection")
+	}
+}
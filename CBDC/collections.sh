@@ -0,0 +1,70 @@
+#!/bin/bash
+#
+# SPDX-License-Identifier: Apache-2.0
+#
+# Generates the private data collection config of the cbdc chaincode, e.g.
+#   ./collections.sh Org2MSP Org1MSP > collections_config.json
+# The first MSP is the central bank, the others are commercial banks.
+#
+# Every bank gets a balances<MSP> collection shared with the central bank. Every pair of banks gets a
+# transfers<MSP>_<MSP> collection recording the transfers between their customers, with the MSPs sorted the way the
+# chaincode sorts them. Writes to a collection must be endorsed by a peer of every member, so no bank can endorse
+# balances of its customers on its own: a peer of the central bank signs every write, next to the peers of the banks
+# involved. The aliases collection holds the salt of the alias directory and only has the central bank as member.
+
+function _exit(){
+    printf "Exiting:%s\n" "$1"
+    exit -1
+}
+
+if [ "$#" -lt 1 ]; then
+    _exit "usage: $0 <central bank MSP> [bank MSP...]"
+fi
+
+CENTRAL_BANK="$1"
+BANKS=$(printf "%s\n" "$@" | LC_ALL=C sort -u)
+
+# collection <name> <member MSP...>, writes need the endorsement of a peer of every member
+function collection(){
+    local name="$1"
+    shift
+    local members=$(printf "'%s.member'," "$@")
+    local peers=$(printf "'%s.peer'," "$@")
+
+    printf '  {\n'
+    printf '    "name": "%s",\n' "${name}"
+    printf '    "policy": "OR(%s)",\n' "${members%,}"
+    printf '    "requiredPeerCount": 0,\n'
+    printf '    "maxPeerCount": 3,\n'
+    printf '    "blockToLive": 0,\n'
+    printf '    "memberOnlyRead": true,\n'
+    printf '    "memberOnlyWrite": false,\n'
+    printf '    "endorsementPolicy": {\n'
+    printf '      "signaturePolicy": "AND(%s)"\n' "${peers%,}"
+    printf '    }\n'
+    printf '  }'
+}
+
+# members <MSP...> adds the central bank to the members unless it is one of them already
+function members(){
+    printf "%s\n" "$@" "${CENTRAL_BANK}" | LC_ALL=C sort -u
+}
+
+SEPARATOR=""
+printf '[\n'
+for BANK in ${BANKS}; do
+    printf "${SEPARATOR}"
+    collection "balances${BANK}" $(members "${BANK}")
+    SEPARATOR=",\n"
+done
+for BANK in ${BANKS}; do
+    for OTHER in ${BANKS}; do
+        if [[ "${BANK}" < "${OTHER}" ]]; then
+            printf "${SEPARATOR}"
+            collection "transfers${BANK}_${OTHER}" $(members "${BANK}" "${OTHER}")
+        fi
+    done
+done
+printf "${SEPARATOR}"
+collection "aliases" "${CENTRAL_BANK}"
+printf '\n]\n'
@@ -1,23 +0,0 @@
-/*
-SPDX-License-Identifier: Apache-2.0
-*/
-
-package main
-
-import (
-	"log"
-
-	"github.com/hyperledger/fabric-contract-api-go/contractapi"
-	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode"
-)
-
-func main() {
-	tokenChaincode, err := contractapi.NewChaincode(&chaincode.SmartContract{})
-	if err != nil {
-		log.Panicf("Error creating token-erc-20 chaincode: %v", err)
-	}
-
-	if err := tokenChaincode.Start(); err != nil {
-		log.Panicf("Error starting token-erc-20 chaincode: %v", err)
-	}
-}
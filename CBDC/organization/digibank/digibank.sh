@@ -15,8 +15,9 @@ function _exit(){
 : ${MAX_RETRY:="5"}
 : ${VERBOSE:="false"}
 
-# Where am I?
-DIR=${PWD}
+# Where am I? DIR is the CBDC directory holding the single chaincode-go shared by every organization,
+# whether this script is run directly or sourced by startCBDC.sh
+DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )/../.." && pwd )"
 
 # Locate the test network
 cd "${DIR}/../test-network"
@@ -37,13 +38,13 @@ rm $TMPFILE
 
 cd "${DIR}"
 
-peer lifecycle chaincode package cp.tar.gz --lang golang --path ${DIR}/chaincode-tea-go --label cp_0
+peer lifecycle chaincode package cp.tar.gz --lang golang --path ${DIR}/chaincode-go --label cp_0
 peer lifecycle chaincode install cp.tar.gz
 PACKAGE_ID="$(peer lifecycle chaincode queryinstalled | grep -oP 'cp_0:.*(?=,)')"
 echo "Exported $PACKAGE_ID"
-peer lifecycle chaincode approveformyorg --orderer localhost:7050 --ordererTLSHostnameOverride orderer.example.com --channelID mychannel --name cbdc -v 0 --package-id $PACKAGE_ID --sequence 1 --tls --cafile $ORDERER_CA
+peer lifecycle chaincode approveformyorg --orderer localhost:7050 --ordererTLSHostnameOverride orderer.example.com --channelID mychannel --name cbdc -v 0 --package-id $PACKAGE_ID --sequence 1 --collections-config ${DIR}/collections_config.json --tls --cafile $ORDERER_CA
 
-peer lifecycle chaincode commit -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --peerAddresses localhost:7051 --tlsRootCertFiles ${PEER0_ORG1_CA} --peerAddresses localhost:9051 --tlsRootCertFiles ${PEER0_ORG2_CA} --channelID mychannel --name cbdc -v 0 --sequence 1 --tls --cafile $ORDERER_CA --waitForEvent
+peer lifecycle chaincode commit -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --peerAddresses localhost:7051 --tlsRootCertFiles ${PEER0_ORG1_CA} --peerAddresses localhost:9051 --tlsRootCertFiles ${PEER0_ORG2_CA} --channelID mychannel --name cbdc -v 0 --sequence 1 --collections-config ${DIR}/collections_config.json --tls --cafile $ORDERER_CA --waitForEvent
 
 peer lifecycle chaincode querycommitted --channelID mychannel --name cbdc --cafile ${PWD}/../test-network/organizations/ordererOrganizations/example.com/orderers/orderer.example.com/msp/tlscacerts/tlsca.example.com-cert.pem
 